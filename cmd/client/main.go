@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -17,7 +18,10 @@ const (
 )
 
 type Session struct {
-	Token      string
+	Token        string
+	RefreshToken string
+	// MFAToken is set between the password and the code login steps
+	MFAToken   string
 	UserInfo   map[string]interface{}
 	IsLoggedIn bool
 }
@@ -51,16 +55,54 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
+	Token            string `json:"token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	MFASetupRequired bool   `json:"mfa_setup_required"`
+	MFARequired      bool   `json:"mfa_required"`
+	MFAToken         string `json:"mfa_token"`
+}
+
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type VerifyEmailRequest struct {
 	Token string `json:"token"`
 }
 
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type CreateRentalRequest struct {
 	EquipmentID uint      `json:"equipment_id"`
-	StartDate   time.Time `json:"start_date"`
-	EndDate     time.Time `json:"end_date"`
+	Quantity    int       `json:"quantity"`
+	StartDate   time.Time `json:"from_date"`
+	EndDate     time.Time `json:"to_date"`
 	Comment     string    `json:"comment"`
 }
 
+type HandoverRequest struct {
+	Note     string `json:"note"`
+	Damaged  bool   `json:"damaged"`
+	AssetIDs []uint `json:"asset_ids,omitempty"`
+}
+
 type Equipment struct {
 	ID                uint   `json:"id"`
 	Name              string `json:"name"`
@@ -111,7 +153,43 @@ func (c *Client) Login(email, password string) error {
 		return fmt.Errorf("failed to decode login response: %w", err)
 	}
 
+	if authResp.MFARequired {
+		c.session.MFAToken = authResp.MFAToken
+		fmt.Println("Two-factor authentication is enabled. Enter 'mfa <code>' with a code from your authenticator app or a recovery code.")
+		return nil
+	}
+	return c.finishLogin(authResp)
+}
+
+// LoginMFA completes a login that was paused for the second factor.
+func (c *Client) LoginMFA(code string) error {
+	if c.session.MFAToken == "" {
+		return fmt.Errorf("no pending login, use 'login' first")
+	}
+
+	resp, err := c.sendRequest("POST", "/login/mfa", LoginMFARequest{MFAToken: c.session.MFAToken, Code: code}, false)
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("login failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var authResp AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		return fmt.Errorf("failed to decode login response: %w", err)
+	}
+
+	c.session.MFAToken = ""
+	return c.finishLogin(authResp)
+}
+
+func (c *Client) finishLogin(authResp AuthResponse) error {
 	c.session.Token = authResp.Token
+	c.session.RefreshToken = authResp.RefreshToken
 	c.session.IsLoggedIn = true
 
 	// Get user info after login
@@ -120,6 +198,115 @@ func (c *Client) Login(email, password string) error {
 	}
 
 	fmt.Println("Login successful! You are now logged in.")
+	if authResp.MFASetupRequired {
+		fmt.Println("Your role requires two-factor authentication. Until you set it up with 'mfa-setup' you have user permissions only.")
+	}
+	return nil
+}
+
+func (c *Client) SetupMFA() error {
+	resp, err := c.sendRequest("POST", "/me/mfa/totp/setup", nil, true)
+	if err != nil {
+		return fmt.Errorf("mfa setup failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mfa setup failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var setup struct {
+		Secret string `json:"secret"`
+		URI    string `json:"otpauth_uri"`
+	}
+	if err := json.Unmarshal(body, &setup); err != nil {
+		return fmt.Errorf("failed to decode mfa setup response: %w", err)
+	}
+
+	fmt.Printf("Add this key to your authenticator app: %s\n", setup.Secret)
+	fmt.Printf("Or use this URI: %s\n", setup.URI)
+	fmt.Println("Then confirm with 'mfa-enable <code>'.")
+	return nil
+}
+
+// EnableMFA turns on two-factor authentication and refreshes the tokens so
+// that a role requiring it takes effect right away.
+func (c *Client) EnableMFA(code string) error {
+	resp, err := c.sendRequest("POST", "/me/mfa/totp/enable", MFACodeRequest{Code: code}, true)
+	if err != nil {
+		return fmt.Errorf("mfa enable failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mfa enable failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var codes struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if err := json.Unmarshal(body, &codes); err != nil {
+		return fmt.Errorf("failed to decode mfa enable response: %w", err)
+	}
+
+	fmt.Println("Two-factor authentication enabled. Store these recovery codes, they are shown only once:")
+	for _, code := range codes.RecoveryCodes {
+		fmt.Printf("  %s\n", code)
+	}
+
+	if err := c.refresh(); err != nil {
+		return err
+	}
+	return c.GetMe()
+}
+
+func (c *Client) VerifyEmail(token string) error {
+	resp, err := c.sendRequest("POST", "/email/verify", VerifyEmailRequest{Token: token}, false)
+	if err != nil {
+		return fmt.Errorf("email verification failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("email verification failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Println("Email confirmed! You can now login.")
+	return nil
+}
+
+func (c *Client) ForgotPassword(email string) error {
+	resp, err := c.sendRequest("POST", "/password/forgot", EmailRequest{Email: email}, false)
+	if err != nil {
+		return fmt.Errorf("password reset request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("password reset request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Println("If the address is registered, a reset token has been sent to it.")
+	return nil
+}
+
+func (c *Client) ResetPassword(token, password string) error {
+	resp, err := c.sendRequest("POST", "/password/reset", ResetPasswordRequest{Token: token, Password: password}, false)
+	if err != nil {
+		return fmt.Errorf("password reset failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("password reset failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Println("Password changed. Please login with the new password.")
 	return nil
 }
 
@@ -142,9 +329,10 @@ func (c *Client) GetMe() error {
 	return nil
 }
 
-func (c *Client) CreateRentalRequest(equipmentID uint, startDate, endDate time.Time, comment string) error {
+func (c *Client) CreateRentalRequest(equipmentID uint, quantity int, startDate, endDate time.Time, comment string) error {
 	req := CreateRentalRequest{
 		EquipmentID: equipmentID,
+		Quantity:    quantity,
 		StartDate:   startDate,
 		EndDate:     endDate,
 		Comment:     comment,
@@ -170,6 +358,51 @@ func (c *Client) CreateRentalRequest(equipmentID uint, startDate, endDate time.T
 	return nil
 }
 
+func (c *Client) ListRentalRequests(status string) error {
+	path := "/rental_request"
+	if status != "" {
+		path += "?status=" + url.QueryEscape(status)
+	}
+
+	for {
+		resp, err := c.sendRequest("GET", path, nil, true)
+		if err != nil {
+			return fmt.Errorf("list rental requests failed: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return fmt.Errorf("list rental requests failed with status %d: %s", resp.StatusCode, string(body))
+		}
+
+		var page struct {
+			Items      []map[string]interface{} `json:"items"`
+			NextCursor string                   `json:"next_cursor"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		for _, request := range page.Items {
+			fmt.Printf("#%v equipment=%v quantity=%v %v – %v status=%v\n",
+				request["id"], request["equipment_id"], request["quantity"],
+				request["from_date"], request["to_date"], request["status"])
+		}
+
+		if page.NextCursor == "" {
+			return nil
+		}
+		next := "/rental_request?cursor=" + url.QueryEscape(page.NextCursor)
+		if status != "" {
+			next += "&status=" + url.QueryEscape(status)
+		}
+		path = next
+	}
+}
+
 func (c *Client) GetRequestStatus(requestID uint) error {
 	resp, err := c.sendRequest("GET", fmt.Sprintf("/rental_request/%d/status", requestID), nil, true)
 	if err != nil {
@@ -213,6 +446,35 @@ func (c *Client) GetRequestStatusAt(requestID uint, datetime time.Time) error {
 	return nil
 }
 
+func (c *Client) CheckOut(requestID uint, note string, assetIDs []uint) error {
+	return c.handover(fmt.Sprintf("/rental_request/%d/checkout", requestID), "check out", HandoverRequest{Note: note, AssetIDs: assetIDs})
+}
+
+func (c *Client) CheckIn(requestID uint, note string, damaged bool) error {
+	return c.handover(fmt.Sprintf("/rental_request/%d/return", requestID), "check in", HandoverRequest{Note: note, Damaged: damaged})
+}
+
+func (c *Client) handover(path, action string, req HandoverRequest) error {
+	resp, err := c.sendRequest("POST", path, req, true)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s failed with status %d: %s", action, resp.StatusCode, string(body))
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("Equipment handover recorded: %+v\n", result)
+	return nil
+}
+
 func (c *Client) CreateEquipment(name string, quantity int) error {
 	req := Equipment{
 		Name:              name,
@@ -303,13 +565,33 @@ func (c *Client) DeleteEquipment(id uint) error {
 	return nil
 }
 
+// sendRequest performs an API call. An authenticated call that fails with
+// 401 is retried once after refreshing the access token.
 func (c *Client) sendRequest(method, path string, body interface{}, auth bool) (*http.Response, error) {
-	var bodyReader io.Reader
+	var jsonData []byte
 	if body != nil {
-		jsonData, err := json.Marshal(body)
+		var err error
+		jsonData, err = json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
+	}
+
+	resp, err := c.do(method, path, jsonData, auth)
+	if err != nil || !auth || resp.StatusCode != http.StatusUnauthorized || c.session.RefreshToken == "" {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	return c.do(method, path, jsonData, auth)
+}
+
+func (c *Client) do(method, path string, jsonData []byte, auth bool) (*http.Response, error) {
+	var bodyReader io.Reader
+	if jsonData != nil {
 		bodyReader = bytes.NewReader(jsonData)
 	}
 
@@ -329,11 +611,43 @@ func (c *Client) sendRequest(method, path string, body interface{}, auth bool) (
 	return c.httpClient.Do(req)
 }
 
+// refresh exchanges the refresh token for a new token pair. Refresh tokens
+// are single-use, so the new one replaces the old one in the session.
+func (c *Client) refresh() error {
+	jsonData, err := json.Marshal(RefreshRequest{RefreshToken: c.session.RefreshToken})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	resp, err := c.do("POST", "/token/refresh", jsonData, false)
+	if err != nil {
+		return fmt.Errorf("token refresh failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// The session is gone on the server, a new login is required
+		c.session.Token = ""
+		c.session.RefreshToken = ""
+		c.session.IsLoggedIn = false
+		return fmt.Errorf("session expired, please login again")
+	}
+
+	var authResp AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		return fmt.Errorf("failed to decode refresh response: %w", err)
+	}
+	c.session.Token = authResp.Token
+	c.session.RefreshToken = authResp.RefreshToken
+	return nil
+}
+
 func printWelcome() {
 	fmt.Println("\n=== Welcome to the Rental Equipment Client ===")
 	fmt.Println("Type 'help' to see available commands")
 	fmt.Println("Type 'exit' to quit the application")
-	fmt.Println("===========================================\n")
+	fmt.Println("===========================================")
+	fmt.Println()
 }
 
 func printHelp(isLoggedIn bool) {
@@ -341,26 +655,50 @@ func printHelp(isLoggedIn bool) {
 	if !isLoggedIn {
 		fmt.Println("  register <name> <email> <password> - Register a new account")
 		fmt.Println("  login <email> <password>          - Login to your account")
+		fmt.Println("  mfa <code>                        - Finish login with a two-factor code")
+		fmt.Println("  verify-email <token>              - Confirm your email address")
+		fmt.Println("  forgot-password <email>           - Request a password reset token")
+		fmt.Println("  reset-password <token> <password> - Set a new password")
 	} else {
 		fmt.Println("  me                                - Show your profile information")
+		fmt.Println("  mfa-setup                         - Start two-factor authentication setup")
+		fmt.Println("  mfa-enable <code>                 - Confirm two-factor setup with a code")
+		fmt.Println("  logout                            - Logout from your account")
 		fmt.Println("\nEquipment Management:")
 		fmt.Println("  create-equipment <name> <quantity> - Create new equipment")
 		fmt.Println("  get-equipment <id>                - Get equipment details")
 		fmt.Println("  update-equipment <id> <name> <quantity> - Update equipment")
 		fmt.Println("  delete-equipment <id>             - Delete equipment")
 		fmt.Println("\nRental Requests:")
-		fmt.Println("  create-request <equipment_id> <start_date> <end_date> <comment> - Create a rental request")
+		fmt.Println("  create-request <equipment_id> <start_date> <end_date> <comment> [quantity] - Create a rental request")
+		fmt.Println("  my-requests [status]              - List your rental requests")
 		fmt.Println("  get-status <request_id>           - Get status of a rental request")
 		fmt.Println("  get-status-at <request_id> <datetime> - Get status of a rental request at specific time")
-		fmt.Println("  logout                            - Logout from your account")
+		fmt.Println("\nHandover (managers):")
+		fmt.Println("  checkout <request_id> [note] [asset_id,...] - Hand over equipment of an approved request")
+		fmt.Println("  checkin <request_id> [note] [damaged] - Take equipment back, optionally marking it damaged")
 	}
 	fmt.Println("  help                               - Show this help message")
 	fmt.Println("  exit                               - Exit the application")
 	fmt.Println()
 }
 
+// Logout ends the session on the server and clears local state even if
+// the server cannot be reached.
 func (c *Client) Logout() {
+	resp, err := c.sendRequest("POST", "/logout", nil, true)
+	if err != nil {
+		fmt.Printf("Warning: server logout failed: %v\n", err)
+	} else {
+		if resp.StatusCode != http.StatusNoContent {
+			body, _ := io.ReadAll(resp.Body)
+			fmt.Printf("Warning: server logout failed with status %d: %s\n", resp.StatusCode, string(body))
+		}
+		resp.Body.Close()
+	}
+
 	c.session.Token = ""
+	c.session.RefreshToken = ""
 	c.session.IsLoggedIn = false
 	c.session.UserInfo = make(map[string]interface{})
 	fmt.Println("Successfully logged out!")
@@ -440,8 +778,29 @@ func main() {
 			}
 			err = client.Register(args[1], args[2], args[3])
 			if err == nil {
-				fmt.Println("Registration successful! Please login to continue.")
+				fmt.Println("Check your email to confirm the address, then login to continue.")
+			}
+
+		case "verify-email":
+			if len(args) != 2 {
+				fmt.Println("Usage: verify-email <token>")
+				continue
+			}
+			err = client.VerifyEmail(args[1])
+
+		case "forgot-password":
+			if len(args) != 2 {
+				fmt.Println("Usage: forgot-password <email>")
+				continue
 			}
+			err = client.ForgotPassword(args[1])
+
+		case "reset-password":
+			if len(args) != 3 {
+				fmt.Println("Usage: reset-password <token> <new_password>")
+				continue
+			}
+			err = client.ResetPassword(args[1], args[2])
 
 		case "login":
 			if len(args) != 3 {
@@ -449,10 +808,38 @@ func main() {
 				continue
 			}
 			err = client.Login(args[1], args[2])
+			if err == nil && client.session.IsLoggedIn {
+				printHelp(true)
+			}
+
+		case "mfa":
+			if len(args) != 2 {
+				fmt.Println("Usage: mfa <code>")
+				continue
+			}
+			err = client.LoginMFA(args[1])
 			if err == nil {
 				printHelp(true)
 			}
 
+		case "mfa-setup":
+			if !client.session.IsLoggedIn {
+				fmt.Println("Please login first!")
+				continue
+			}
+			err = client.SetupMFA()
+
+		case "mfa-enable":
+			if !client.session.IsLoggedIn {
+				fmt.Println("Please login first!")
+				continue
+			}
+			if len(args) != 2 {
+				fmt.Println("Usage: mfa-enable <code>")
+				continue
+			}
+			err = client.EnableMFA(args[1])
+
 		case "logout":
 			if !client.session.IsLoggedIn {
 				fmt.Println("You are not logged in!")
@@ -530,9 +917,9 @@ func main() {
 				fmt.Println("Please login first!")
 				continue
 			}
-			if len(args) != 5 {
-				fmt.Println("Usage: create-request <equipment_id> <start_date> <end_date> <comment>")
-				fmt.Println("Example: create-request 1 \"2024-03-20T10:00:00Z\" \"2024-03-25T18:00:00Z\" \"Need for weekend\"")
+			if len(args) != 5 && len(args) != 6 {
+				fmt.Println("Usage: create-request <equipment_id> <start_date> <end_date> <comment> [quantity]")
+				fmt.Println("Example: create-request 1 \"2024-03-20T10:00:00Z\" \"2024-03-25T18:00:00Z\" \"Need for weekend\" 5")
 				continue
 			}
 			equipmentID := uint(0)
@@ -547,7 +934,29 @@ func main() {
 				fmt.Println("Invalid end date format. Use RFC3339 format (e.g., 2024-03-20T10:00:00Z)")
 				continue
 			}
-			err = client.CreateRentalRequest(equipmentID, startDate, endDate, args[4])
+			quantity := 1
+			if len(args) == 6 {
+				if _, err := fmt.Sscanf(args[5], "%d", &quantity); err != nil || quantity < 1 {
+					fmt.Println("Invalid quantity. Use a positive number")
+					continue
+				}
+			}
+			err = client.CreateRentalRequest(equipmentID, quantity, startDate, endDate, args[4])
+
+		case "my-requests":
+			if !client.session.IsLoggedIn {
+				fmt.Println("Please login first!")
+				continue
+			}
+			if len(args) > 2 {
+				fmt.Println("Usage: my-requests [status]")
+				continue
+			}
+			status := ""
+			if len(args) == 2 {
+				status = args[1]
+			}
+			err = client.ListRentalRequests(status)
 
 		case "get-status":
 			if !client.session.IsLoggedIn {
@@ -580,6 +989,57 @@ func main() {
 			}
 			err = client.GetRequestStatusAt(requestID, datetime)
 
+		case "checkout":
+			if !client.session.IsLoggedIn {
+				fmt.Println("Please login first!")
+				continue
+			}
+			if len(args) < 2 || len(args) > 4 {
+				fmt.Println("Usage: checkout <request_id> [note] [asset_id,...]")
+				fmt.Println("Example: checkout 7 \"Charged, with case\" 12,13")
+				continue
+			}
+			requestID := uint(0)
+			fmt.Sscanf(args[1], "%d", &requestID)
+			note := ""
+			if len(args) >= 3 {
+				note = args[2]
+			}
+			var assetIDs []uint
+			if len(args) == 4 {
+				for _, part := range strings.Split(args[3], ",") {
+					assetID := uint(0)
+					if _, err := fmt.Sscanf(part, "%d", &assetID); err != nil {
+						assetIDs = nil
+						break
+					}
+					assetIDs = append(assetIDs, assetID)
+				}
+				if assetIDs == nil {
+					fmt.Println("Invalid asset ids. Use a comma-separated list, e.g. 12,13")
+					continue
+				}
+			}
+			err = client.CheckOut(requestID, note, assetIDs)
+
+		case "checkin":
+			if !client.session.IsLoggedIn {
+				fmt.Println("Please login first!")
+				continue
+			}
+			if len(args) < 2 || len(args) > 4 || (len(args) == 4 && args[3] != "damaged") {
+				fmt.Println("Usage: checkin <request_id> [note] [damaged]")
+				fmt.Println("Example: checkin 7 \"Scratch on the lid\" damaged")
+				continue
+			}
+			requestID := uint(0)
+			fmt.Sscanf(args[1], "%d", &requestID)
+			note := ""
+			if len(args) >= 3 {
+				note = args[2]
+			}
+			err = client.CheckIn(requestID, note, len(args) == 4)
+
 		default:
 			fmt.Printf("Unknown command: %s\nType 'help' to see available commands\n", command)
 			continue
@@ -3,27 +3,26 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
+	"ticketprocessing/internal/availability"
 	"ticketprocessing/internal/config"
 	"ticketprocessing/internal/db"
+	"ticketprocessing/internal/lifecycle"
+	"ticketprocessing/internal/messaging"
 	"ticketprocessing/internal/models"
 	"ticketprocessing/internal/repository"
+	"ticketprocessing/internal/rules"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
 )
 
-type rentalRequestMessage struct {
-	RequestID   uint   `json:"request_id"`
-	UserID      uint   `json:"user_id"`
-	EquipmentID uint   `json:"equipment_id"`
-	FromDate    string `json:"from_date"`
-	ToDate      string `json:"to_date"`
-}
-
 func main() {
 	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
 
@@ -33,23 +32,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	db, err := db.InitPostgres(&cfg.Postgres)
-	if err != nil {
-		log.Error("failed to init postgres", slog.String("error", err.Error()))
-		os.Exit(1)
-	}
-
-	rentalRequestRepo := repository.NewRentalRequestRepository(db)
-	statusLogRepo := repository.NewRequestStatusLogRepository(db)
-
-	url := fmt.Sprintf("amqp://%s:%s@%s:%d/",
-		cfg.RabbitMQ.User,
-		cfg.RabbitMQ.Password,
-		cfg.RabbitMQ.Host,
-		cfg.RabbitMQ.Port,
-	)
-
-	conn, err := amqp.Dial(url)
+	conn, err := messaging.Dial(&cfg.RabbitMQ)
 	if err != nil {
 		log.Error("failed to connect to RabbitMQ", slog.String("error", err.Error()))
 		os.Exit(1)
@@ -63,19 +46,60 @@ func main() {
 	}
 	defer ch.Close()
 
-	q, err := ch.QueueDeclare(
-		cfg.RabbitMQ.Queue,
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+	if err := messaging.DeclareTopology(ch, &cfg.RabbitMQ); err != nil {
+		log.Error("failed to declare topology", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	// Повторы и перенос в DLQ подтверждают исходное сообщение только после
+	// подтверждения публикации его копии
+	if err := ch.Confirm(false); err != nil {
+		log.Error("failed to enable publisher confirms", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	ctx, done := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	defer done()
+
+	// Административные команды для работы с DLQ: worker dlq <command> ...
+	if len(os.Args) > 1 && os.Args[1] == "dlq" {
+		if err := runDLQCommand(ctx, ch, &cfg.RabbitMQ, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	db, err := db.InitPostgres(&cfg.Postgres)
 	if err != nil {
-		log.Error("failed to declare queue", slog.String("error", err.Error()))
+		log.Error("failed to init postgres", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
 
+	rentalRequestRepo := repository.NewRentalRequestRepository(db)
+	statusLogRepo := repository.NewRequestStatusLogRepository(db)
+	equipmentRepo := repository.NewEquipmentRepository(db)
+	rentalOrderRepo := repository.NewRentalOrderRepository(db)
+
+	transactor := repository.NewTransactor(db)
+
+	pipeline, err := rules.FromConfig(&cfg.Rules, rentalRequestRepo, availability.NewChecker(rentalRequestRepo, equipmentRepo))
+	if err != nil {
+		log.Error("failed to configure approval rules", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	p := &processor{
+		transactor:        transactor,
+		rentalRequestRepo: rentalRequestRepo,
+		rentalOrderRepo:   rentalOrderRepo,
+		lifecycle:         lifecycle.NewMachine(transactor, rentalRequestRepo, statusLogRepo, rentalOrderRepo),
+		rules:             pipeline,
+		retrier:           messaging.NewRetrier(ch, &cfg.RabbitMQ),
+		policy:            cfg.Approval.Policy,
+		log:               log,
+	}
+
 	err = ch.Qos(
 		1,
 		0,
@@ -87,7 +111,7 @@ func main() {
 	}
 
 	msgs, err := ch.Consume(
-		q.Name,
+		cfg.RabbitMQ.Queue,
 		"",
 		false,
 		false,
@@ -100,11 +124,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	ctx, done := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
-
 	go func() {
 		for msg := range msgs {
-			processMessage(ctx, msg, rentalRequestRepo, statusLogRepo, log)
+			p.processMessage(ctx, msg)
 		}
 		done()
 	}()
@@ -124,90 +146,376 @@ func main() {
 	log.Info("Worker stopped")
 }
 
-func processMessage(
-	ctx context.Context,
-	msg amqp.Delivery,
-	rentalRequestRepo repository.RentalRequestRepository,
-	statusLogRepo repository.RequestStatusLogRepository,
-	log *slog.Logger,
-) {
+type processor struct {
+	transactor        repository.Transactor
+	rentalRequestRepo repository.RentalRequestRepository
+	rentalOrderRepo   repository.RentalOrderRepository
+	lifecycle         *lifecycle.Machine
+	rules             *rules.Pipeline
+	retrier           *messaging.Retrier
+	policy            string
+	log               *slog.Logger
+}
+
+var (
+	errAlreadyProcessed = errors.New("request already processed")
+	errMalformedMessage = errors.New("malformed message")
+)
+
+// decide прогоняет заявку через правила и применяет политику одобрения из
+// конфига. Вердикты всех правил попадают в комментарий журнала статусов.
+func (p *processor) decide(ctx context.Context, tx *gorm.DB, request *models.RentalRequest) (lifecycle.Status, string, error) {
+	result, err := p.rules.Evaluate(ctx, tx, request)
+	if err != nil {
+		return "", "", err
+	}
+
+	status, reason := p.verdict(result.Passed())
+	return status, reason + ": " + result.Summary(), nil
+}
+
+// verdict применяет политику одобрения к итогу проверки правил.
+func (p *processor) verdict(passed bool) (lifecycle.Status, string) {
+	switch {
+	case p.policy == config.ApprovalManual:
+		return lifecycle.AwaitingReview, "Awaiting manager review"
+	case passed:
+		return lifecycle.Approved, "Approved"
+	case p.policy == config.ApprovalReview:
+		return lifecycle.AwaitingReview, "Failed automatic checks, awaiting manager review"
+	default:
+		return lifecycle.Rejected, "Rejected"
+	}
+}
+
+func (p *processor) processMessage(ctx context.Context, msg amqp.Delivery) {
+	log := p.log
+
 	defer func() {
 		if err := recover(); err != nil {
 			log.Error("panic recovered while processing message",
 				slog.Any("error", err),
 				slog.String("message_id", msg.MessageId),
 			)
-			msg.Nack(false, false)
+			p.deadLetter(ctx, msg, fmt.Errorf("panic: %v", err))
 		}
 	}()
 
-	var requestMsg rentalRequestMessage
+	var requestMsg messaging.RentalRequestMessage
 	if err := json.Unmarshal(msg.Body, &requestMsg); err != nil {
 		log.Error("failed to unmarshal message",
 			slog.String("error", err.Error()),
 			slog.String("body", string(msg.Body)),
 		)
-		msg.Nack(false, false)
+		p.deadLetter(ctx, msg, err)
 		return
 	}
 
 	log.Info("processing rental request",
+		slog.String("event", requestMsg.Event),
 		slog.Uint64("request_id", uint64(requestMsg.RequestID)),
+		slog.Uint64("order_id", uint64(requestMsg.OrderID)),
 		slog.Uint64("user_id", uint64(requestMsg.UserID)),
 		slog.Uint64("equipment_id", uint64(requestMsg.EquipmentID)),
+		slog.Int("quantity", requestMsg.Quantity),
 	)
 
-	request, err := rentalRequestRepo.GetRentalRequestByID(requestMsg.RequestID)
-	if err != nil {
-		log.Error("failed to get rental request",
-			slog.String("error", err.Error()),
-			slog.Uint64("request_id", uint64(requestMsg.RequestID)),
-		)
-		msg.Nack(false, true)
-		return
+	var (
+		newStatus lifecycle.Status
+		err       error
+	)
+	switch requestMsg.Event {
+	case messaging.EventRentalRequestCancelled, messaging.EventRentalOrderCancelled:
+		// Отменённая заявка уже освободила оборудование, оценивать нечего
+		newStatus = lifecycle.Cancelled
+	case messaging.EventRentalRequestExtended:
+		newStatus, err = p.evaluateExtension(ctx, requestMsg)
+	case messaging.EventRentalOrderCreated, messaging.EventRentalOrderModified:
+		newStatus, err = p.evaluateOrder(ctx, requestMsg)
+	case messaging.EventRentalOrderExtended:
+		newStatus, err = p.evaluateOrderExtension(ctx, requestMsg)
+	default:
+		// created, modified и сообщения без события
+		newStatus, err = p.evaluatePending(ctx, requestMsg)
 	}
-
-	if request.Status != "pending" {
+	switch {
+	case errors.Is(err, errAlreadyProcessed):
 		log.Info("request already processed",
 			slog.Uint64("request_id", uint64(requestMsg.RequestID)),
-			slog.String("status", request.Status),
+			slog.Uint64("order_id", uint64(requestMsg.OrderID)),
+			slog.String("status", string(newStatus)),
 		)
 		msg.Ack(false)
 		return
-	}
-
-	// Здесь можно добавить дополнительную бизнес-логику обработки заявки
-	// Например, проверка доступности оборудования, проверка кредитного рейтинга пользователя и т.д.
-
-	// В данном примере просто меняем статус на "approved"
-	request.Status = "approved"
-	if err := rentalRequestRepo.UpdateRentalRequest(request); err != nil {
-		log.Error("failed to update rental request",
+	case errors.Is(err, errMalformedMessage):
+		log.Error("malformed rental request message",
 			slog.String("error", err.Error()),
-			slog.Uint64("request_id", uint64(requestMsg.RequestID)),
+			slog.String("body", string(msg.Body)),
 		)
-		msg.Nack(false, true)
+		p.deadLetter(ctx, msg, err)
 		return
-	}
-
-	statusLog := &models.RequestStatusLog{
-		RequestID: request.ID,
-		Status:    "approved",
-		Timestamp: time.Now(),
-		Comment:   "Request approved by worker",
-	}
-
-	if err := statusLogRepo.CreateRequestStatusLog(statusLog); err != nil {
-		log.Error("failed to create status log",
+	case err != nil:
+		log.Error("failed to process rental request",
 			slog.String("error", err.Error()),
 			slog.Uint64("request_id", uint64(requestMsg.RequestID)),
+			slog.Uint64("order_id", uint64(requestMsg.OrderID)),
+			slog.Int("attempt", messaging.Attempts(msg.Headers)+1),
 		)
+		p.retry(ctx, msg, err)
+		return
 	}
 
 	log.Info("rental request processed successfully",
 		slog.Uint64("request_id", uint64(requestMsg.RequestID)),
-		slog.String("new_status", "approved"),
+		slog.Uint64("order_id", uint64(requestMsg.OrderID)),
+		slog.String("new_status", string(newStatus)),
 	)
 
 	msg.Ack(false)
 }
+
+// evaluatePending принимает решение по новой или изменённой заявке.
+func (p *processor) evaluatePending(ctx context.Context, requestMsg messaging.RentalRequestMessage) (lifecycle.Status, error) {
+	var newStatus lifecycle.Status
+	err := p.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		request, err := p.rentalRequestRepo.WithTx(tx).GetRentalRequestByIDForUpdate(ctx, requestMsg.RequestID)
+		if err != nil {
+			return err
+		}
+
+		if lifecycle.Status(request.Status) != lifecycle.Pending {
+			newStatus = lifecycle.Status(request.Status)
+			return errAlreadyProcessed
+		}
+
+		var comment string
+		newStatus, comment, err = p.decide(ctx, tx, request)
+		if err != nil {
+			return err
+		}
+
+		return p.lifecycle.TransitionTx(ctx, tx, request, newStatus, lifecycle.Change{Comment: comment})
+	})
+	return newStatus, err
+}
+
+// evaluateOrder оценивает все строки заказа в одной транзакции. Строки
+// блокируются в порядке оборудования, затем заказ; правило доступности
+// резервирует оборудование по мере проверки, поэтому параллельные заказы не
+// взаимоблокируются. Итоговый статус получают все строки сразу: если хотя бы
+// одна не прошла проверку, не одобряется ни одна. Статус заказа пересчитывает
+// lifecycle.Machine.
+func (p *processor) evaluateOrder(ctx context.Context, requestMsg messaging.RentalRequestMessage) (lifecycle.Status, error) {
+	if requestMsg.OrderID == 0 {
+		return "", fmt.Errorf("%w: missing order_id", errMalformedMessage)
+	}
+
+	var newStatus lifecycle.Status
+	err := p.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		lines, err := p.rentalRequestRepo.WithTx(tx).ListByOrderIDForUpdate(ctx, requestMsg.OrderID)
+		if err != nil {
+			return err
+		}
+		order, err := p.rentalOrderRepo.WithTx(tx).GetOrderByIDForUpdate(ctx, requestMsg.OrderID)
+		if err != nil {
+			return err
+		}
+		if lifecycle.Status(order.Status) != lifecycle.Pending {
+			newStatus = lifecycle.Status(order.Status)
+			return errAlreadyProcessed
+		}
+
+		var pending []*models.RentalRequest
+		for i := range lines {
+			if lifecycle.Status(lines[i].Status) == lifecycle.Pending {
+				pending = append(pending, &lines[i])
+			}
+		}
+		if len(pending) == 0 {
+			newStatus = lifecycle.OrderStatus(lines)
+			return errAlreadyProcessed
+		}
+
+		results := make([]rules.Result, len(pending))
+		passed := true
+		for i, line := range pending {
+			if results[i], err = p.rules.Evaluate(ctx, tx, line); err != nil {
+				return err
+			}
+			passed = passed && results[i].Passed()
+		}
+
+		var reason string
+		newStatus, reason = p.verdict(passed)
+		for i, line := range pending {
+			comment := fmt.Sprintf("%s with order #%d: %s", reason, order.ID, results[i].Summary())
+			if !passed && results[i].Passed() {
+				comment = fmt.Sprintf("%s with order #%d because other lines failed: %s", reason, order.ID, results[i].Summary())
+			}
+			if err := p.lifecycle.TransitionTx(ctx, tx, line, newStatus, lifecycle.Change{Comment: comment}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return newStatus, err
+}
+
+// evaluateExtension заново проверяет правила для продлённой заявки и
+// применяет политику одобрения: при отказе возвращает прежнюю дату
+// окончания, а продление, требующее решения менеджера, оставляет
+// зарезервированным и отмечает прежнюю дату в PreviousToDate.
+func (p *processor) evaluateExtension(ctx context.Context, requestMsg messaging.RentalRequestMessage) (lifecycle.Status, error) {
+	toDate, err := time.Parse(time.RFC3339, requestMsg.ToDate)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid to_date: %v", errMalformedMessage, err)
+	}
+	previousToDate, err := time.Parse(time.RFC3339, requestMsg.PreviousToDate)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid previous_to_date: %v", errMalformedMessage, err)
+	}
+
+	var status lifecycle.Status
+	err = p.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		request, err := p.rentalRequestRepo.WithTx(tx).GetRentalRequestByIDForUpdate(ctx, requestMsg.RequestID)
+		if err != nil {
+			return err
+		}
+		status = lifecycle.Status(request.Status)
+
+		// Заявка могла измениться после продления, тогда сообщение устарело.
+		// Postgres хранит время с точностью до микросекунды.
+		if (status != lifecycle.Approved && status != lifecycle.CheckedOut) ||
+			!request.ToDate.Truncate(time.Microsecond).Equal(toDate.Truncate(time.Microsecond)) ||
+			request.PreviousToDate != nil {
+			return errAlreadyProcessed
+		}
+
+		result, err := p.rules.Evaluate(ctx, tx, request)
+		if err != nil {
+			return err
+		}
+
+		verdict, reason := p.verdict(result.Passed())
+		comment := applyExtensionVerdict(request, verdict, reason, result.Summary(), previousToDate)
+		return p.lifecycle.AmendTx(ctx, tx, request, lifecycle.Change{Comment: comment})
+	})
+	return status, err
+}
+
+// evaluateOrderExtension проверяет продление всех строк заказа и, как
+// evaluateOrder, применяет одно решение ко всем строкам.
+func (p *processor) evaluateOrderExtension(ctx context.Context, requestMsg messaging.RentalRequestMessage) (lifecycle.Status, error) {
+	if requestMsg.OrderID == 0 {
+		return "", fmt.Errorf("%w: missing order_id", errMalformedMessage)
+	}
+	toDate, err := time.Parse(time.RFC3339, requestMsg.ToDate)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid to_date: %v", errMalformedMessage, err)
+	}
+	previousToDate, err := time.Parse(time.RFC3339, requestMsg.PreviousToDate)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid previous_to_date: %v", errMalformedMessage, err)
+	}
+
+	var status lifecycle.Status
+	err = p.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		lines, err := p.rentalRequestRepo.WithTx(tx).ListByOrderIDForUpdate(ctx, requestMsg.OrderID)
+		if err != nil {
+			return err
+		}
+		order, err := p.rentalOrderRepo.WithTx(tx).GetOrderByIDForUpdate(ctx, requestMsg.OrderID)
+		if err != nil {
+			return err
+		}
+		status = lifecycle.Status(order.Status)
+
+		// Если хоть одна строка изменилась после продления, сообщение устарело
+		var extended []*models.RentalRequest
+		for i := range lines {
+			line := &lines[i]
+			lineStatus := lifecycle.Status(line.Status)
+			if lifecycle.IsTerminal(lineStatus) {
+				continue
+			}
+			if (lineStatus != lifecycle.Approved && lineStatus != lifecycle.CheckedOut) ||
+				!line.ToDate.Truncate(time.Microsecond).Equal(toDate.Truncate(time.Microsecond)) ||
+				line.PreviousToDate != nil {
+				return errAlreadyProcessed
+			}
+			extended = append(extended, line)
+		}
+		if len(extended) == 0 {
+			return errAlreadyProcessed
+		}
+
+		results := make([]rules.Result, len(extended))
+		passed := true
+		for i, line := range extended {
+			if results[i], err = p.rules.Evaluate(ctx, tx, line); err != nil {
+				return err
+			}
+			passed = passed && results[i].Passed()
+		}
+
+		verdict, reason := p.verdict(passed)
+		for i, line := range extended {
+			summary := fmt.Sprintf("with order #%d: %s", order.ID, results[i].Summary())
+			comment := applyExtensionVerdict(line, verdict, reason, summary, previousToDate)
+			if err := p.lifecycle.AmendTx(ctx, tx, line, lifecycle.Change{Comment: comment}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return status, err
+}
+
+// applyExtensionVerdict применяет решение по продлению к заявке: при отказе
+// возвращает прежнюю дату окончания, а продление, требующее решения
+// менеджера, отмечает прежней датой в PreviousToDate. Возвращает комментарий
+// для журнала.
+func applyExtensionVerdict(request *models.RentalRequest, verdict lifecycle.Status, reason, summary string, previousToDate time.Time) string {
+	switch verdict {
+	case lifecycle.Rejected:
+		request.ToDate = previousToDate
+		return "Extension rejected, end date restored to " + previousToDate.Format(time.RFC3339) + ": " + summary
+	case lifecycle.AwaitingReview:
+		request.PreviousToDate = &previousToDate
+	}
+	return "Extension " + strings.ToLower(reason) + ": " + summary
+}
+
+// retry откладывает повторную обработку сообщения через очередь задержки.
+// Если переопубликовать сообщение не удалось, оно возвращается в очередь.
+func (p *processor) retry(ctx context.Context, msg amqp.Delivery, cause error) {
+	deadLettered, err := p.retrier.Retry(ctx, msg, cause)
+	if err != nil {
+		p.log.Error("failed to schedule retry", slog.String("error", err.Error()))
+		msg.Nack(false, true)
+		return
+	}
+	if deadLettered {
+		p.log.Warn("message moved to dead-letter queue",
+			slog.String("message_id", msg.MessageId),
+			slog.String("reason", cause.Error()),
+		)
+	}
+	msg.Ack(false)
+}
+
+// deadLetter переносит сообщение в DLQ без повторных попыток.
+func (p *processor) deadLetter(ctx context.Context, msg amqp.Delivery, cause error) {
+	if err := p.retrier.DeadLetter(ctx, msg, cause); err != nil {
+		p.log.Error("failed to dead-letter message", slog.String("error", err.Error()))
+		// Без dead-letter политики брокер отбросил бы отклонённое сообщение,
+		// поэтому оно возвращается в очередь
+		msg.Nack(false, true)
+		return
+	}
+	p.log.Warn("message moved to dead-letter queue",
+		slog.String("message_id", msg.MessageId),
+		slog.String("reason", cause.Error()),
+	)
+	msg.Ack(false)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ServiceAccountResponse — сервисная учётная запись без служебных полей пользователя.
+type ServiceAccountResponse struct {
+	ID   uint        `json:"id"`
+	Name string      `json:"name"`
+	Role models.Role `json:"role"`
+}
+
+func newServiceAccountResponse(user *models.User) ServiceAccountResponse {
+	return ServiceAccountResponse{ID: user.ID, Name: user.Name, Role: user.Role}
+}
+
+type APIKeyHandler struct {
+	service service.APIKeyService
+}
+
+func NewAPIKeyHandler(service service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+// RegisterRoutes регистрирует управление сервисными учётными записями в группе администратора.
+func (h *APIKeyHandler) RegisterRoutes(admin *echo.Group) {
+	admin.POST("/service_accounts", h.CreateServiceAccount)
+	admin.GET("/service_accounts", h.ListServiceAccounts)
+	admin.POST("/service_accounts/:id/api_keys", h.CreateAPIKey)
+	admin.GET("/service_accounts/:id/api_keys", h.ListAPIKeys)
+	admin.DELETE("/api_keys/:id", h.RevokeAPIKey)
+}
+
+func (h *APIKeyHandler) CreateServiceAccount(c echo.Context) error {
+	var req service.CreateServiceAccountRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	user, err := h.service.CreateServiceAccount(c.Request().Context(), req)
+	if err != nil {
+		return apiKeyError(err)
+	}
+	return c.JSON(http.StatusCreated, newServiceAccountResponse(user))
+}
+
+func (h *APIKeyHandler) ListServiceAccounts(c echo.Context) error {
+	users, err := h.service.ListServiceAccounts(c.Request().Context())
+	if err != nil {
+		return apiKeyError(err)
+	}
+	accounts := make([]ServiceAccountResponse, len(users))
+	for i := range users {
+		accounts[i] = newServiceAccountResponse(&users[i])
+	}
+	return c.JSON(http.StatusOK, accounts)
+}
+
+// CreateAPIKey возвращает ключ целиком. Повторно его получить нельзя.
+func (h *APIKeyHandler) CreateAPIKey(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+
+	var req service.CreateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	key, err := h.service.CreateAPIKey(c.Request().Context(), actor, uint(id), req)
+	if err != nil {
+		return apiKeyError(err)
+	}
+	return c.JSON(http.StatusCreated, key)
+}
+
+func (h *APIKeyHandler) ListAPIKeys(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+
+	keys, err := h.service.ListAPIKeys(c.Request().Context(), uint(id))
+	if err != nil {
+		return apiKeyError(err)
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid api key id")
+	}
+
+	key, err := h.service.RevokeAPIKey(c.Request().Context(), uint(id))
+	if err != nil {
+		return apiKeyError(err)
+	}
+	return c.JSON(http.StatusOK, key)
+}
+
+func apiKeyError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrNameRequired), errors.Is(err, service.ErrInvalidRole),
+		errors.Is(err, service.ErrInvalidScope), errors.Is(err, service.ErrInvalidKeyLifetime):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrAPIKeyNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrNotServiceAccount):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
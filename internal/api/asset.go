@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AssetHandler struct {
+	service *service.AssetService
+}
+
+func NewAssetHandler(service *service.AssetService) *AssetHandler {
+	return &AssetHandler{
+		service: service,
+	}
+}
+
+// RegisterRoutes регистрирует маршруты в группах с AuthMiddleware.
+// Регистрирует единицы администратор, меняет их состояние менеджер.
+func (h *AssetHandler) RegisterRoutes(equipment, assets *echo.Group) {
+	equipment.GET("/:id/assets", h.ListByEquipment)
+	equipment.POST("/:id/assets", h.Create, RequireRole(models.RoleAdmin))
+	assets.GET("/:id", h.GetByID)
+	assets.PUT("/:id", h.Update, RequireRole(models.RoleManager))
+	assets.GET("/:id/history", h.History)
+}
+
+func (h *AssetHandler) Create(c echo.Context) error {
+	equipmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+
+	var asset models.Asset
+	if err := c.Bind(&asset); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid user context"})
+	}
+
+	if err := h.service.Create(c.Request().Context(), actor, uint(equipmentID), &asset); err != nil {
+		return assetError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, asset)
+}
+
+func (h *AssetHandler) ListByEquipment(c echo.Context) error {
+	equipmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+
+	assets, err := h.service.ListByEquipment(c.Request().Context(), uint(equipmentID))
+	if err != nil {
+		return assetError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, assets)
+}
+
+func (h *AssetHandler) GetByID(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+
+	asset, err := h.service.GetByID(c.Request().Context(), uint(id))
+	if err != nil {
+		return assetError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, asset)
+}
+
+func (h *AssetHandler) Update(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+
+	var req service.UpdateAssetRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid user context"})
+	}
+
+	asset, err := h.service.Update(c.Request().Context(), actor, uint(id), req)
+	if err != nil {
+		return assetError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, asset)
+}
+
+func (h *AssetHandler) History(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+
+	events, err := h.service.History(c.Request().Context(), uint(id))
+	if err != nil {
+		return assetError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, events)
+}
+
+func assetError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrAssetNotFound),
+		errors.Is(err, service.ErrEquipmentNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrAssetFieldsRequired),
+		errors.Is(err, service.ErrInvalidAssetStatus):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrDuplicateAsset),
+		errors.Is(err, service.ErrAssetInUse):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+type CategoryHandler struct {
+	service *service.CategoryService
+}
+
+func NewCategoryHandler(service *service.CategoryService) *CategoryHandler {
+	return &CategoryHandler{
+		service: service,
+	}
+}
+
+// RegisterRoutes регистрирует маршруты в группе с AuthMiddleware.
+// Изменять категории может только администратор.
+func (h *CategoryHandler) RegisterRoutes(categories *echo.Group) {
+	admin := RequireRole(models.RoleAdmin)
+	categories.GET("", h.List)
+	categories.POST("", h.Create, admin)
+	categories.GET("/:id", h.GetByID)
+	categories.PUT("/:id", h.Update, admin)
+	categories.DELETE("/:id", h.Delete, admin)
+}
+
+func (h *CategoryHandler) Create(c echo.Context) error {
+	var category models.Category
+	if err := c.Bind(&category); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.service.Create(c.Request().Context(), &category); err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, category)
+}
+
+func (h *CategoryHandler) List(c echo.Context) error {
+	categories, err := h.service.List(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, categories)
+}
+
+func (h *CategoryHandler) GetByID(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+
+	category, err := h.service.GetByID(c.Request().Context(), uint(id))
+	if err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, category)
+}
+
+func (h *CategoryHandler) Update(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+
+	var category models.Category
+	if err := c.Bind(&category); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	category.ID = uint(id)
+	if err := h.service.Update(c.Request().Context(), &category); err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, category)
+}
+
+func (h *CategoryHandler) Delete(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+
+	if err := h.service.Delete(c.Request().Context(), uint(id)); err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func categoryError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrCategoryNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrCategoryNameRequired),
+		errors.Is(err, service.ErrCategoryCycle),
+		errors.Is(err, service.ErrInvalidAttributeSchema):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrCategoryInUse):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
@@ -1,10 +1,15 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"ticketprocessing/internal/availability"
 	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/pagination"
 	"ticketprocessing/internal/service"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -19,12 +24,16 @@ func NewEquipmentHandler(service *service.EquipmentService) *EquipmentHandler {
 	}
 }
 
-func (h *EquipmentHandler) RegisterRoutes(e *echo.Echo) {
-	equipment := e.Group("/api/equipment")
-	equipment.POST("", h.Create)
+// RegisterRoutes регистрирует маршруты в группе с AuthMiddleware.
+// Изменять оборудование может только администратор.
+func (h *EquipmentHandler) RegisterRoutes(equipment *echo.Group) {
+	admin := RequireRole(models.RoleAdmin)
+	equipment.GET("", h.List)
+	equipment.POST("", h.Create, admin)
 	equipment.GET("/:id", h.GetByID)
-	equipment.PUT("/:id", h.Update)
-	equipment.DELETE("/:id", h.Delete)
+	equipment.PUT("/:id", h.Update, admin)
+	equipment.DELETE("/:id", h.Delete, admin)
+	equipment.GET("/:id/availability", h.GetAvailability)
 }
 
 func (h *EquipmentHandler) Create(c echo.Context) error {
@@ -34,12 +43,70 @@ func (h *EquipmentHandler) Create(c echo.Context) error {
 	}
 
 	if err := h.service.Create(c.Request().Context(), &equipment); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return equipmentError(c, err)
 	}
 
 	return c.JSON(http.StatusCreated, equipment)
 }
 
+// List отбирает оборудование по категории (вместе с подкатегориями), тегам,
+// свойствам, названию и свободным единицам на период:
+// ?q=canon&category=3&tag=4k&attr=lens_mount:EF&available_from=2025-06-01&available_to=2025-06-03&min_free=2
+// Сортировка sort=name|-name|id|-id|available_quantity|-available_quantity,
+// следующая страница запрашивается с cursor из next_cursor.
+func (h *EquipmentHandler) List(c echo.Context) error {
+	filter := service.EquipmentListFilter{Search: c.QueryParam("q")}
+
+	if value := c.QueryParam("category"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid category"})
+		}
+		categoryID := uint(id)
+		filter.CategoryID = &categoryID
+	}
+
+	query := c.QueryParams()
+	filter.Tags = query["tag"]
+	for _, attr := range query["attr"] {
+		key, value, ok := strings.Cut(attr, ":")
+		if !ok || key == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid attr, use key:value"})
+		}
+		if filter.Attributes == nil {
+			filter.Attributes = map[string]string{}
+		}
+		filter.Attributes[key] = value
+	}
+
+	var err error
+	if filter.AvailableFrom, err = optionalDateParam(c, "available_from"); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid available_from, use RFC3339 or YYYY-MM-DD"})
+	}
+	if filter.AvailableTo, err = optionalDateParam(c, "available_to"); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid available_to, use RFC3339 or YYYY-MM-DD"})
+	}
+	if value := c.QueryParam("min_free"); value != "" {
+		minFree, err := strconv.Atoi(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid min_free"})
+		}
+		filter.MinFree = minFree
+	}
+
+	page, err := pageRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	equipment, err := h.service.List(c.Request().Context(), filter, page)
+	if err != nil {
+		return equipmentError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, equipment)
+}
+
 func (h *EquipmentHandler) GetByID(c echo.Context) error {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -67,7 +134,7 @@ func (h *EquipmentHandler) Update(c echo.Context) error {
 
 	equipment.ID = uint(id)
 	if err := h.service.Update(c.Request().Context(), &equipment); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return equipmentError(c, err)
 	}
 
 	return c.JSON(http.StatusOK, equipment)
@@ -86,3 +153,74 @@ func (h *EquipmentHandler) Delete(c echo.Context) error {
 
 	return c.NoContent(http.StatusNoContent)
 }
+
+func (h *EquipmentHandler) GetAvailability(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+
+	from, err := parseDateParam(c.QueryParam("from"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid from, use RFC3339 or YYYY-MM-DD"})
+	}
+	to, err := parseDateParam(c.QueryParam("to"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid to, use RFC3339 or YYYY-MM-DD"})
+	}
+
+	granularity := availability.Granularity(c.QueryParam("granularity"))
+	if granularity == "" {
+		granularity = availability.Day
+	}
+
+	buckets, err := h.service.Availability(c.Request().Context(), uint(id), from, to, granularity)
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, buckets)
+	case errors.Is(err, service.ErrEquipmentNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "equipment not found"})
+	case errors.Is(err, service.ErrInvalidDateRange),
+		errors.Is(err, availability.ErrInvalidGranularity),
+		errors.Is(err, availability.ErrTooManyBuckets):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
+
+// equipmentError переводит ошибки проверки оборудования и параметров списка в ответы 400.
+func equipmentError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrCategoryNotFound),
+		errors.Is(err, service.ErrInvalidAttributes),
+		errors.Is(err, service.ErrInvalidDateRange),
+		errors.Is(err, service.ErrInvalidQuantity),
+		errors.Is(err, pagination.ErrInvalidSort),
+		errors.Is(err, pagination.ErrInvalidCursor):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, service.ErrEquipmentNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
+
+func optionalDateParam(c echo.Context, name string) (*time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := parseDateParam(value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"ticketprocessing/internal/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+type JWKSHandler struct {
+	keys *auth.KeySet
+}
+
+func NewJWKSHandler(keys *auth.KeySet) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// GetJWKS godoc
+// @Summary Публичные ключи проверки токенов
+// @Description Ключи в формате JWKS. Кроме текущего ключа содержит предыдущие, пока не истёк их grace-период
+// @Tags auth
+// @Produce json
+// @Success 200 {object} auth.JWKSet
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) GetJWKS(c echo.Context) error {
+	// Короткий кеш, чтобы новый ключ после ротации быстро доходил до клиентов
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, h.keys.JWKS())
+}
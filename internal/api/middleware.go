@@ -1,37 +1,77 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 	"ticketprocessing/internal/auth"
+	"ticketprocessing/internal/service"
 
 	"github.com/labstack/echo/v4"
 )
 
-func AuthMiddleware(jwtManager *auth.JWTManager, redisStore *auth.RedisTokenStore) echo.MiddlewareFunc {
+// AuthMiddleware пускает запросы с access-токеном в заголовке Authorization
+// или с ключом сервисной учётной записи в X-API-Key. Ключи принимаются только
+// маршрутами с непустым resource и только при наличии области действия
+// "<resource>:read" для чтения или "<resource>:write" для остальных методов.
+func AuthMiddleware(jwtManager *auth.JWTManager, redisStore *auth.RedisTokenStore, apiKeys service.APIKeyService, resource string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if key := c.Request().Header.Get("X-API-Key"); key != "" {
+				return authenticateAPIKey(c, next, apiKeys, resource, key)
+			}
+
 			header := c.Request().Header.Get("Authorization")
 			if header == "" || !strings.HasPrefix(header, "Bearer ") {
 				return echo.NewHTTPError(http.StatusUnauthorized, "missing token")
 			}
 
 			token := strings.TrimPrefix(header, "Bearer ")
-			claims, err := jwtManager.Parse(token)
+			claims, err := jwtManager.Parse(c.Request().Context(), token)
 			if err != nil {
 				return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
 			}
 
-			if _, err := redisStore.GetUserID(c.Request().Context(), token); err != nil {
+			// Токен действителен, пока жива его сессия
+			session, err := redisStore.GetSession(c.Request().Context(), claims.SessionID)
+			if err != nil || session.UserID != claims.UserID {
 				return echo.NewHTTPError(http.StatusUnauthorized, "token expired")
 			}
 
-			if err := redisStore.RefreshToken(c.Request().Context(), token); err != nil {
-				return echo.NewHTTPError(http.StatusInternalServerError, "failed to refresh token")
+			// Срок сессии не продлевается, для этого есть /token/refresh
+			if err := redisStore.TouchSession(c.Request().Context(), session); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to update session")
 			}
 
 			c.Set("user_id", claims.UserID)
+			c.Set("role", claims.Role)
+			c.Set("session_id", claims.SessionID)
 			return next(c)
 		}
 	}
 }
+
+func authenticateAPIKey(c echo.Context, next echo.HandlerFunc, apiKeys service.APIKeyService, resource, key string) error {
+	if resource == "" {
+		return echo.NewHTTPError(http.StatusForbidden, "api keys are not accepted for this endpoint")
+	}
+
+	principal, err := apiKeys.Authenticate(c.Request().Context(), key)
+	switch {
+	case errors.Is(err, service.ErrInvalidAPIKey):
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid api key")
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+
+	method := c.Request().Method
+	write := method != http.MethodGet && method != http.MethodHead
+	if !principal.Key.Allows(resource, write) {
+		return echo.NewHTTPError(http.StatusForbidden, "api key scope does not allow this request")
+	}
+
+	c.Set("user_id", principal.User.ID)
+	c.Set("role", principal.User.Role)
+	c.Set("api_key_id", principal.Key.ID)
+	return next(c)
+}
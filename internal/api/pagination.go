@@ -0,0 +1,25 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"ticketprocessing/internal/pagination"
+
+	"github.com/labstack/echo/v4"
+)
+
+// pageRequest читает параметры sort, cursor и limit.
+func pageRequest(c echo.Context) (pagination.Request, error) {
+	page := pagination.Request{
+		Sort:   c.QueryParam("sort"),
+		Cursor: c.QueryParam("cursor"),
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return page, errors.New("invalid limit")
+		}
+		page.Limit = limit
+	}
+	return page, nil
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"ticketprocessing/internal/config"
+	"ticketprocessing/internal/ratelimit"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimit ограничивает запросы группы маршрутов по правилу из конфига.
+// Группа без правила не ограничивается. Для лимитов по пользователю
+// middleware ставится после AuthMiddleware.
+func RateLimit(limiter *ratelimit.Limiter, cfg *config.RateLimitConfig, group string) echo.MiddlewareFunc {
+	rule, ok := cfg.Groups[group]
+	if !ok {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+	window := time.Duration(rule.WindowSeconds) * time.Second
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := group + ":ip:" + c.RealIP()
+			if userID, ok := c.Get("user_id").(uint); ok && rule.By == config.RateLimitByUser {
+				key = fmt.Sprintf("%s:user:%d", group, userID)
+			}
+
+			result, err := limiter.Allow(c.Request().Context(), key, rule.Limit, window)
+			if err != nil {
+				// Недоступность Redis не должна останавливать сервис
+				slog.Warn("rate limiter unavailable", slog.String("group", group), slog.String("error", err.Error()))
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set("X-RateLimit-Limit", strconv.Itoa(rule.Limit))
+			header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			if !result.Allowed {
+				setRetryAfter(c, result.RetryAfter)
+				return echo.NewHTTPError(http.StatusTooManyRequests, "too many requests")
+			}
+			return next(c)
+		}
+	}
+}
+
+// IPExtractor определяет адрес клиента для лимитов и сессий. Заголовкам
+// X-Forwarded-For и X-Real-IP клиент может записать что угодно, поэтому
+// X-Forwarded-For учитывается только от доверенных прокси, перечисленных в
+// trustedProxies.
+func IPExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	// По умолчанию echo доверяет всем частным сетям, здесь — только перечисленным
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range trustedProxies {
+		// Подсети уже проверены при загрузке конфига
+		_, network, _ := net.ParseCIDR(cidr)
+		options = append(options, echo.TrustIPRange(network))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// setRetryAfter задаёт Retry-After в целых секундах с округлением вверх.
+func setRetryAfter(c echo.Context, d time.Duration) {
+	seconds := max(int(math.Ceil(d.Seconds())), 1)
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+}
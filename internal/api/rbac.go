@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequireRole пропускает запрос, только если роль пользователя не ниже role.
+// Используется после AuthMiddleware.
+func RequireRole(role models.Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			current, ok := c.Get("role").(models.Role)
+			if !ok || !current.Includes(role) {
+				return echo.NewHTTPError(http.StatusForbidden, "insufficient permissions")
+			}
+			return next(c)
+		}
+	}
+}
+
+// actorFromContext возвращает пользователя, установленного AuthMiddleware.
+func actorFromContext(c echo.Context) (service.Actor, bool) {
+	userID, ok := c.Get("user_id").(uint)
+	if !ok {
+		return service.Actor{}, false
+	}
+	role, _ := c.Get("role").(models.Role)
+	return service.Actor{UserID: userID, Role: role}, true
+}
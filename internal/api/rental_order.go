@@ -0,0 +1,239 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"ticketprocessing/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RentalOrderHandler struct {
+	rentalOrderService service.RentalOrderService
+}
+
+func NewRentalOrderHandler(rentalOrderService service.RentalOrderService) *RentalOrderHandler {
+	return &RentalOrderHandler{
+		rentalOrderService: rentalOrderService,
+	}
+}
+
+// CreateRentalOrder godoc
+// @Summary Submit a multi-item rental order
+// @Description Create a rental request for every line with shared dates. The worker approves or rejects all lines together
+// @Tags rental-orders
+// @Accept json
+// @Produce json
+// @Param request body service.CreateRentalOrderRequest true "Rental Order"
+// @Success 201 {object} models.RentalOrder
+// @Failure 400 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_order [post]
+func (h *RentalOrderHandler) CreateRentalOrder(c echo.Context) error {
+	var req service.CreateRentalOrderRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	userID, ok := c.Get("user_id").(uint)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	order, err := h.rentalOrderService.CreateRentalOrder(c.Request().Context(), userID, req)
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusCreated, order)
+	case errors.Is(err, service.ErrEmptyOrder):
+		return echo.NewHTTPError(http.StatusBadRequest, "order must contain at least one line")
+	case errors.Is(err, service.ErrDuplicateOrderLine):
+		return echo.NewHTTPError(http.StatusBadRequest, "order contains the same equipment more than once")
+	case errors.Is(err, service.ErrInvalidDateRange):
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid date range")
+	case errors.Is(err, service.ErrInvalidQuantity):
+		return echo.NewHTTPError(http.StatusBadRequest, "quantity must be positive")
+	case errors.Is(err, service.ErrEquipmentNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrEquipmentUnavailable):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// GetRentalOrder godoc
+// @Summary Get a rental order
+// @Description Get a rental order with the current state of all its lines
+// @Tags rental-orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Rental Order ID"
+// @Success 200 {object} models.RentalOrder
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_order/{id} [get]
+func (h *RentalOrderHandler) GetRentalOrder(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid order id")
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	order, err := h.rentalOrderService.GetRentalOrder(c.Request().Context(), actor, uint(id))
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, order)
+	case errors.Is(err, service.ErrRentalOrderNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "rental order not found")
+	case errors.Is(err, service.ErrForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, "access denied")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// CancelRentalOrder godoc
+// @Summary Cancel a rental order
+// @Description Cancel all lines of a rental order before the equipment is checked out
+// @Tags rental-orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Rental Order ID"
+// @Param request body CancelRequest false "Cancellation reason"
+// @Success 200 {object} models.RentalOrder
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_order/{id}/cancel [post]
+func (h *RentalOrderHandler) CancelRentalOrder(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid order id")
+	}
+
+	var req CancelRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	order, err := h.rentalOrderService.CancelRentalOrder(c.Request().Context(), actor, uint(id), req.Comment)
+	if err != nil {
+		return orderChangeError(err)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// ModifyRentalOrder godoc
+// @Summary Change dates of a rental order
+// @Description Change dates of all lines of a rental order that is not approved yet; the order is evaluated again
+// @Tags rental-orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Rental Order ID"
+// @Param request body service.ModifyRentalOrderRequest true "New dates"
+// @Success 200 {object} models.RentalOrder
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_order/{id} [patch]
+func (h *RentalOrderHandler) ModifyRentalOrder(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid order id")
+	}
+
+	var req service.ModifyRentalOrderRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	order, err := h.rentalOrderService.ModifyRentalOrder(c.Request().Context(), actor, uint(id), req)
+	if err != nil {
+		return orderChangeError(err)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// ExtendRentalOrder godoc
+// @Summary Extend a rental order
+// @Description Move the end date of all lines of an approved or checked out rental order
+// @Tags rental-orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Rental Order ID"
+// @Param request body service.ExtendRentalOrderRequest true "New end date"
+// @Success 200 {object} models.RentalOrder
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_order/{id}/extend [post]
+func (h *RentalOrderHandler) ExtendRentalOrder(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid order id")
+	}
+
+	var req service.ExtendRentalOrderRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	order, err := h.rentalOrderService.ExtendRentalOrder(c.Request().Context(), actor, uint(id), req)
+	if err != nil {
+		return orderChangeError(err)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// orderChangeError переводит ошибки изменения заказа в HTTP-ответы.
+func orderChangeError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrRentalOrderNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "rental order not found")
+	case errors.Is(err, service.ErrForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, "access denied")
+	case errors.Is(err, service.ErrInvalidDateRange):
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid date range")
+	case errors.Is(err, service.ErrInvalidStatus):
+		return echo.NewHTTPError(http.StatusConflict, "operation is not allowed in the current order status")
+	case errors.Is(err, service.ErrEquipmentUnavailable):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
@@ -1,9 +1,15 @@
 package api
 
 import (
+	"context"
+	"encoding/csv"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/pagination"
 	"ticketprocessing/internal/service"
 	"time"
 
@@ -30,6 +36,7 @@ func NewRentalRequestHandler(rentalRequestService service.RentalRequestService)
 // @Success 201 {object} models.RentalRequest
 // @Failure 400 {object} echo.HTTPError
 // @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
 // @Failure 500 {object} echo.HTTPError
 // @Security BearerAuth
 // @Router /rental_request [post]
@@ -53,6 +60,148 @@ func (h *RentalRequestHandler) CreateRentalRequest(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusNotFound, "equipment not found")
 	case errors.Is(err, service.ErrInvalidDateRange):
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid date range")
+	case errors.Is(err, service.ErrInvalidQuantity):
+		return echo.NewHTTPError(http.StatusBadRequest, "quantity must be positive")
+	case errors.Is(err, service.ErrEquipmentUnavailable):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// ListRentalRequests godoc
+// @Summary List own rental requests
+// @Description List rental requests of the current user with filters, sorting and cursor pagination
+// @Tags rental-requests
+// @Produce json
+// @Param status query []string false "Statuses, repeated or comma-separated"
+// @Param equipment_id query int false "Equipment ID"
+// @Param from query string false "Overlaps period starting at (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Overlaps period ending at (RFC3339 or YYYY-MM-DD)"
+// @Param created_from query string false "Created at or after (RFC3339 or YYYY-MM-DD)"
+// @Param created_to query string false "Created before (RFC3339 or YYYY-MM-DD)"
+// @Param sort query string false "id, created_at, from_date or to_date; prefix with - for descending (default -created_at)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size, up to 100 (default 20)"
+// @Success 200 {object} pagination.Page[models.RentalRequest]
+// @Failure 400 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_request [get]
+func (h *RentalRequestHandler) ListRentalRequests(c echo.Context) error {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	filter, page, err := rentalRequestListParams(c)
+	if err != nil {
+		return err
+	}
+
+	requests, err := h.rentalRequestService.ListOwnRentalRequests(c.Request().Context(), actor, filter, page)
+	if err != nil {
+		return listError(err)
+	}
+	return c.JSON(http.StatusOK, requests)
+}
+
+// SearchRentalRequests godoc
+// @Summary Search all rental requests
+// @Description List rental requests of all users with filters, sorting and cursor pagination
+// @Tags admin
+// @Produce json
+// @Param user_id query int false "User ID"
+// @Param status query []string false "Statuses, repeated or comma-separated"
+// @Param equipment_id query int false "Equipment ID"
+// @Param from query string false "Overlaps period starting at (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Overlaps period ending at (RFC3339 or YYYY-MM-DD)"
+// @Param created_from query string false "Created at or after (RFC3339 or YYYY-MM-DD)"
+// @Param created_to query string false "Created before (RFC3339 or YYYY-MM-DD)"
+// @Param sort query string false "id, created_at, from_date or to_date; prefix with - for descending (default -created_at)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size, up to 100 (default 20)"
+// @Success 200 {object} pagination.Page[models.RentalRequest]
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /admin/rental_requests [get]
+func (h *RentalRequestHandler) SearchRentalRequests(c echo.Context) error {
+	filter, page, err := rentalRequestListParams(c)
+	if err != nil {
+		return err
+	}
+
+	if value := c.QueryParam("user_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid user_id")
+		}
+		userID := uint(id)
+		filter.UserID = &userID
+	}
+
+	requests, err := h.rentalRequestService.SearchRentalRequests(c.Request().Context(), filter, page)
+	if err != nil {
+		return listError(err)
+	}
+	return c.JSON(http.StatusOK, requests)
+}
+
+// rentalRequestListParams читает общие параметры списков заявок.
+func rentalRequestListParams(c echo.Context) (service.RentalRequestListFilter, pagination.Request, error) {
+	var filter service.RentalRequestListFilter
+
+	for _, value := range c.QueryParams()["status"] {
+		for _, status := range strings.Split(value, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				filter.Statuses = append(filter.Statuses, status)
+			}
+		}
+	}
+
+	if value := c.QueryParam("equipment_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return filter, pagination.Request{}, echo.NewHTTPError(http.StatusBadRequest, "invalid equipment_id")
+		}
+		equipmentID := uint(id)
+		filter.EquipmentID = &equipmentID
+	}
+
+	dates := []struct {
+		param string
+		dst   **time.Time
+	}{
+		{"from", &filter.From},
+		{"to", &filter.To},
+		{"created_from", &filter.CreatedFrom},
+		{"created_to", &filter.CreatedTo},
+	}
+	for _, date := range dates {
+		t, err := optionalDateParam(c, date.param)
+		if err != nil {
+			return filter, pagination.Request{}, echo.NewHTTPError(http.StatusBadRequest, "invalid "+date.param+", use RFC3339 or YYYY-MM-DD")
+		}
+		*date.dst = t
+	}
+
+	page, err := pageRequest(c)
+	if err != nil {
+		return filter, page, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return filter, page, nil
+}
+
+// listError переводит ошибки списков заявок в HTTP-ответы.
+func listError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidStatusFilter),
+		errors.Is(err, service.ErrInvalidDateRange),
+		errors.Is(err, pagination.ErrInvalidSort),
+		errors.Is(err, pagination.ErrInvalidCursor):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	default:
 		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
 	}
@@ -67,6 +216,7 @@ func (h *RentalRequestHandler) CreateRentalRequest(c echo.Context) error {
 // @Param id path int true "Rental Request ID"
 // @Success 200 {object} models.RequestStatusLog
 // @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
 // @Failure 404 {object} echo.HTTPError
 // @Failure 500 {object} echo.HTTPError
 // @Security BearerAuth
@@ -77,12 +227,19 @@ func (h *RentalRequestHandler) GetRequestStatus(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid request id")
 	}
 
-	status, err := h.rentalRequestService.GetRequestStatus(c.Request().Context(), uint(id))
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	status, err := h.rentalRequestService.GetRequestStatus(c.Request().Context(), actor, uint(id))
 	switch {
 	case err == nil:
 		return c.JSON(http.StatusOK, status)
 	case errors.Is(err, service.ErrRentalRequestNotFound):
 		return echo.NewHTTPError(http.StatusNotFound, "rental request not found")
+	case errors.Is(err, service.ErrForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, "access denied")
 	default:
 		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
 	}
@@ -98,6 +255,7 @@ func (h *RentalRequestHandler) GetRequestStatus(c echo.Context) error {
 // @Param datetime query string true "DateTime in RFC3339 format" format(date-time)
 // @Success 200 {object} models.RequestStatusLog
 // @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
 // @Failure 404 {object} echo.HTTPError
 // @Failure 500 {object} echo.HTTPError
 // @Security BearerAuth
@@ -118,15 +276,452 @@ func (h *RentalRequestHandler) GetRequestStatusAt(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid datetime format, use RFC3339")
 	}
 
-	status, err := h.rentalRequestService.GetRequestStatusAt(c.Request().Context(), uint(id), datetime)
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	status, err := h.rentalRequestService.GetRequestStatusAt(c.Request().Context(), actor, uint(id), datetime)
 	switch {
 	case err == nil:
 		return c.JSON(http.StatusOK, status)
 	case errors.Is(err, service.ErrRentalRequestNotFound):
 		return echo.NewHTTPError(http.StatusNotFound, "rental request not found")
+	case errors.Is(err, service.ErrForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, "access denied")
 	case errors.Is(err, service.ErrInvalidDateTime):
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid datetime")
 	default:
 		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
 	}
 }
+
+// GetRequestHistory godoc
+// @Summary Get status history of a rental request
+// @Description Get all status changes of a rental request ordered by time, with the acting user and time spent in each status
+// @Tags rental-requests
+// @Produce json
+// @Produce text/csv
+// @Param id path int true "Rental Request ID"
+// @Param format query string false "Response format: json (default) or csv"
+// @Success 200 {array} service.StatusHistoryEntry
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_request/{id}/history [get]
+func (h *RentalRequestHandler) GetRequestHistory(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request id")
+	}
+
+	format := c.QueryParam("format")
+	if format != "" && format != "json" && format != "csv" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid format, use json or csv")
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	history, err := h.rentalRequestService.GetRequestHistory(c.Request().Context(), actor, uint(id))
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrRentalRequestNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "rental request not found")
+	case errors.Is(err, service.ErrForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, "access denied")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+
+	if format != "csv" {
+		return c.JSON(http.StatusOK, history)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf("attachment; filename=rental_request_%d_history.csv", id))
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(c.Response())
+	w.Write([]string{"timestamp", "status", "actor_id", "actor", "duration_seconds", "current", "comment"})
+	for _, entry := range history {
+		actorID := ""
+		if entry.ActorID != nil {
+			actorID = strconv.FormatUint(uint64(*entry.ActorID), 10)
+		}
+		w.Write([]string{
+			entry.Timestamp.Format(time.RFC3339),
+			entry.Status,
+			actorID,
+			csvText(entry.Actor),
+			strconv.FormatInt(entry.DurationSeconds, 10),
+			strconv.FormatBool(entry.Current),
+			csvText(entry.Comment),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// csvText экранирует текст пользователя: ячейку, начинающуюся с =, +, -, @,
+// табуляции или возврата каретки, табличный редактор выполнил бы как формулу.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+type ReviewRequest struct {
+	Comment string `json:"comment" validate:"required"`
+}
+
+// GetReviewQueue godoc
+// @Summary List rental requests awaiting review
+// @Description Get rental requests and extensions (with previous_to_date set) that wait for a manager decision
+// @Tags rental-requests
+// @Produce json
+// @Success 200 {array} models.RentalRequest
+// @Failure 403 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_request/review-queue [get]
+func (h *RentalRequestHandler) GetReviewQueue(c echo.Context) error {
+	requests, err := h.rentalRequestService.GetReviewQueue(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+	return c.JSON(http.StatusOK, requests)
+}
+
+// ApproveRentalRequest godoc
+// @Summary Approve a rental request
+// @Description Approve a rental request or a pending extension awaiting review; the comment is stored in the status log
+// @Tags rental-requests
+// @Accept json
+// @Produce json
+// @Param id path int true "Rental Request ID"
+// @Param request body ReviewRequest true "Manager comment"
+// @Success 200 {object} models.RentalRequest
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_request/{id}/approve [post]
+func (h *RentalRequestHandler) ApproveRentalRequest(c echo.Context) error {
+	return h.review(c, h.rentalRequestService.ApproveRentalRequest)
+}
+
+// RejectRentalRequest godoc
+// @Summary Reject a rental request
+// @Description Reject a rental request or a pending extension awaiting review; a rejected extension restores the previous end date
+// @Tags rental-requests
+// @Accept json
+// @Produce json
+// @Param id path int true "Rental Request ID"
+// @Param request body ReviewRequest true "Manager comment"
+// @Success 200 {object} models.RentalRequest
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_request/{id}/reject [post]
+func (h *RentalRequestHandler) RejectRentalRequest(c echo.Context) error {
+	return h.review(c, h.rentalRequestService.RejectRentalRequest)
+}
+
+func (h *RentalRequestHandler) review(
+	c echo.Context,
+	decide func(ctx context.Context, actor service.Actor, requestID uint, comment string) (*models.RentalRequest, error),
+) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request id")
+	}
+
+	var req ReviewRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	request, err := decide(c.Request().Context(), actor, uint(id), req.Comment)
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, request)
+	case errors.Is(err, service.ErrCommentRequired):
+		return echo.NewHTTPError(http.StatusBadRequest, "comment is required")
+	case errors.Is(err, service.ErrRentalRequestNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "rental request not found")
+	case errors.Is(err, service.ErrInvalidStatus):
+		return echo.NewHTTPError(http.StatusConflict, "rental request is not awaiting review")
+	case errors.Is(err, service.ErrEquipmentUnavailable):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+type CancelRequest struct {
+	Comment string `json:"comment"`
+}
+
+// CancelRentalRequest godoc
+// @Summary Cancel a rental request
+// @Description Cancel a rental request before the equipment is checked out
+// @Tags rental-requests
+// @Accept json
+// @Produce json
+// @Param id path int true "Rental Request ID"
+// @Param request body CancelRequest false "Cancellation reason"
+// @Success 200 {object} models.RentalRequest
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_request/{id}/cancel [post]
+func (h *RentalRequestHandler) CancelRentalRequest(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request id")
+	}
+
+	var req CancelRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	request, err := h.rentalRequestService.CancelRentalRequest(c.Request().Context(), actor, uint(id), req.Comment)
+	if err != nil {
+		return changeError(err)
+	}
+	return c.JSON(http.StatusOK, request)
+}
+
+// ModifyRentalRequest godoc
+// @Summary Change dates of a rental request
+// @Description Change dates of a rental request that is not approved yet; the request is evaluated again
+// @Tags rental-requests
+// @Accept json
+// @Produce json
+// @Param id path int true "Rental Request ID"
+// @Param request body service.ModifyRentalRequestRequest true "New dates"
+// @Success 200 {object} models.RentalRequest
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_request/{id} [patch]
+func (h *RentalRequestHandler) ModifyRentalRequest(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request id")
+	}
+
+	var req service.ModifyRentalRequestRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	request, err := h.rentalRequestService.ModifyRentalRequest(c.Request().Context(), actor, uint(id), req)
+	if err != nil {
+		return changeError(err)
+	}
+	return c.JSON(http.StatusOK, request)
+}
+
+// ExtendRentalRequest godoc
+// @Summary Extend a rental request
+// @Description Move the end date of an approved or checked out rental request
+// @Tags rental-requests
+// @Accept json
+// @Produce json
+// @Param id path int true "Rental Request ID"
+// @Param request body service.ExtendRentalRequestRequest true "New end date"
+// @Success 200 {object} models.RentalRequest
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_request/{id}/extend [post]
+func (h *RentalRequestHandler) ExtendRentalRequest(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request id")
+	}
+
+	var req service.ExtendRentalRequestRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	request, err := h.rentalRequestService.ExtendRentalRequest(c.Request().Context(), actor, uint(id), req)
+	if err != nil {
+		return changeError(err)
+	}
+	return c.JSON(http.StatusOK, request)
+}
+
+// CheckOutRentalRequest godoc
+// @Summary Check out equipment
+// @Description Record that the equipment of an approved request was handed over, with an optional condition note. Equipment with tracked assets requires asset_ids matching the requested quantity
+// @Tags rental-requests
+// @Accept json
+// @Produce json
+// @Param id path int true "Rental Request ID"
+// @Param request body service.HandoverRequest false "Condition report and assets to hand over"
+// @Success 200 {object} service.Handover
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_request/{id}/checkout [post]
+func (h *RentalRequestHandler) CheckOutRentalRequest(c echo.Context) error {
+	return h.handover(c, h.rentalRequestService.CheckOutRentalRequest)
+}
+
+// ReturnRentalRequest godoc
+// @Summary Return equipment
+// @Description Record that checked out equipment was brought back and free it for new requests
+// @Tags rental-requests
+// @Accept json
+// @Produce json
+// @Param id path int true "Rental Request ID"
+// @Param request body service.HandoverRequest false "Condition report"
+// @Success 200 {object} service.Handover
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_request/{id}/return [post]
+func (h *RentalRequestHandler) ReturnRentalRequest(c echo.Context) error {
+	return h.handover(c, h.rentalRequestService.ReturnRentalRequest)
+}
+
+func (h *RentalRequestHandler) handover(
+	c echo.Context,
+	record func(ctx context.Context, actor service.Actor, requestID uint, req service.HandoverRequest) (*service.Handover, error),
+) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request id")
+	}
+
+	var req service.HandoverRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	handover, err := record(c.Request().Context(), actor, uint(id), req)
+	if err != nil {
+		return changeError(err)
+	}
+	return c.JSON(http.StatusOK, handover)
+}
+
+// GetConditionReports godoc
+// @Summary Get condition reports of a rental request
+// @Description Get check-out and return reports of a rental request in chronological order
+// @Tags rental-requests
+// @Accept json
+// @Produce json
+// @Param id path int true "Rental Request ID"
+// @Success 200 {array} models.ConditionReport
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Security BearerAuth
+// @Router /rental_request/{id}/condition_reports [get]
+func (h *RentalRequestHandler) GetConditionReports(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request id")
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid user context")
+	}
+
+	reports, err := h.rentalRequestService.GetConditionReports(c.Request().Context(), actor, uint(id))
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, reports)
+	case errors.Is(err, service.ErrRentalRequestNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "rental request not found")
+	case errors.Is(err, service.ErrForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, "access denied")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// changeError переводит ошибки изменения заявки в HTTP-ответы.
+func changeError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrRentalRequestNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "rental request not found")
+	case errors.Is(err, service.ErrForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, "access denied")
+	case errors.Is(err, service.ErrInvalidDateRange):
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid date range")
+	case errors.Is(err, service.ErrInvalidStatus):
+		return echo.NewHTTPError(http.StatusConflict, "operation is not allowed in the current request status")
+	case errors.Is(err, service.ErrEquipmentUnavailable):
+		return echo.NewHTTPError(http.StatusConflict, "equipment is not available for the requested period")
+	case errors.Is(err, service.ErrOrderLine):
+		return echo.NewHTTPError(http.StatusConflict, "operation must be applied to the whole order via /rental_order/{id}")
+	case errors.Is(err, service.ErrAssetCountMismatch):
+		return echo.NewHTTPError(http.StatusBadRequest, "number of assets must match the requested quantity")
+	case errors.Is(err, service.ErrAssetNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "asset not found")
+	case errors.Is(err, service.ErrAssetUnavailable):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
@@ -3,6 +3,8 @@ package api
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"ticketprocessing/internal/models"
 	"ticketprocessing/internal/service"
 
 	"github.com/labstack/echo/v4"
@@ -19,8 +21,64 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// Токен подтверждения принимается и из ссылки в письме (?token=), и в теле запроса
+type VerifyEmailRequest struct {
+	Token string `json:"token" query:"token" validate:"required"`
+}
+
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	// MFASetupRequired — роль требует второго фактора, до его настройки токен выдан с правами user
+	MFASetupRequired bool `json:"mfa_setup_required,omitempty"`
+}
+
+// MFAChallengeResponse возвращается вместо токенов, если у пользователя
+// включён второй фактор. Вход завершается запросом POST /login/mfa.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	// Code — код из приложения-аутентификатора или резервный код
+	Code string `json:"code" validate:"required"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func newAuthResponse(pair *service.TokenPair) AuthResponse {
+	return AuthResponse{
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    pair.ExpiresIn,
+	}
+}
+
+type SetRoleRequest struct {
+	Role models.Role `json:"role" validate:"required"`
 }
 
 type UserHandler struct {
@@ -58,12 +116,16 @@ func (h *UserHandler) Login(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
 	}
 
-	token, err := h.authService.Login(c.Request().Context(), req.Email, req.Password)
+	result, err := h.authService.Login(c.Request().Context(), req.Email, req.Password, sessionMeta(c))
 	switch {
 	case err == nil:
-		return c.JSON(http.StatusOK, AuthResponse{Token: token})
+		return loginResponse(c, result)
 	case errors.Is(err, service.ErrInvalidCredentials):
 		return echo.NewHTTPError(http.StatusUnauthorized, "invalid credentials")
+	case errors.Is(err, service.ErrEmailNotVerified):
+		return echo.NewHTTPError(http.StatusForbidden, "email not verified")
+	case errors.Is(err, service.ErrAccountLocked):
+		return lockedError(c, err)
 	case errors.Is(err, service.ErrInternal):
 		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
 	default:
@@ -71,10 +133,337 @@ func (h *UserHandler) Login(c echo.Context) error {
 	}
 }
 
+func (h *UserHandler) LoginMFA(c echo.Context) error {
+	var req LoginMFARequest
+	if err := c.Bind(&req); err != nil || req.MFAToken == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	pair, err := h.authService.LoginMFA(c.Request().Context(), req.MFAToken, req.Code, sessionMeta(c))
+	if errors.Is(err, service.ErrAccountLocked) {
+		return lockedError(c, err)
+	}
+	if err != nil {
+		return mfaError(err)
+	}
+	return c.JSON(http.StatusOK, newAuthResponse(pair))
+}
+
+// OIDCLogin перенаправляет на страницу входа провайдера OpenID Connect.
+func (h *UserHandler) OIDCLogin(c echo.Context) error {
+	loginURL, err := h.authService.OIDCLoginURL(c.Request().Context())
+	switch {
+	case err == nil:
+		return c.Redirect(http.StatusFound, loginURL)
+	case errors.Is(err, service.ErrOIDCDisabled):
+		return echo.NewHTTPError(http.StatusNotFound, "oidc login is disabled")
+	case errors.Is(err, service.ErrOIDCLoginFailed):
+		return echo.NewHTTPError(http.StatusBadGateway, "identity provider unavailable")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// OIDCCallback принимает пользователя, вернувшегося от провайдера, и
+// отвечает так же, как Login.
+func (h *UserHandler) OIDCCallback(c echo.Context) error {
+	if idpErr := c.QueryParam("error"); idpErr != "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "identity provider error: "+idpErr)
+	}
+	state, code := c.QueryParam("state"), c.QueryParam("code")
+	if state == "" || code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	result, err := h.authService.LoginOIDC(c.Request().Context(), state, code, sessionMeta(c))
+	switch {
+	case err == nil:
+		return loginResponse(c, result)
+	case errors.Is(err, service.ErrOIDCDisabled):
+		return echo.NewHTTPError(http.StatusNotFound, "oidc login is disabled")
+	case errors.Is(err, service.ErrInvalidOIDCState):
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid or expired oidc state")
+	case errors.Is(err, service.ErrOIDCEmailRequired):
+		return echo.NewHTTPError(http.StatusForbidden, "identity provider did not return an email")
+	case errors.Is(err, service.ErrOIDCLinkRefused):
+		return echo.NewHTTPError(http.StatusConflict, "an account with this email already exists, sign in with a password")
+	case errors.Is(err, service.ErrOIDCLoginFailed):
+		return echo.NewHTTPError(http.StatusUnauthorized, "oidc login failed")
+	case errors.Is(err, service.ErrAccountLocked):
+		return lockedError(c, err)
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// loginResponse отдаёт токены или, если нужен второй фактор, токен для POST /login/mfa.
+func loginResponse(c echo.Context, result *service.LoginResult) error {
+	if result.Tokens == nil {
+		return c.JSON(http.StatusOK, MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    result.MFAToken,
+			ExpiresIn:   result.MFAExpiresIn,
+		})
+	}
+	resp := newAuthResponse(result.Tokens)
+	resp.MFASetupRequired = result.MFASetupRequired
+	return c.JSON(http.StatusOK, resp)
+}
+
+func lockedError(c echo.Context, err error) error {
+	var locked *service.LockedError
+	if errors.As(err, &locked) {
+		setRetryAfter(c, locked.RetryAfter)
+	}
+	return echo.NewHTTPError(http.StatusTooManyRequests, "too many failed login attempts, try again later")
+}
+
+func sessionMeta(c echo.Context) service.SessionMeta {
+	return service.SessionMeta{
+		UserAgent: c.Request().UserAgent(),
+		IP:        c.RealIP(),
+	}
+}
+
+// Refresh выдаёт новую пару токенов по refresh-токену. Каждый refresh-токен
+// одноразовый.
+func (h *UserHandler) Refresh(c echo.Context) error {
+	var req RefreshRequest
+	if err := c.Bind(&req); err != nil || req.RefreshToken == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	pair, err := h.authService.Refresh(c.Request().Context(), req.RefreshToken)
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, newAuthResponse(pair))
+	case errors.Is(err, service.ErrInvalidRefreshToken):
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid refresh token")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func (h *UserHandler) VerifyEmail(c echo.Context) error {
+	var req VerifyEmailRequest
+	if err := c.Bind(&req); err != nil || req.Token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	err := h.authService.VerifyEmail(c.Request().Context(), req.Token)
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, map[string]string{"status": "email verified"})
+	case errors.Is(err, service.ErrInvalidToken):
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid or expired token")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// ResendVerification и ForgotPassword отвечают 202 независимо от того,
+// зарегистрирован ли адрес.
+func (h *UserHandler) ResendVerification(c echo.Context) error {
+	var req EmailRequest
+	if err := c.Bind(&req); err != nil || req.Email == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	if err := h.authService.ResendVerification(c.Request().Context(), req.Email); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (h *UserHandler) ForgotPassword(c echo.Context) error {
+	var req EmailRequest
+	if err := c.Bind(&req); err != nil || req.Email == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	if err := h.authService.ForgotPassword(c.Request().Context(), req.Email); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (h *UserHandler) ResetPassword(c echo.Context) error {
+	var req ResetPasswordRequest
+	if err := c.Bind(&req); err != nil || req.Token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	err := h.authService.ResetPassword(c.Request().Context(), req.Token, req.Password)
+	switch {
+	case err == nil:
+		return c.NoContent(http.StatusNoContent)
+	case errors.Is(err, service.ErrWeakPassword):
+		return echo.NewHTTPError(http.StatusBadRequest, "password must be at least 6 characters")
+	case errors.Is(err, service.ErrInvalidToken):
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid or expired token")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
 func (h *UserHandler) Me(c echo.Context) error {
 	userID := c.Get("user_id")
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "Hello, user!",
 		"user_id": userID,
+		"role":    c.Get("role"),
 	})
 }
+
+func (h *UserHandler) SetRole(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+
+	var req SetRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	user, err := h.authService.SetRole(c.Request().Context(), uint(id), req.Role)
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, user)
+	case errors.Is(err, service.ErrInvalidRole):
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid role")
+	case errors.Is(err, service.ErrUserNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func (h *UserHandler) Logout(c echo.Context) error {
+	userID, _ := c.Get("user_id").(uint)
+	sessionID, _ := c.Get("session_id").(string)
+
+	err := h.authService.Logout(c.Request().Context(), userID, sessionID)
+	switch {
+	case err == nil, errors.Is(err, service.ErrSessionNotFound):
+		return c.NoContent(http.StatusNoContent)
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func (h *UserHandler) ListSessions(c echo.Context) error {
+	userID, _ := c.Get("user_id").(uint)
+	sessionID, _ := c.Get("session_id").(string)
+
+	sessions, err := h.authService.ListSessions(c.Request().Context(), userID, sessionID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+	return c.JSON(http.StatusOK, sessions)
+}
+
+func (h *UserHandler) RevokeSession(c echo.Context) error {
+	userID, _ := c.Get("user_id").(uint)
+
+	err := h.authService.RevokeSession(c.Request().Context(), userID, c.Param("id"))
+	switch {
+	case err == nil:
+		return c.NoContent(http.StatusNoContent)
+	case errors.Is(err, service.ErrSessionNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "session not found")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func (h *UserHandler) RevokeAllSessions(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+
+	count, err := h.authService.RevokeAllSessions(c.Request().Context(), uint(id))
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, map[string]int{"revoked": count})
+	case errors.Is(err, service.ErrUserNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func (h *UserHandler) SetupTOTP(c echo.Context) error {
+	userID, _ := c.Get("user_id").(uint)
+
+	setup, err := h.authService.SetupTOTP(c.Request().Context(), userID)
+	if err != nil {
+		return mfaError(err)
+	}
+	return c.JSON(http.StatusOK, setup)
+}
+
+// EnableTOTP возвращает резервные коды. Они показываются один раз.
+func (h *UserHandler) EnableTOTP(c echo.Context) error {
+	userID, _ := c.Get("user_id").(uint)
+	sessionID, _ := c.Get("session_id").(string)
+
+	var req MFACodeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	codes, err := h.authService.EnableTOTP(c.Request().Context(), userID, sessionID, req.Code)
+	if err != nil {
+		return mfaError(err)
+	}
+	return c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *UserHandler) DisableTOTP(c echo.Context) error {
+	userID, _ := c.Get("user_id").(uint)
+
+	var req MFACodeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	if err := h.authService.DisableTOTP(c.Request().Context(), userID, req.Code); err != nil {
+		return mfaError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *UserHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	userID, _ := c.Get("user_id").(uint)
+
+	var req MFACodeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request format")
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(c.Request().Context(), userID, req.Code)
+	if err != nil {
+		return mfaError(err)
+	}
+	return c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func mfaError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidMFAToken):
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired mfa token")
+	case errors.Is(err, service.ErrInvalidMFACode):
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid mfa code")
+	case errors.Is(err, service.ErrMFAAlreadyEnabled), errors.Is(err, service.ErrMFANotEnabled),
+		errors.Is(err, service.ErrMFASetupRequired):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrMFARequired):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+}
@@ -1,15 +1,22 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"ticketprocessing/internal/api"
 	"ticketprocessing/internal/auth"
+	"ticketprocessing/internal/availability"
 	"ticketprocessing/internal/config"
 	"ticketprocessing/internal/db"
+	"ticketprocessing/internal/lifecycle"
+	"ticketprocessing/internal/mailer"
 	"ticketprocessing/internal/messaging"
 	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/oidc"
+	"ticketprocessing/internal/outbox"
+	"ticketprocessing/internal/ratelimit"
 	"ticketprocessing/internal/repository"
 	"ticketprocessing/internal/service"
 	"time"
@@ -60,6 +67,15 @@ func NewApp() {
 	rentalRequestRepo := repository.NewRentalRequestRepository(db)
 	requestStatusLogRepo := repository.NewRequestStatusLogRepository(db)
 	equipmentRepo := repository.NewEquipmentRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	rentalOrderRepo := repository.NewRentalOrderRepository(db)
+	conditionReportRepo := repository.NewConditionReportRepository(db)
+	assetRepo := repository.NewAssetRepository(db)
+	categoryRepo := repository.NewCategoryRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	transactor := repository.NewTransactor(db)
+	availabilityChecker := availability.NewChecker(rentalRequestRepo, equipmentRepo)
+	lifecycleMachine := lifecycle.NewMachine(transactor, rentalRequestRepo, requestStatusLogRepo, rentalOrderRepo)
 
 	// Initialize RabbitMQ
 	rabbitMQ, err := messaging.NewRabbitMQPublisher(&cfg.RabbitMQ)
@@ -69,18 +85,59 @@ func NewApp() {
 	}
 	defer rabbitMQ.Close()
 
+	// Start outbox relay
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relay := outbox.NewRelay(&cfg.Outbox, transactor, outboxRepo, rabbitMQ, log)
+	go relay.Run(ctx)
+
 	// Initialize auth components
-	jwtManager := auth.NewJWTManager(cfg.JWT.Secret, cfg.JWT.TTLMinutes)
 	redisAddr := fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port)
-	redisStore := auth.NewRedisTokenStore(redisAddr, cfg.Redis.DB, time.Duration(cfg.JWT.TTLMinutes)*time.Minute)
+	redisStore := auth.NewRedisTokenStore(redisAddr, cfg.Redis.DB, time.Duration(cfg.JWT.RefreshTTLHours)*time.Hour)
+	keySet, err := auth.NewKeySet(&cfg.JWT, redisStore.Client, log)
+	if err != nil {
+		slog.Warn("failed to initialize signing keys", slog.String("error", err.Error()))
+		return
+	}
+	if err := keySet.Load(ctx); err != nil {
+		slog.Warn("failed to load signing keys", slog.String("error", err.Error()))
+		return
+	}
+	go keySet.Run(ctx)
+	jwtManager := auth.NewJWTManager(keySet, cfg.JWT.TTLMinutes)
+
+	limiter := ratelimit.NewLimiter(redisStore.Client)
+	lockout := ratelimit.NewLockout(&cfg.Lockout, redisStore.Client)
+
+	sender, err := mailer.New(&cfg.Mailer, log)
+	if err != nil {
+		slog.Warn("failed to initialize mailer", slog.String("error", err.Error()))
+		return
+	}
+	// Mail is sent in the background so that SMTP latency neither slows down
+	// requests nor reveals whether an account exists
+	mail := mailer.NewQueue(sender, log)
+	go mail.Run(ctx)
+
+	// OIDC provider metadata is fetched lazily, so the IdP being down does not block startup
+	var oidcProvider *oidc.Provider
+	if cfg.OIDC.Enabled {
+		oidcProvider = oidc.NewProvider(&cfg.OIDC)
+	}
 
 	// Initialize services
-	authService := service.NewAuthService(authRepo, jwtManager, redisStore)
-	rentalRequestService := service.NewRentalRequestService(rentalRequestRepo, requestStatusLogRepo, equipmentRepo, rabbitMQ)
-	equipmentService := service.NewEquipment(equipmentRepo)
+	authService := service.NewAuthService(authRepo, jwtManager, redisStore, mail, &cfg.Accounts, &cfg.MFA, lockout, &cfg.OIDC, oidcProvider, cfg.RBAC.AdminEmails)
+	rentalRequestService := service.NewRentalRequestService(rentalRequestRepo, requestStatusLogRepo, equipmentRepo, authRepo, availabilityChecker, lifecycleMachine, transactor, outboxRepo, conditionReportRepo, assetRepo)
+	rentalOrderService := service.NewRentalOrderService(rentalOrderRepo, rentalRequestRepo, equipmentRepo, availabilityChecker, lifecycleMachine, transactor, outboxRepo)
+	equipmentService := service.NewEquipment(equipmentRepo, assetRepo, categoryRepo, availabilityChecker, transactor)
+	categoryService := service.NewCategory(categoryRepo, equipmentRepo)
+	assetService := service.NewAsset(assetRepo, equipmentRepo, transactor)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo, authRepo)
 
 	// Initialize Echo
 	e := echo.New()
+	// RealIP keys rate limits and session IPs, so it must not trust client-supplied headers
+	e.IPExtractor = api.IPExtractor(cfg.App.TrustedProxies)
 
 	// Middleware
 	e.Use(middleware.Logger())
@@ -90,28 +147,102 @@ func NewApp() {
 	// Initialize handlers
 	userHandler := api.NewUserHandler(authService)
 	rentalRequestHandler := api.NewRentalRequestHandler(rentalRequestService)
+	rentalOrderHandler := api.NewRentalOrderHandler(rentalOrderService)
 	equipmentHandler := api.NewEquipmentHandler(equipmentService)
+	assetHandler := api.NewAssetHandler(assetService)
+	categoryHandler := api.NewCategoryHandler(categoryService)
+	jwksHandler := api.NewJWKSHandler(keySet)
+	apiKeyHandler := api.NewAPIKeyHandler(apiKeyService)
+
+	// Rate limits per route group, see rate_limit in config.yaml
+	loginLimit := api.RateLimit(limiter, &cfg.RateLimit, "login")
+	emailLimit := api.RateLimit(limiter, &cfg.RateLimit, "email")
+	apiLimit := api.RateLimit(limiter, &cfg.RateLimit, "api")
+
+	// API keys are accepted only by groups with a resource, see models.APIKeyResources
+	requireAuth := func(resource string) []echo.MiddlewareFunc {
+		return []echo.MiddlewareFunc{api.AuthMiddleware(jwtManager, redisStore, apiKeyService, resource), apiLimit}
+	}
 
 	// Public routes
-	e.POST("/register", userHandler.Register)
-	e.POST("/login", userHandler.Login)
+	e.POST("/register", userHandler.Register, emailLimit)
+	e.POST("/login", userHandler.Login, loginLimit)
+	e.POST("/login/mfa", userHandler.LoginMFA, loginLimit)
+	e.POST("/token/refresh", userHandler.Refresh, loginLimit)
+	e.GET("/oidc/login", userHandler.OIDCLogin, loginLimit)
+	e.GET("/oidc/callback", userHandler.OIDCCallback, loginLimit)
+	e.GET("/.well-known/jwks.json", jwksHandler.GetJWKS)
+	e.GET("/email/verify", userHandler.VerifyEmail, emailLimit)
+	e.POST("/email/verify", userHandler.VerifyEmail, emailLimit)
+	e.POST("/email/verify/resend", userHandler.ResendVerification, emailLimit)
+	e.POST("/password/forgot", userHandler.ForgotPassword, emailLimit)
+	e.POST("/password/reset", userHandler.ResetPassword, emailLimit)
 
 	// Protected routes
 	me := e.Group("/me")
-	me.Use(api.AuthMiddleware(jwtManager, redisStore))
+	me.Use(requireAuth("")...)
 	me.GET("", userHandler.Me)
+	me.GET("/sessions", userHandler.ListSessions)
+	me.DELETE("/sessions/:id", userHandler.RevokeSession)
+	me.POST("/mfa/totp/setup", userHandler.SetupTOTP)
+	me.POST("/mfa/totp/enable", userHandler.EnableTOTP)
+	me.POST("/mfa/totp/disable", userHandler.DisableTOTP)
+	me.POST("/mfa/recovery_codes", userHandler.RegenerateRecoveryCodes)
+	e.POST("/logout", userHandler.Logout, requireAuth("")...)
 
 	// Rental request routes
 	rental := e.Group("/rental_request")
-	rental.Use(api.AuthMiddleware(jwtManager, redisStore))
+	rental.Use(requireAuth("rental_requests")...)
+	rental.GET("", rentalRequestHandler.ListRentalRequests)
 	rental.POST("", rentalRequestHandler.CreateRentalRequest)
 	rental.GET("/:id/status", rentalRequestHandler.GetRequestStatus)
 	rental.GET("/:id/status_at", rentalRequestHandler.GetRequestStatusAt)
+	rental.GET("/:id/history", rentalRequestHandler.GetRequestHistory)
+	rental.PATCH("/:id", rentalRequestHandler.ModifyRentalRequest)
+	rental.POST("/:id/cancel", rentalRequestHandler.CancelRentalRequest)
+	rental.POST("/:id/extend", rentalRequestHandler.ExtendRentalRequest)
+	rental.GET("/:id/condition_reports", rentalRequestHandler.GetConditionReports)
+
+	// Approval and equipment handover require manager role
+	manager := api.RequireRole(models.RoleManager)
+	rental.GET("/review-queue", rentalRequestHandler.GetReviewQueue, manager)
+	rental.POST("/:id/approve", rentalRequestHandler.ApproveRentalRequest, manager)
+	rental.POST("/:id/reject", rentalRequestHandler.RejectRentalRequest, manager)
+	rental.POST("/:id/checkout", rentalRequestHandler.CheckOutRentalRequest, manager)
+	rental.POST("/:id/return", rentalRequestHandler.ReturnRentalRequest, manager)
+
+	// Rental order routes
+	order := e.Group("/rental_order")
+	order.Use(requireAuth("rental_orders")...)
+	order.POST("", rentalOrderHandler.CreateRentalOrder)
+	order.GET("/:id", rentalOrderHandler.GetRentalOrder)
+	order.PATCH("/:id", rentalOrderHandler.ModifyRentalOrder)
+	order.POST("/:id/cancel", rentalOrderHandler.CancelRentalOrder)
+	order.POST("/:id/extend", rentalOrderHandler.ExtendRentalOrder)
 
 	// Equipment routes
 	equipment := e.Group("/api/equipment")
-	equipment.Use(api.AuthMiddleware(jwtManager, redisStore))
-	equipmentHandler.RegisterRoutes(e)
+	equipment.Use(requireAuth("equipment")...)
+	equipmentHandler.RegisterRoutes(equipment)
+
+	// Asset routes
+	assets := e.Group("/api/assets")
+	assets.Use(requireAuth("equipment")...)
+	assetHandler.RegisterRoutes(equipment, assets)
+
+	// Category routes
+	categories := e.Group("/api/categories")
+	categories.Use(requireAuth("categories")...)
+	categoryHandler.RegisterRoutes(categories)
+
+	// Admin routes
+	admin := e.Group("/admin")
+	admin.Use(requireAuth("")...)
+	admin.Use(api.RequireRole(models.RoleAdmin))
+	admin.PUT("/users/:id/role", userHandler.SetRole)
+	admin.DELETE("/users/:id/sessions", userHandler.RevokeAllSessions)
+	admin.GET("/rental_requests", rentalRequestHandler.SearchRentalRequests)
+	apiKeyHandler.RegisterRoutes(admin)
 
 	// Start server
 	port := cfg.App.Port
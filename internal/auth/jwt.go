@@ -1,41 +1,65 @@
 package auth
 
 import (
+	"context"
+	"ticketprocessing/internal/models"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type JWTManager struct {
-	Secret     string
+	Keys       *KeySet
 	TTLMinutes int
 }
 
 type Claims struct {
-	UserID uint `json:"user_id"`
+	UserID    uint        `json:"user_id"`
+	Role      models.Role `json:"role"`
+	SessionID string      `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func NewJWTManager(secret string, ttlMinutes int) *JWTManager {
-	return &JWTManager{Secret: secret, TTLMinutes: ttlMinutes}
+func NewJWTManager(keys *KeySet, ttlMinutes int) *JWTManager {
+	return &JWTManager{Keys: keys, TTLMinutes: ttlMinutes}
 }
 
-func (j *JWTManager) Generate(userID uint) (string, error) {
+// Generate подписывает токен текущим ключом и указывает его kid в заголовке.
+func (j *JWTManager) Generate(userID uint, role models.Role, sessionID string) (string, error) {
+	key, err := j.Keys.Current()
+	if err != nil {
+		return "", err
+	}
+
 	expiresAt := time.Now().Add(time.Duration(j.TTLMinutes) * time.Minute)
 	claims := &Claims{
-		UserID: userID,
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.Secret))
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signer)
 }
 
-func (j *JWTManager) Parse(tokenStr string) (*Claims, error) {
+// Parse проверяет подпись ключом из заголовка kid. Алгоритм берётся из
+// ключа, а не из заголовка токена.
+func (j *JWTManager) Parse(ctx context.Context, tokenStr string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(j.Secret), nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key, err := j.Keys.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, jwt.ErrTokenSignatureInvalid
+		}
+		return key.Public(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
 	if err != nil {
 		return nil, err
 	}
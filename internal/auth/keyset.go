@@ -0,0 +1,436 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"slices"
+	"sync"
+	"ticketprocessing/internal/config"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown signing key")
+	ErrNoKeys     = errors.New("no signing keys")
+)
+
+const (
+	// Ключи общие для всех экземпляров сервиса: kid -> storedKey
+	signingKeysKey = "jwt_keys"
+	// Блокировка, чтобы ротацию выполнял один экземпляр
+	rotateLockKey = "jwt_keys:rotate"
+	rotateLockTTL = 30 * time.Second
+
+	keysRefreshInterval = time.Minute
+	// Не чаще этого перечитываем ключи при встрече неизвестного kid
+	minReloadInterval = 10 * time.Second
+	rsaKeyBits        = 2048
+)
+
+// storedKey — ключ в Redis. Закрытый ключ (PKCS#8 DER) зашифрован
+// AES-256-GCM ключом шифрования из конфига, kid входит в AAD, чтобы
+// зашифрованный ключ нельзя было подставить под другим kid.
+type storedKey struct {
+	ID        string    `json:"kid"`
+	Algorithm string    `json:"alg"`
+	Sealed    []byte    `json:"sealed_private_key"`
+	CreatedAt time.Time `json:"created_at"`
+	// der — незашифрованный ключ для store; только в памяти, в JSON не попадает
+	der []byte
+}
+
+// SigningKey — ключ подписи токенов. Последний выпущенный ключ подписывает
+// новые токены, предыдущие только проверяют их до окончания grace-периода.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	// RetiresAt — конец grace-периода; нулевой у текущего ключа
+	RetiresAt time.Time
+	signer    crypto.Signer
+}
+
+func (k *SigningKey) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+func (k *SigningKey) valid(now time.Time) bool {
+	return k.RetiresAt.IsZero() || now.Before(k.RetiresAt)
+}
+
+// KeySet хранит ключи подписи в Redis и кеширует их в памяти. Run
+// периодически перечитывает ключи и выпускает новый, когда текущему
+// исполнилось RotationHours или сменился алгоритм в конфиге.
+type KeySet struct {
+	client   *redis.Client
+	log      *slog.Logger
+	alg      string
+	rotation time.Duration
+	grace    time.Duration
+	kek      cipher.AEAD
+
+	mu       sync.RWMutex
+	keys     []SigningKey // от новых к старым
+	loadedAt time.Time
+}
+
+func NewKeySet(cfg *config.JWTConfig, client *redis.Client, log *slog.Logger) (*KeySet, error) {
+	if cfg.KeyEncryptionKey == "" {
+		return nil, errors.New("jwt key_encryption_key is not set")
+	}
+	kek, err := base64.StdEncoding.DecodeString(cfg.KeyEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt key_encryption_key: %w", err)
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt key_encryption_key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeySet{
+		client:   client,
+		log:      log,
+		alg:      cfg.Algorithm,
+		rotation: time.Duration(cfg.RotationHours) * time.Hour,
+		grace:    time.Duration(cfg.GraceHours) * time.Hour,
+		kek:      aead,
+	}, nil
+}
+
+// Load читает ключи из Redis и выпускает первый ключ, если их ещё нет.
+func (s *KeySet) Load(ctx context.Context) error {
+	if err := s.reload(ctx); err != nil {
+		return err
+	}
+	if s.rotationDue() {
+		return s.Rotate(ctx)
+	}
+	return nil
+}
+
+// Run поддерживает ключи в актуальном состоянии до отмены контекста.
+func (s *KeySet) Run(ctx context.Context) {
+	ticker := time.NewTicker(keysRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Load(ctx); err != nil {
+				s.log.Error("failed to refresh signing keys", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// Current возвращает ключ для подписи новых токенов.
+func (s *KeySet) Current() (*SigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	key := s.keys[0]
+	return &key, nil
+}
+
+// Key возвращает ключ проверки по kid. Неизвестный kid может означать, что
+// ротацию выполнил другой экземпляр, поэтому ключи перечитываются.
+func (s *KeySet) Key(ctx context.Context, kid string) (*SigningKey, error) {
+	key, ok := s.find(kid)
+	if !ok && s.reloadAllowed() {
+		if err := s.reload(ctx); err != nil {
+			return nil, err
+		}
+		key, ok = s.find(kid)
+	}
+	if !ok || !key.valid(time.Now()) {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// Rotate выпускает новый ключ подписи. Если ротацию уже выполняет другой
+// экземпляр, только перечитывает ключи.
+func (s *KeySet) Rotate(ctx context.Context) error {
+	locked, err := s.client.SetNX(ctx, rotateLockKey, 1, rotateLockTTL).Result()
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return s.reload(ctx)
+	}
+	defer s.client.Del(ctx, rotateLockKey)
+
+	// Пока ждали блокировку, ключ мог выпустить другой экземпляр
+	if err := s.reload(ctx); err != nil {
+		return err
+	}
+	if !s.rotationDue() {
+		return nil
+	}
+
+	key, err := generateKey(s.alg)
+	if err != nil {
+		return err
+	}
+	if err := s.store(ctx, key); err != nil {
+		return err
+	}
+	s.log.Info("signing key rotated", slog.String("kid", key.ID), slog.String("alg", key.Algorithm))
+
+	return s.reload(ctx)
+}
+
+// JWKS возвращает публичные части действующих ключей.
+func (s *KeySet) JWKS() JWKSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range s.keys {
+		if key.valid(now) {
+			set.Keys = append(set.Keys, newJWK(&key))
+		}
+	}
+	return set
+}
+
+func (s *KeySet) find(kid string) (*SigningKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if key.ID == kid {
+			return &key, true
+		}
+	}
+	return nil, false
+}
+
+func (s *KeySet) reloadAllowed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return time.Since(s.loadedAt) >= minReloadInterval
+}
+
+func (s *KeySet) rotationDue() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.keys) == 0 {
+		return true
+	}
+	current := s.keys[0]
+	return current.Algorithm != s.alg || time.Since(current.CreatedAt) >= s.rotation
+}
+
+// reload перечитывает ключи из Redis и удаляет те, чей grace-период истёк.
+func (s *KeySet) reload(ctx context.Context) error {
+	raw, err := s.client.HGetAll(ctx, signingKeysKey).Result()
+	if err != nil {
+		return err
+	}
+	if len(raw) == 0 {
+		// Ключи пропали из Redis (flush или вытеснение): возвращаем известные
+		// этому экземпляру, чтобы выданные токены не стали недействительными
+		return s.restore(ctx)
+	}
+
+	keys := make([]SigningKey, 0, len(raw))
+	for kid, data := range raw {
+		var stored storedKey
+		if err := json.Unmarshal([]byte(data), &stored); err != nil {
+			return fmt.Errorf("failed to decode signing key %s: %w", kid, err)
+		}
+		der, err := s.open(&stored)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt signing key %s: %w", kid, err)
+		}
+		key, err := stored.signingKey(der)
+		if err != nil {
+			return fmt.Errorf("failed to parse signing key %s: %w", kid, err)
+		}
+		keys = append(keys, *key)
+	}
+	slices.SortFunc(keys, func(a, b SigningKey) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	// Ключ действует до выпуска следующего и ещё grace после него
+	now := time.Now()
+	active := keys[:0]
+	var expired []string
+	for i := range keys {
+		if i > 0 {
+			keys[i].RetiresAt = keys[i-1].CreatedAt.Add(s.grace)
+		}
+		if keys[i].valid(now) {
+			active = append(active, keys[i])
+		} else {
+			expired = append(expired, keys[i].ID)
+		}
+	}
+	if len(expired) > 0 {
+		if err := s.client.HDel(ctx, signingKeysKey, expired...).Err(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.keys = active
+	s.loadedAt = now
+	s.mu.Unlock()
+	return nil
+}
+
+// restore записывает в Redis ключи из памяти. Без них ключ будет выпущен заново.
+func (s *KeySet) restore(ctx context.Context) error {
+	s.mu.RLock()
+	keys := slices.Clone(s.keys)
+	s.mu.RUnlock()
+
+	if len(keys) == 0 {
+		return nil
+	}
+	s.log.Warn("signing keys missing in redis, restoring from memory", slog.Int("count", len(keys)))
+
+	for _, key := range keys {
+		der, err := x509.MarshalPKCS8PrivateKey(key.signer)
+		if err != nil {
+			return err
+		}
+		stored := &storedKey{ID: key.ID, Algorithm: key.Algorithm, CreatedAt: key.CreatedAt, der: der}
+		if err := s.store(ctx, stored); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// store шифрует закрытый ключ и сохраняет его в Redis.
+func (s *KeySet) store(ctx context.Context, key *storedKey) error {
+	nonce := make([]byte, s.kek.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key.Sealed = s.kek.Seal(nonce, nonce, key.der, []byte(key.ID))
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, signingKeysKey, key.ID, data).Err()
+}
+
+// open расшифровывает закрытый ключ.
+func (s *KeySet) open(key *storedKey) ([]byte, error) {
+	size := s.kek.NonceSize()
+	if len(key.Sealed) < size {
+		return nil, errors.New("sealed key too short")
+	}
+	return s.kek.Open(nil, key.Sealed[:size], key.Sealed[size:], []byte(key.ID))
+}
+
+func generateKey(alg string) (*storedKey, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case config.JWTAlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case config.JWTAlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := RandomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	return &storedKey{ID: kid, Algorithm: alg, CreatedAt: time.Now(), der: der}, nil
+}
+
+func (k *storedKey) signingKey(der []byte) (*SigningKey, error) {
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	var signer crypto.Signer
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		signer = key
+	case ed25519.PrivateKey:
+		signer = key
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+	return &SigningKey{ID: k.ID, Algorithm: k.Algorithm, CreatedAt: k.CreatedAt, signer: signer}, nil
+}
+
+// JWK — публичный ключ в формате RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func newJWK(key *SigningKey) JWK {
+	jwk := JWK{KeyID: key.ID, Algorithm: key.Algorithm, Use: "sig"}
+	switch public := key.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
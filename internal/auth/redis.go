@@ -2,12 +2,62 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused означает, что предъявлен уже использованный
+	// refresh-токен. Сессия при этом завершается целиком.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	ErrTokenNotFound      = errors.New("token not found")
+)
+
+// Назначения одноразовых токенов из писем
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposePasswordReset = "password_reset"
+)
+
+const (
+	// maxUsedRefreshTokens ограничивает историю ротаций в сессии.
+	maxUsedRefreshTokens = 50
+	// maxMFAAttempts — число неверных кодов, после которого challenge сгорает
+	maxMFAAttempts = 5
+)
+
+// Session — вход пользователя с одного устройства и семейство его
+// refresh-токенов. Access-токен ссылается на сессию через claim sid,
+// поэтому удаление сессии отзывает все её токены.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     uint      `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// MFA — вход подтверждён вторым фактором
+	MFA bool `json:"mfa"`
+	// Хеши текущего и уже использованных refresh-токенов
+	RefreshHash     string   `json:"refresh_hash,omitempty"`
+	UsedRefreshHash []string `json:"used_refresh_hash,omitempty"`
+}
+
+// RedisTokenStore хранит сессии. TTL — время жизни refresh-токена:
+// сессия истекает, если её не обновляли дольше TTL.
 type RedisTokenStore struct {
 	Client *redis.Client
 	TTL    time.Duration
@@ -21,20 +71,372 @@ func NewRedisTokenStore(addr string, db int, ttl time.Duration) *RedisTokenStore
 	return &RedisTokenStore{Client: client, TTL: ttl}
 }
 
-func (r *RedisTokenStore) SaveToken(ctx context.Context, token string, userID uint) error {
-	return r.Client.Set(ctx, token, userID, r.TTL).Err()
+// NewSessionID возвращает случайный идентификатор сессии.
+func NewSessionID() (string, error) {
+	return RandomHex(16)
+}
+
+// NewRefreshToken выпускает refresh-токен сессии вида "<sid>.<secret>".
+// В хранилище попадает только хеш.
+func NewRefreshToken(sessionID string) (token, hash string, err error) {
+	secret, err := RandomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+	token = sessionID + "." + secret
+	return token, HashToken(token), nil
+}
+
+// RefreshTokenSession возвращает ID сессии из refresh-токена.
+func RefreshTokenSession(token string) (string, error) {
+	sessionID, _, ok := strings.Cut(token, ".")
+	if !ok || sessionID == "" {
+		return "", ErrInvalidRefreshToken
+	}
+	return sessionID, nil
+}
+
+// HashToken — SHA-256 токена в hex. Токены случайные и длинные, поэтому
+// соль не нужна; в хранилище попадает только хеш.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomHex возвращает n случайных байт в hex.
+func RandomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+// userSessionsKey — множество ID сессий пользователя. Истёкшие сессии
+// удаляются из него при чтении списка.
+func userSessionsKey(userID uint) string {
+	return fmt.Sprintf("user_sessions:%d", userID)
+}
+
+// SaveSession сохраняет новую сессию на TTL.
+func (r *RedisTokenStore) SaveSession(ctx context.Context, session *Session) error {
+	session.ExpiresAt = time.Now().Add(r.TTL)
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.Client.TxPipeline()
+	pipe.Set(ctx, sessionKey(session.ID), data, r.TTL)
+	pipe.SAdd(ctx, userSessionsKey(session.UserID), session.ID)
+	pipe.Expire(ctx, userSessionsKey(session.UserID), r.TTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisTokenStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	return getSession(ctx, r.Client, id)
+}
+
+func getSession(ctx context.Context, cmd redis.Cmdable, id string) (*Session, error) {
+	data, err := cmd.Get(ctx, sessionKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// TouchSession запоминает время последнего запроса, не продлевая сессию.
+func (r *RedisTokenStore) TouchSession(ctx context.Context, session *Session) error {
+	session.LastSeenAt = time.Now()
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	// XX: не воскрешаем сессию, удалённую между чтением и записью
+	return r.Client.SetArgs(ctx, sessionKey(session.ID), data, redis.SetArgs{KeepTTL: true, Mode: "XX"}).Err()
+}
+
+// RotateRefreshToken меняет refresh-токен сессии на новый и продлевает её.
+// Повторно предъявленный старый токен означает, что он утёк: сессия
+// удаляется вместе со всеми токенами и возвращается ErrRefreshTokenReused.
+func (r *RedisTokenStore) RotateRefreshToken(ctx context.Context, token, newHash string) (*Session, error) {
+	sessionID, err := RefreshTokenSession(token)
+	if err != nil {
+		return nil, err
+	}
+	presented := HashToken(token)
+
+	var session *Session
+	// WATCH не даёт двум параллельным обновлениям принять один токен
+	err = r.Client.Watch(ctx, func(tx *redis.Tx) error {
+		session, err = getSession(ctx, tx, sessionID)
+		if errors.Is(err, ErrSessionNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(session.RefreshHash)) != 1 {
+			if !slices.Contains(session.UsedRefreshHash, presented) {
+				return ErrInvalidRefreshToken
+			}
+			_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Del(ctx, sessionKey(sessionID))
+				pipe.SRem(ctx, userSessionsKey(session.UserID), sessionID)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			return ErrRefreshTokenReused
+		}
+
+		session.UsedRefreshHash = append(session.UsedRefreshHash, session.RefreshHash)
+		if len(session.UsedRefreshHash) > maxUsedRefreshTokens {
+			session.UsedRefreshHash = session.UsedRefreshHash[len(session.UsedRefreshHash)-maxUsedRefreshTokens:]
+		}
+		session.RefreshHash = newHash
+		session.LastSeenAt = time.Now()
+		session.ExpiresAt = session.LastSeenAt.Add(r.TTL)
+
+		data, err := json.Marshal(session)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, sessionKey(sessionID), data, r.TTL)
+			pipe.Expire(ctx, userSessionsKey(session.UserID), r.TTL)
+			return nil
+		})
+		return err
+	}, sessionKey(sessionID))
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListSessions возвращает активные сессии пользователя.
+func (r *RedisTokenStore) ListSessions(ctx context.Context, userID uint) ([]Session, error) {
+	ids, err := r.Client.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	for _, id := range ids {
+		session, err := r.GetSession(ctx, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			r.Client.SRem(ctx, userSessionsKey(userID), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, nil
+}
+
+// DeleteSession удаляет сессию пользователя. Чужую сессию удалить нельзя,
+// для неё возвращается ErrSessionNotFound.
+func (r *RedisTokenStore) DeleteSession(ctx context.Context, userID uint, id string) error {
+	session, err := r.GetSession(ctx, id)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	pipe := r.Client.TxPipeline()
+	pipe.Del(ctx, sessionKey(id))
+	pipe.SRem(ctx, userSessionsKey(userID), id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// DeleteAllSessions завершает все сессии пользователя и возвращает их число.
+func (r *RedisTokenStore) DeleteAllSessions(ctx context.Context, userID uint) (int, error) {
+	ids, err := r.Client.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	pipe := r.Client.TxPipeline()
+	for _, id := range ids {
+		pipe.Del(ctx, sessionKey(id))
+	}
+	pipe.Del(ctx, userSessionsKey(userID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
 }
 
-func (r *RedisTokenStore) GetUserID(ctx context.Context, token string) (uint, error) {
-	val, err := r.Client.Get(ctx, token).Result()
+// IssueOneTimeToken выпускает одноразовый токен для пользователя. Выпуск
+// нового токена того же назначения отменяет предыдущий.
+func (r *RedisTokenStore) IssueOneTimeToken(ctx context.Context, purpose string, userID uint, ttl time.Duration) (string, error) {
+	token, err := RandomHex(32)
+	if err != nil {
+		return "", err
+	}
+	userKey := oneTimeUserKey(purpose, userID)
+
+	previous, err := r.Client.Get(ctx, userKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", err
+	}
+
+	pipe := r.Client.TxPipeline()
+	if previous != "" {
+		pipe.Del(ctx, oneTimeKey(purpose, previous))
+	}
+	pipe.Set(ctx, oneTimeKey(purpose, HashToken(token)), userID, ttl)
+	pipe.Set(ctx, userKey, HashToken(token), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeOneTimeToken погашает токен и возвращает ID пользователя.
+// Повторное использование токена возвращает ErrTokenNotFound.
+func (r *RedisTokenStore) ConsumeOneTimeToken(ctx context.Context, purpose, token string) (uint, error) {
+	userID, err := r.Client.GetDel(ctx, oneTimeKey(purpose, HashToken(token))).Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrTokenNotFound
+	}
 	if err != nil {
 		return 0, err
 	}
-	var userID uint
-	_, err = fmt.Sscanf(val, "%d", &userID)
-	return userID, err
+
+	r.Client.Del(ctx, oneTimeUserKey(purpose, uint(userID)))
+	return uint(userID), nil
+}
+
+// В Redis хранится только хеш токена
+func oneTimeKey(purpose, hash string) string {
+	return purpose + ":" + hash
+}
+
+func oneTimeUserKey(purpose string, userID uint) string {
+	return fmt.Sprintf("%s_user:%d", purpose, userID)
+}
+
+// IssueMFAChallenge выпускает токен второго шага входа: пароль уже
+// проверен, осталось предъявить код.
+func (r *RedisTokenStore) IssueMFAChallenge(ctx context.Context, userID uint, ttl time.Duration) (string, error) {
+	token, err := RandomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	key := mfaChallengeKey(token)
+	pipe := r.Client.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", userID, "attempts", 0)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (r *RedisTokenStore) GetMFAChallenge(ctx context.Context, token string) (uint, error) {
+	userID, err := r.Client.HGet(ctx, mfaChallengeKey(token), "user_id").Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrTokenNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint(userID), nil
+}
+
+// failMFAChallenge увеличивает счётчик попыток только у существующего
+// challenge: HINCRBY по истёкшему ключу создал бы хеш без TTL.
+var failMFAChallenge = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local attempts = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+if attempts >= tonumber(ARGV[1]) then
+	redis.call('DEL', KEYS[1])
+end
+return attempts
+`)
+
+// FailMFAChallenge учитывает неверный код и удаляет challenge после
+// maxMFAAttempts попыток, чтобы код нельзя было подобрать.
+func (r *RedisTokenStore) FailMFAChallenge(ctx context.Context, token string) error {
+	return failMFAChallenge.Run(ctx, r.Client, []string{mfaChallengeKey(token)}, maxMFAAttempts).Err()
+}
+
+// ConsumeMFAChallenge удаляет challenge после успешной проверки кода. false
+// означает, что его уже погасил параллельный запрос.
+func (r *RedisTokenStore) ConsumeMFAChallenge(ctx context.Context, token string) (bool, error) {
+	deleted, err := r.Client.Del(ctx, mfaChallengeKey(token)).Result()
+	return deleted == 1, err
+}
+
+// UseTOTPStep отмечает шаг TOTP использованным. false означает, что код этого
+// шага уже предъявлялся и повторно не принимается.
+func (r *RedisTokenStore) UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	key := fmt.Sprintf("totp_used:%d:%d", userID, step)
+	// Шаг может быть принят, пока он в окне допуска: не дольше трёх периодов
+	return r.Client.SetNX(ctx, key, 1, 3*totpPeriod*time.Second).Result()
+}
+
+// OIDCState — данные незавершённого входа через OIDC, ключ — параметр state.
+type OIDCState struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+func (r *RedisTokenStore) SaveOIDCState(ctx context.Context, state string, data OIDCState, ttl time.Duration) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return r.Client.Set(ctx, oidcStateKey(state), payload, ttl).Err()
+}
+
+// ConsumeOIDCState возвращает и удаляет данные входа: state одноразовый,
+// повторный callback возвращает ErrTokenNotFound.
+func (r *RedisTokenStore) ConsumeOIDCState(ctx context.Context, state string) (*OIDCState, error) {
+	payload, err := r.Client.GetDel(ctx, oidcStateKey(state)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data OIDCState
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func oidcStateKey(state string) string {
+	return "oidc_state:" + HashToken(state)
 }
 
-func (r *RedisTokenStore) RefreshToken(ctx context.Context, token string) error {
-	return r.Client.Expire(ctx, token, r.TTL).Err()
+func mfaChallengeKey(token string) string {
+	return "mfa_challenge:" + HashToken(token)
 }
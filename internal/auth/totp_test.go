@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// Секрет из RFC 4226 и RFC 6238 (SHA1): ASCII "12345678901234567890"
+const (
+	rfcKey    = "12345678901234567890"
+	rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+)
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226, Appendix D
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for counter, code := range want {
+		if got := hotp([]byte(rfcKey), int64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+// RFC 6238, Appendix B, SHA1; коды укорочены до шести цифр
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestHOTPRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		if got := hotp([]byte(rfcKey), v.unix/totpPeriod); got != v.code {
+			t.Errorf("hotp(T=%d) = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		step, ok := ValidateTOTP(rfcSecret, v.code, time.Unix(v.unix, 0))
+		if !ok {
+			t.Errorf("ValidateTOTP(T=%d, %s) rejected", v.unix, v.code)
+			continue
+		}
+		if want := v.unix / totpPeriod; step != want {
+			t.Errorf("ValidateTOTP(T=%d) step = %d, want %d", v.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	// Код шага 1234567890/30 = 41152263
+	const code = "005924"
+	base := int64(41152263) * totpPeriod
+
+	tests := []struct {
+		name  string
+		shift int64
+		ok    bool
+	}{
+		{"same step", 0, true},
+		{"one step later", 1, true},
+		{"one step earlier", -1, true},
+		{"two steps later", 2, false},
+		{"two steps earlier", -2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(base+tt.shift*totpPeriod, 0)
+			step, ok := ValidateTOTP(rfcSecret, code, now)
+			if ok != tt.ok {
+				t.Fatalf("ValidateTOTP ok = %v, want %v", ok, tt.ok)
+			}
+			// Номер шага — шаг самого кода, а не текущего времени
+			if ok && step != 41152263 {
+				t.Errorf("step = %d, want 41152263", step)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPInvalidInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+	}{
+		{"wrong code", rfcSecret, "000000"},
+		{"short code", rfcSecret, "28708"},
+		{"long code", rfcSecret, "2870820"},
+		{"empty code", rfcSecret, ""},
+		{"bad secret", "not base32!", "287082"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, now); ok {
+				t.Error("ValidateTOTP accepted invalid input")
+			}
+		})
+	}
+
+	// Секрет из приложения может быть введён строчными буквами
+	if _, ok := ValidateTOTP("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "287082", now); !ok {
+		t.Error("ValidateTOTP rejected lower-case secret")
+	}
+}
+
+func TestNewTOTPSecret(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not unpadded base32: %v", secret, err)
+	}
+	if len(key) != totpSecretSize {
+		t.Errorf("secret size = %d, want %d", len(key), totpSecretSize)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	format := regexp.MustCompile(`^[0-9a-f]{5}-[0-9a-f]{5}$`)
+	for i, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q does not match xxxxx-xxxxx", code)
+		}
+		if hashes[i] != HashRecoveryCode(code) {
+			t.Errorf("hash of %q does not match", code)
+		}
+	}
+}
+
+func TestHashRecoveryCodeNormalization(t *testing.T) {
+	want := HashRecoveryCode("abcde-12345")
+	for _, input := range []string{"ABCDE-12345", " abcde-12345 ", "abcde - 12345", "AbCdE-12345\n"} {
+		if got := HashRecoveryCode(input); got != want {
+			t.Errorf("HashRecoveryCode(%q) differs from normalized code", input)
+		}
+	}
+	if HashRecoveryCode("abcde-12346") == want {
+		t.Error("different codes have the same hash")
+	}
+}
+
+// Повторное использование шага проверяется в Redis; тест запускается,
+// только если задан REDIS_ADDR.
+func TestUseTOTPStep(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+	store := NewRedisTokenStore(addr, 0, time.Minute)
+	t.Cleanup(func() { store.Client.Close() })
+
+	ctx := context.Background()
+	userID := uint(time.Now().UnixNano() % 1_000_000_000)
+	step := time.Now().Unix() / totpPeriod
+	t.Cleanup(func() {
+		store.Client.Del(ctx, fmt.Sprintf("totp_used:%d:%d", userID, step), fmt.Sprintf("totp_used:%d:%d", userID, step+1))
+	})
+
+	tests := []struct {
+		name string
+		step int64
+		want bool
+	}{
+		{"first use", step, true},
+		{"replay", step, false},
+		{"next step", step + 1, true},
+		{"replay of next step", step + 1, false},
+	}
+	for _, tt := range tests {
+		ok, err := store.UseTOTPStep(ctx, userID, tt.step)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if ok != tt.want {
+			t.Errorf("%s: UseTOTPStep = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+}
+
+func TestFailMFAChallenge(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+	store := NewRedisTokenStore(addr, 0, time.Minute)
+	t.Cleanup(func() { store.Client.Close() })
+	ctx := context.Background()
+
+	token, err := store.IssueMFAChallenge(ctx, 42, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Client.Del(ctx, mfaChallengeKey(token)) })
+
+	for i := 1; i < maxMFAAttempts; i++ {
+		if err := store.FailMFAChallenge(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ttl := store.Client.TTL(ctx, mfaChallengeKey(token)).Val(); ttl <= 0 {
+		t.Errorf("challenge TTL = %s after failed attempts", ttl)
+	}
+	if err := store.FailMFAChallenge(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetMFAChallenge(ctx, token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("challenge after %d attempts: %v, want ErrTokenNotFound", maxMFAAttempts, err)
+	}
+
+	// Неверный код к истёкшему challenge не должен создавать ключ заново
+	if err := store.FailMFAChallenge(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if n := store.Client.Exists(ctx, mfaChallengeKey(token)).Val(); n != 0 {
+		t.Error("FailMFAChallenge recreated an expired challenge")
+	}
+}
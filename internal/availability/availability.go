@@ -0,0 +1,101 @@
+package availability
+
+import (
+	"context"
+	"errors"
+	"ticketprocessing/internal/lifecycle"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnavailable  = errors.New("equipment is not available for the requested period")
+	ErrInvalidRange = errors.New("invalid date range")
+)
+
+// BookedStatuses — статусы заявок, которые занимают единицы оборудования.
+var BookedStatuses = []lifecycle.Status{lifecycle.Approved, lifecycle.CheckedOut}
+
+type Result struct {
+	EquipmentID uint  `json:"equipment_id"`
+	Total       int   `json:"total"`
+	Booked      int64 `json:"booked"`
+	Free        int64 `json:"free"`
+}
+
+// Fits сообщает, что свободных единиц хватает на quantity.
+func (r *Result) Fits(quantity int) bool {
+	return r.Free >= int64(quantity)
+}
+
+type Checker struct {
+	rentalRequestRepo repository.RentalRequestRepository
+	equipmentRepo     repository.EquipmentRepository
+}
+
+func NewChecker(rentalRequestRepo repository.RentalRequestRepository, equipmentRepo repository.EquipmentRepository) *Checker {
+	return &Checker{
+		rentalRequestRepo: rentalRequestRepo,
+		equipmentRepo:     equipmentRepo,
+	}
+}
+
+// Check считает свободные единицы оборудования на период без блокировок.
+// Подходит для предварительной проверки, окончательное решение принимает Reserve.
+func (c *Checker) Check(ctx context.Context, equipmentID uint, from, to time.Time, excludeID uint) (*Result, error) {
+	equipment, err := c.equipmentRepo.GetEquipmentByID(equipmentID)
+	if err != nil {
+		return nil, err
+	}
+	return count(ctx, c.rentalRequestRepo, equipment, from, to, excludeID)
+}
+
+// Reserve должен вызываться внутри транзакции tx. Строка оборудования блокируется
+// до её завершения, поэтому параллельные воркеры не могут одобрить последнюю
+// единицу дважды. Если свободно меньше quantity единиц, возвращается ErrUnavailable.
+func (c *Checker) Reserve(ctx context.Context, tx *gorm.DB, equipmentID uint, from, to time.Time, quantity int, excludeID uint) (*Result, error) {
+	equipment, err := c.equipmentRepo.WithTx(tx).GetEquipmentByIDForUpdate(ctx, equipmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := count(ctx, c.rentalRequestRepo.WithTx(tx), equipment, from, to, excludeID)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Fits(quantity) {
+		return result, ErrUnavailable
+	}
+	return result, nil
+}
+
+func count(ctx context.Context, repo repository.RentalRequestRepository, equipment *models.Equipment, from, to time.Time, excludeID uint) (*Result, error) {
+	booked, err := repo.SumOverlappingQuantity(ctx, equipment.ID, from, to, BookedStatusStrings(), excludeID)
+	if err != nil {
+		return nil, err
+	}
+
+	free := int64(equipment.AvailableQuantity) - booked
+	if free < 0 {
+		free = 0
+	}
+
+	return &Result{
+		EquipmentID: equipment.ID,
+		Total:       equipment.AvailableQuantity,
+		Booked:      booked,
+		Free:        free,
+	}, nil
+}
+
+// BookedStatusStrings возвращает BookedStatuses для запросов к репозиторию.
+func BookedStatusStrings() []string {
+	statuses := make([]string, len(BookedStatuses))
+	for i, status := range BookedStatuses {
+		statuses[i] = string(status)
+	}
+	return statuses
+}
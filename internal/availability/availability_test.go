@@ -0,0 +1,192 @@
+package availability
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"ticketprocessing/internal/lifecycle"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type fakeEquipmentRepo struct {
+	repository.EquipmentRepository
+	equipment map[uint]*models.Equipment
+	locked    []uint
+}
+
+func (f *fakeEquipmentRepo) GetEquipmentByID(id uint) (*models.Equipment, error) {
+	equipment, ok := f.equipment[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return equipment, nil
+}
+
+func (f *fakeEquipmentRepo) GetEquipmentByIDForUpdate(ctx context.Context, id uint) (*models.Equipment, error) {
+	f.locked = append(f.locked, id)
+	return f.GetEquipmentByID(id)
+}
+
+func (f *fakeEquipmentRepo) WithTx(tx *gorm.DB) repository.EquipmentRepository {
+	return f
+}
+
+// fakeRentalRequestRepo отбирает заявки по тому же условию, что и запросы
+// репозитория: период [from, to) пересекается с [from_date, to_date).
+type fakeRentalRequestRepo struct {
+	repository.RentalRequestRepository
+	requests []models.RentalRequest
+}
+
+func (f *fakeRentalRequestRepo) overlapping(equipmentID uint, from, to time.Time, statuses []string, excludeID uint) []models.RentalRequest {
+	var found []models.RentalRequest
+	for _, r := range f.requests {
+		if r.EquipmentID == equipmentID && r.ID != excludeID && slices.Contains(statuses, r.Status) &&
+			r.FromDate.Before(to) && r.ToDate.After(from) {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+func (f *fakeRentalRequestRepo) SumOverlappingQuantity(ctx context.Context, equipmentID uint, from, to time.Time, statuses []string, excludeID uint) (int64, error) {
+	var total int64
+	for _, r := range f.overlapping(equipmentID, from, to, statuses, excludeID) {
+		total += int64(r.Quantity)
+	}
+	return total, nil
+}
+
+func (f *fakeRentalRequestRepo) ListOverlapping(ctx context.Context, equipmentID uint, from, to time.Time, statuses []string) ([]models.RentalRequest, error) {
+	return f.overlapping(equipmentID, from, to, statuses, 0), nil
+}
+
+func (f *fakeRentalRequestRepo) WithTx(tx *gorm.DB) repository.RentalRequestRepository {
+	return f
+}
+
+func day(d int) time.Time {
+	return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC)
+}
+
+func request(id uint, status lifecycle.Status, quantity int, from, to time.Time) models.RentalRequest {
+	r := models.RentalRequest{EquipmentID: 1, Status: string(status), Quantity: quantity, FromDate: from, ToDate: to}
+	r.ID = id
+	return r
+}
+
+// Оборудование 1: три единицы. Заняты 1 единица 1–3 марта и 1 единица 2–4 марта.
+func newTestChecker() (*Checker, *fakeEquipmentRepo) {
+	equipmentRepo := &fakeEquipmentRepo{equipment: map[uint]*models.Equipment{
+		1: {AvailableQuantity: 3},
+		2: {AvailableQuantity: 1},
+	}}
+	equipmentRepo.equipment[1].ID = 1
+	equipmentRepo.equipment[2].ID = 2
+
+	requests := []models.RentalRequest{
+		request(1, lifecycle.Approved, 1, day(1), day(3)),
+		request(2, lifecycle.CheckedOut, 1, day(2), day(4)),
+		// Не занимают единиц
+		request(3, lifecycle.Pending, 2, day(1), day(5)),
+		request(4, lifecycle.AwaitingReview, 2, day(1), day(5)),
+		request(5, lifecycle.Cancelled, 2, day(1), day(5)),
+		request(6, lifecycle.Returned, 2, day(1), day(5)),
+		request(7, lifecycle.Rejected, 2, day(1), day(5)),
+	}
+	// Оборудование 2 перебронировано: занято больше, чем есть
+	other := request(8, lifecycle.Approved, 2, day(1), day(5))
+	other.EquipmentID = 2
+	requests = append(requests, other)
+
+	return NewChecker(&fakeRentalRequestRepo{requests: requests}, equipmentRepo), equipmentRepo
+}
+
+func TestBookedStatuses(t *testing.T) {
+	for _, status := range []lifecycle.Status{
+		lifecycle.Pending, lifecycle.AwaitingReview, lifecycle.Approved, lifecycle.Rejected,
+		lifecycle.CheckedOut, lifecycle.Returned, lifecycle.Cancelled, lifecycle.Expired,
+	} {
+		want := status == lifecycle.Approved || status == lifecycle.CheckedOut
+		if got := slices.Contains(BookedStatusStrings(), string(status)); got != want {
+			t.Errorf("status %s booked = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		equipmentID uint
+		from, to    time.Time
+		excludeID   uint
+		booked      int64
+		free        int64
+	}{
+		{"both bookings overlap", 1, day(2), day(3), 0, 2, 1},
+		{"one booking overlaps", 1, day(1), day(2), 0, 1, 2},
+		// Границы полуоткрытые: аренда, начинающаяся в момент возврата, не пересекается
+		{"starts when booking ends", 1, day(4), day(6), 0, 0, 3},
+		{"ends when booking starts", 1, day(0), day(1), 0, 0, 3},
+		// Изменяемая заявка не занимает место сама у себя
+		{"excluded request", 1, day(2), day(3), 2, 1, 2},
+		{"overbooked clamps to zero", 2, day(2), day(3), 0, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker, _ := newTestChecker()
+			result, err := checker.Check(context.Background(), tt.equipmentID, tt.from, tt.to, tt.excludeID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Booked != tt.booked || result.Free != tt.free {
+				t.Errorf("booked=%d free=%d, want booked=%d free=%d", result.Booked, result.Free, tt.booked, tt.free)
+			}
+			if result.EquipmentID != tt.equipmentID {
+				t.Errorf("equipment id = %d, want %d", result.EquipmentID, tt.equipmentID)
+			}
+		})
+	}
+}
+
+func TestCheckUnknownEquipment(t *testing.T) {
+	checker, _ := newTestChecker()
+	if _, err := checker.Check(context.Background(), 99, day(1), day(2), 0); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Check error = %v, want record not found", err)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to time.Time
+		quantity int
+		wantErr  error
+	}{
+		{"last free unit", day(2), day(3), 1, nil},
+		{"more than free", day(2), day(3), 2, ErrUnavailable},
+		{"all units on free days", day(5), day(6), 3, nil},
+		{"more than total", day(5), day(6), 4, ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker, equipmentRepo := newTestChecker()
+			result, err := checker.Reserve(context.Background(), nil, 1, tt.from, tt.to, tt.quantity, 0)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reserve error = %v, want %v", err, tt.wantErr)
+			}
+			// При отказе результат нужен для текста причины
+			if result == nil {
+				t.Fatal("Reserve returned no result")
+			}
+			if !slices.Equal(equipmentRepo.locked, []uint{1}) {
+				t.Errorf("locked equipment = %v, want [1]", equipmentRepo.locked)
+			}
+		})
+	}
+}
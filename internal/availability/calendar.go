@@ -0,0 +1,117 @@
+package availability
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type Granularity string
+
+const (
+	Hour Granularity = "hour"
+	Day  Granularity = "day"
+	Week Granularity = "week"
+)
+
+// MaxBuckets ограничивает размер календаря за один запрос.
+const MaxBuckets = 1000
+
+var (
+	ErrInvalidGranularity = errors.New("invalid granularity")
+	ErrTooManyBuckets     = errors.New("requested period is too long for the granularity")
+)
+
+type Bucket struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Total  int       `json:"total"`
+	Booked int64     `json:"booked"`
+	Free   int64     `json:"free"`
+}
+
+// Calendar разбивает [from, to) на интервалы и для каждого считает занятые
+// и свободные единицы. Занятыми считаются единицы всех заявок, пересекающихся с интервалом,
+// так же как при проверке в Check и Reserve.
+func (c *Checker) Calendar(ctx context.Context, equipmentID uint, from, to time.Time, granularity Granularity) ([]Bucket, error) {
+	start, err := truncate(from, granularity)
+	if err != nil {
+		return nil, err
+	}
+	if !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+
+	var bounds []time.Time
+	for t := start; t.Before(to); t = next(t, granularity) {
+		if len(bounds) == MaxBuckets {
+			return nil, ErrTooManyBuckets
+		}
+		bounds = append(bounds, t)
+	}
+
+	equipment, err := c.equipmentRepo.GetEquipmentByID(equipmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	end := next(bounds[len(bounds)-1], granularity)
+	requests, err := c.rentalRequestRepo.ListOverlapping(ctx, equipment.ID, start, end, BookedStatusStrings())
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]Bucket, len(bounds))
+	for i, bucketFrom := range bounds {
+		bucketTo := next(bucketFrom, granularity)
+
+		var booked int64
+		for _, request := range requests {
+			if request.FromDate.Before(bucketTo) && request.ToDate.After(bucketFrom) {
+				booked += int64(request.Quantity)
+			}
+		}
+
+		free := int64(equipment.AvailableQuantity) - booked
+		if free < 0 {
+			free = 0
+		}
+
+		buckets[i] = Bucket{
+			From:   bucketFrom,
+			To:     bucketTo,
+			Total:  equipment.AvailableQuantity,
+			Booked: booked,
+			Free:   free,
+		}
+	}
+
+	return buckets, nil
+}
+
+func truncate(t time.Time, granularity Granularity) (time.Time, error) {
+	switch granularity {
+	case Hour:
+		return t.Truncate(time.Hour), nil
+	case Day:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()), nil
+	case Week:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		// Неделя начинается с понедельника
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset), nil
+	default:
+		return time.Time{}, ErrInvalidGranularity
+	}
+}
+
+func next(t time.Time, granularity Granularity) time.Time {
+	switch granularity {
+	case Hour:
+		return t.Add(time.Hour)
+	case Week:
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
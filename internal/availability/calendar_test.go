@@ -0,0 +1,83 @@
+package availability
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCalendarDays(t *testing.T) {
+	checker, _ := newTestChecker()
+
+	// Начало периода округляется до начала дня
+	buckets, err := checker.Calendar(context.Background(), 1, day(1).Add(10*time.Hour), day(5), Day)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		from   time.Time
+		booked int64
+		free   int64
+	}{
+		{day(1), 1, 2},
+		{day(2), 2, 1},
+		{day(3), 1, 2},
+		{day(4), 0, 3},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("got %d buckets, want %d", len(buckets), len(want))
+	}
+	for i, w := range want {
+		b := buckets[i]
+		if !b.From.Equal(w.from) || !b.To.Equal(w.from.AddDate(0, 0, 1)) {
+			t.Errorf("bucket %d = [%s, %s), want day starting %s", i, b.From, b.To, w.from)
+		}
+		if b.Total != 3 || b.Booked != w.booked || b.Free != w.free {
+			t.Errorf("bucket %d: total=%d booked=%d free=%d, want total=3 booked=%d free=%d",
+				i, b.Total, b.Booked, b.Free, w.booked, w.free)
+		}
+	}
+}
+
+func TestCalendarWeekStartsOnMonday(t *testing.T) {
+	checker, _ := newTestChecker()
+
+	// 6 марта 2024 — среда
+	buckets, err := checker.Calendar(context.Background(), 1, day(6), day(12), Week)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(buckets))
+	}
+	if !buckets[0].From.Equal(day(4)) || !buckets[1].From.Equal(day(11)) {
+		t.Errorf("weeks start %s and %s, want Mondays %s and %s", buckets[0].From, buckets[1].From, day(4), day(11))
+	}
+	if buckets[0].Booked != 0 {
+		t.Errorf("week of %s booked = %d, want 0", day(4), buckets[0].Booked)
+	}
+}
+
+func TestCalendarErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		from, to    time.Time
+		granularity Granularity
+		want        error
+	}{
+		{"unknown granularity", day(1), day(2), "month", ErrInvalidGranularity},
+		{"empty period", day(2), day(2), Day, ErrInvalidRange},
+		{"reversed period", day(3), day(2), Day, ErrInvalidRange},
+		{"too many buckets", day(1), day(1).Add((MaxBuckets + 1) * time.Hour), Hour, ErrTooManyBuckets},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker, _ := newTestChecker()
+			if _, err := checker.Calendar(context.Background(), 1, tt.from, tt.to, tt.granularity); !errors.Is(err, tt.want) {
+				t.Errorf("Calendar error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
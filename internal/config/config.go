@@ -1,7 +1,12 @@
 package config
 
 import (
+	"encoding/base64"
+	"fmt"
+	"net"
 	"os"
+	"ticketprocessing/internal/models"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -26,23 +31,198 @@ type RabbitMQConfig struct {
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	Queue    string `yaml:"queue"`
+	// MaxAttempts — число попыток обработки, после которого сообщение уходит в DLQ
+	MaxAttempts   int   `yaml:"max_attempts"`
+	RetryDelaysMS []int `yaml:"retry_delays_ms"`
 }
 
+// Алгоритмы подписи JWT
+const (
+	JWTAlgRS256 = "RS256"
+	JWTAlgEdDSA = "EdDSA"
+)
+
 type JWTConfig struct {
-	Secret     string `yaml:"secret"`
-	TTLMinutes int    `yaml:"ttl_minutes"`
+	// Algorithm — алгоритм подписи новых ключей: RS256 или EdDSA
+	Algorithm string `yaml:"algorithm"`
+	// RotationHours — через сколько часов выпускается новый ключ подписи
+	RotationHours int `yaml:"rotation_hours"`
+	// GraceHours — сколько после ротации принимаются токены, подписанные
+	// предыдущим ключом. Должно покрывать время жизни access-токена.
+	GraceHours int `yaml:"grace_hours"`
+	// TTLMinutes — время жизни access-токена
+	TTLMinutes int `yaml:"ttl_minutes"`
+	// RefreshTTLHours — время жизни refresh-токена и сессии, продлевается при ротации
+	RefreshTTLHours int `yaml:"refresh_ttl_hours"`
+	// KeyEncryptionKey — 32 байта в base64, которыми шифруются закрытые ключи
+	// подписи в Redis. Лучше задавать через JWT_KEY_ENCRYPTION_KEY.
+	KeyEncryptionKey string `yaml:"key_encryption_key"`
+}
+
+type RBACConfig struct {
+	// AdminEmails получают роль admin при регистрации и входе
+	AdminEmails []string `yaml:"admin_emails"`
+}
+
+// Политики одобрения заявок воркером
+const (
+	// ApprovalAuto отклоняет заявки, не прошедшие автоматические проверки
+	ApprovalAuto = "auto"
+	// ApprovalReview отправляет такие заявки на рассмотрение менеджеру
+	ApprovalReview = "review"
+	// ApprovalManual отправляет менеджеру все заявки
+	ApprovalManual = "manual"
+)
+
+type ApprovalConfig struct {
+	Policy string `yaml:"policy"`
+}
+
+type RulesConfig struct {
+	// Нулевые значения отключают соответствующее правило
+	MaxDurationHours     int                   `yaml:"max_duration_hours"`
+	MaxConcurrentPerUser int                   `yaml:"max_concurrent_per_user"`
+	BlackoutDates        []BlackoutConfig      `yaml:"blackout_dates"`
+	Equipment            []EquipmentRuleConfig `yaml:"equipment"`
+}
+
+// BlackoutConfig задаёт период, в который оборудование не выдаётся.
+// Даты в формате YYYY-MM-DD, обе границы включительно.
+type BlackoutConfig struct {
+	From   string `yaml:"from"`
+	To     string `yaml:"to"`
+	Reason string `yaml:"reason"`
+}
+
+type EquipmentRuleConfig struct {
+	EquipmentID          uint `yaml:"equipment_id"`
+	MaxDurationHours     int  `yaml:"max_duration_hours"`
+	MaxConcurrentPerUser int  `yaml:"max_concurrent_per_user"`
+}
+
+type OutboxConfig struct {
+	PollIntervalMS    int `yaml:"poll_interval_ms"`
+	BatchSize         int `yaml:"batch_size"`
+	BaseBackoffMS     int `yaml:"base_backoff_ms"`
+	MaxBackoffSeconds int `yaml:"max_backoff_seconds"`
+	// Сколько секунд взятое в отправку сообщение недоступно другим релеям
+	LeaseSeconds int `yaml:"lease_seconds"`
+	// Сколько часов хранить отправленные сообщения
+	RetentionHours int `yaml:"retention_hours"`
+}
+
+// Способы отправки писем
+const (
+	MailerSMTP = "smtp"
+	MailerLog  = "log"
+	MailerFile = "file"
+)
+
+type MailerConfig struct {
+	Driver string     `yaml:"driver"`
+	From   string     `yaml:"from"`
+	SMTP   SMTPConfig `yaml:"smtp"`
+	// FilePath — файл, в который драйвер file дописывает письма
+	FilePath string `yaml:"file_path"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type AccountsConfig struct {
+	// RequireVerification запрещает вход до подтверждения email
+	RequireVerification bool `yaml:"require_verification"`
+	VerifyTTLHours      int  `yaml:"verify_ttl_hours"`
+	ResetTTLMinutes     int  `yaml:"reset_ttl_minutes"`
+	// PublicURL — адрес сервиса для ссылок в письмах
+	PublicURL string `yaml:"public_url"`
+}
+
+type MFAConfig struct {
+	// Issuer — название сервиса в приложении-аутентификаторе
+	Issuer string `yaml:"issuer"`
+	// EnforceRoles — роли, права которых действуют только при входе со вторым фактором
+	EnforceRoles []string `yaml:"enforce_roles"`
+	// GraceUntil — до этой даты пользователи из EnforceRoles без настроенного
+	// второго фактора сохраняют роль, чтобы успеть его настроить
+	GraceUntil          time.Time `yaml:"grace_until"`
+	ChallengeTTLMinutes int       `yaml:"challenge_ttl_minutes"`
+}
+
+// Ключи, по которым считаются запросы
+const (
+	RateLimitByIP   = "ip"
+	RateLimitByUser = "user"
+)
+
+type RateLimitConfig struct {
+	// Groups — лимиты групп маршрутов по имени группы; группа без лимита не ограничивается
+	Groups map[string]RateLimitRule `yaml:"groups"`
+}
+
+// RateLimitRule разрешает Limit запросов за скользящее окно WindowSeconds.
+type RateLimitRule struct {
+	Limit         int `yaml:"limit"`
+	WindowSeconds int `yaml:"window_seconds"`
+	// By — считать запросы по IP или по пользователю; анонимные запросы всегда по IP
+	By string `yaml:"by"`
+}
+
+// LockoutConfig — временная блокировка входа после неудачных попыток.
+// Каждая следующая блокировка вдвое длиннее предыдущей.
+type LockoutConfig struct {
+	Threshold   int `yaml:"threshold"`
+	BaseSeconds int `yaml:"base_seconds"`
+	MaxSeconds  int `yaml:"max_seconds"`
+	// ResetHours — через сколько часов без ошибок счётчик обнуляется
+	ResetHours int `yaml:"reset_hours"`
+}
+
+// OIDCConfig — вход через внешнего провайдера OpenID Connect
+// (authorization code + PKCE).
+type OIDCConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Issuer — адрес провайдера, по нему читается /.well-known/openid-configuration
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+	// DefaultRole — роль пользователей, созданных при первом входе
+	DefaultRole string `yaml:"default_role"`
+	// TrustIdPMFA — провайдер сам требует второй фактор, вход через него
+	// считается подтверждённым MFA
+	TrustIdPMFA bool `yaml:"trust_idp_mfa"`
 }
 
 type AppConfig struct {
 	Port int `yaml:"port"`
+	// TrustedProxies — подсети (CIDR) обратных прокси. Только от них
+	// принимается X-Forwarded-For; без них адресом клиента считается адрес
+	// соединения
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 type Config struct {
-	Postgres PostgresConfig `yaml:"postgres"`
-	Redis    RedisConfig    `yaml:"redis"`
-	RabbitMQ RabbitMQConfig `yaml:"rabbitmq"`
-	JWT      JWTConfig      `yaml:"jwt"`
-	App      AppConfig      `yaml:"app"`
+	Postgres  PostgresConfig  `yaml:"postgres"`
+	Redis     RedisConfig     `yaml:"redis"`
+	RabbitMQ  RabbitMQConfig  `yaml:"rabbitmq"`
+	JWT       JWTConfig       `yaml:"jwt"`
+	RBAC      RBACConfig      `yaml:"rbac"`
+	Approval  ApprovalConfig  `yaml:"approval"`
+	Rules     RulesConfig     `yaml:"rules"`
+	Outbox    OutboxConfig    `yaml:"outbox"`
+	Mailer    MailerConfig    `yaml:"mailer"`
+	Accounts  AccountsConfig  `yaml:"accounts"`
+	MFA       MFAConfig       `yaml:"mfa"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Lockout   LockoutConfig   `yaml:"lockout"`
+	OIDC      OIDCConfig      `yaml:"oidc"`
+	App       AppConfig       `yaml:"app"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -60,5 +240,115 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	if cfg.JWT.RefreshTTLHours == 0 {
+		cfg.JWT.RefreshTTLHours = 720
+	}
+	switch cfg.JWT.Algorithm {
+	case "":
+		cfg.JWT.Algorithm = JWTAlgEdDSA
+	case JWTAlgRS256, JWTAlgEdDSA:
+	default:
+		return nil, fmt.Errorf("unknown jwt algorithm %q", cfg.JWT.Algorithm)
+	}
+	if cfg.JWT.RotationHours == 0 {
+		cfg.JWT.RotationHours = 720
+	}
+	if cfg.JWT.GraceHours == 0 {
+		cfg.JWT.GraceHours = 24
+	}
+	if cfg.JWT.GraceHours*60 < cfg.JWT.TTLMinutes {
+		return nil, fmt.Errorf("jwt grace_hours must cover ttl_minutes")
+	}
+	if kek := os.Getenv("JWT_KEY_ENCRYPTION_KEY"); kek != "" {
+		cfg.JWT.KeyEncryptionKey = kek
+	}
+	// Ключ нужен только серверу, поэтому здесь проверяется лишь его формат
+	if cfg.JWT.KeyEncryptionKey != "" {
+		if kek, err := base64.StdEncoding.DecodeString(cfg.JWT.KeyEncryptionKey); err != nil || len(kek) != 32 {
+			return nil, fmt.Errorf("jwt key_encryption_key must be 32 bytes in base64")
+		}
+	}
+
+	switch cfg.Approval.Policy {
+	case "":
+		cfg.Approval.Policy = ApprovalAuto
+	case ApprovalAuto, ApprovalReview, ApprovalManual:
+	default:
+		return nil, fmt.Errorf("unknown approval policy %q", cfg.Approval.Policy)
+	}
+
+	switch cfg.Mailer.Driver {
+	case "":
+		cfg.Mailer.Driver = MailerLog
+	case MailerSMTP, MailerLog, MailerFile:
+	default:
+		return nil, fmt.Errorf("unknown mailer driver %q", cfg.Mailer.Driver)
+	}
+	if cfg.Mailer.FilePath == "" {
+		cfg.Mailer.FilePath = "mail.log"
+	}
+	if cfg.Accounts.VerifyTTLHours == 0 {
+		cfg.Accounts.VerifyTTLHours = 48
+	}
+	if cfg.Accounts.ResetTTLMinutes == 0 {
+		cfg.Accounts.ResetTTLMinutes = 30
+	}
+	if cfg.Accounts.PublicURL == "" {
+		cfg.Accounts.PublicURL = "http://localhost:8080"
+	}
+
+	if cfg.MFA.Issuer == "" {
+		cfg.MFA.Issuer = "Rental Service"
+	}
+	if cfg.MFA.ChallengeTTLMinutes == 0 {
+		cfg.MFA.ChallengeTTLMinutes = 5
+	}
+
+	for _, cidr := range cfg.App.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return nil, fmt.Errorf("app trusted_proxies: %w", err)
+		}
+	}
+
+	for name, rule := range cfg.RateLimit.Groups {
+		if rule.Limit <= 0 || rule.WindowSeconds <= 0 {
+			return nil, fmt.Errorf("rate limit group %q: limit and window_seconds must be positive", name)
+		}
+		switch rule.By {
+		case "":
+			rule.By = RateLimitByIP
+		case RateLimitByIP, RateLimitByUser:
+		default:
+			return nil, fmt.Errorf("rate limit group %q: unknown key %q", name, rule.By)
+		}
+		cfg.RateLimit.Groups[name] = rule
+	}
+	if cfg.Lockout.Threshold == 0 {
+		cfg.Lockout.Threshold = 5
+	}
+	if cfg.Lockout.BaseSeconds == 0 {
+		cfg.Lockout.BaseSeconds = 60
+	}
+	if cfg.Lockout.MaxSeconds == 0 {
+		cfg.Lockout.MaxSeconds = 3600
+	}
+	if cfg.Lockout.ResetHours == 0 {
+		cfg.Lockout.ResetHours = 24
+	}
+	if cfg.OIDC.Enabled {
+		if cfg.OIDC.Issuer == "" || cfg.OIDC.ClientID == "" || cfg.OIDC.RedirectURL == "" {
+			return nil, fmt.Errorf("oidc: issuer, client_id and redirect_url are required")
+		}
+		if len(cfg.OIDC.Scopes) == 0 {
+			cfg.OIDC.Scopes = []string{"openid", "email", "profile"}
+		}
+		if cfg.OIDC.DefaultRole == "" {
+			cfg.OIDC.DefaultRole = string(models.RoleUser)
+		}
+		if !models.Role(cfg.OIDC.DefaultRole).Valid() {
+			return nil, fmt.Errorf("oidc: unknown default_role %q", cfg.OIDC.DefaultRole)
+		}
+	}
+
 	return cfg, nil
 }
@@ -0,0 +1,145 @@
+package lifecycle
+
+import (
+	"context"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Change описывает запись журнала: почему и кем изменена заявка.
+type Change struct {
+	Comment string
+	// ActorID — пользователь, выполнивший действие; nil для действий системы.
+	ActorID *uint
+}
+
+// Machine — единственная точка записи статуса заявки. Обновление
+// RentalRequest и запись RequestStatusLog всегда выполняются в одной транзакции.
+// Статус и даты заказа пересчитываются по его строкам при каждом изменении строки.
+type Machine struct {
+	transactor        repository.Transactor
+	rentalRequestRepo repository.RentalRequestRepository
+	statusLogRepo     repository.RequestStatusLogRepository
+	rentalOrderRepo   repository.RentalOrderRepository
+}
+
+func NewMachine(
+	transactor repository.Transactor,
+	rentalRequestRepo repository.RentalRequestRepository,
+	statusLogRepo repository.RequestStatusLogRepository,
+	rentalOrderRepo repository.RentalOrderRepository,
+) *Machine {
+	return &Machine{
+		transactor:        transactor,
+		rentalRequestRepo: rentalRequestRepo,
+		statusLogRepo:     statusLogRepo,
+		rentalOrderRepo:   rentalOrderRepo,
+	}
+}
+
+// Create сохраняет новую заявку в статусе Pending вместе с первой записью журнала.
+func (m *Machine) Create(ctx context.Context, request *models.RentalRequest, change Change) error {
+	return m.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		return m.CreateTx(ctx, tx, request, change)
+	})
+}
+
+// CreateTx выполняет Create внутри транзакции вызывающего кода.
+func (m *Machine) CreateTx(ctx context.Context, tx *gorm.DB, request *models.RentalRequest, change Change) error {
+	request.Status = string(Pending)
+	if err := m.rentalRequestRepo.WithTx(tx).CreateRentalRequest(request); err != nil {
+		return err
+	}
+	return m.writeLog(tx, request, change)
+}
+
+// Transition блокирует заявку, проверяет переход и переводит её в статус to.
+func (m *Machine) Transition(ctx context.Context, requestID uint, to Status, change Change) (*models.RentalRequest, error) {
+	var request *models.RentalRequest
+	err := m.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		var err error
+		request, err = m.rentalRequestRepo.WithTx(tx).GetRentalRequestByIDForUpdate(ctx, requestID)
+		if err != nil {
+			return err
+		}
+		return m.TransitionTx(ctx, tx, request, to, change)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// TransitionTx выполняет переход внутри транзакции вызывающего кода.
+// Заявка должна быть прочитана в той же транзакции, желательно с блокировкой.
+// Для строки заказа блокируется и заказ, поэтому код, меняющий весь заказ,
+// должен блокировать сначала строки, а затем заказ.
+func (m *Machine) TransitionTx(ctx context.Context, tx *gorm.DB, request *models.RentalRequest, to Status, change Change) error {
+	if err := Validate(Status(request.Status), to); err != nil {
+		return err
+	}
+
+	request.Status = string(to)
+	if err := m.rentalRequestRepo.WithTx(tx).UpdateRentalRequest(request); err != nil {
+		return err
+	}
+	if err := m.writeLog(tx, request, change); err != nil {
+		return err
+	}
+
+	return m.syncOrder(ctx, tx, request)
+}
+
+// syncOrder записывает статус и даты заказа, вычисленные по его строкам.
+// Заказ блокируется до чтения строк, чтобы параллельные изменения разных
+// строк видели друг друга.
+func (m *Machine) syncOrder(ctx context.Context, tx *gorm.DB, request *models.RentalRequest) error {
+	if request.OrderID == nil {
+		return nil
+	}
+	orderID := *request.OrderID
+
+	order, err := m.rentalOrderRepo.WithTx(tx).GetOrderByIDForUpdate(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	lines, err := m.rentalRequestRepo.WithTx(tx).ListByOrderID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	from, to := OrderPeriod(lines)
+	status := OrderStatus(lines)
+	if order.Status == string(status) && order.FromDate.Equal(from) && order.ToDate.Equal(to) {
+		return nil
+	}
+	order.Status = string(status)
+	order.FromDate, order.ToDate = from, to
+	return m.rentalOrderRepo.WithTx(tx).UpdateOrder(ctx, order)
+}
+
+// AmendTx сохраняет изменения заявки без смены статуса и записывает их
+// в журнал с текущим статусом.
+func (m *Machine) AmendTx(ctx context.Context, tx *gorm.DB, request *models.RentalRequest, change Change) error {
+	if err := m.rentalRequestRepo.WithTx(tx).UpdateRentalRequest(request); err != nil {
+		return err
+	}
+	if err := m.writeLog(tx, request, change); err != nil {
+		return err
+	}
+	return m.syncOrder(ctx, tx, request)
+}
+
+func (m *Machine) writeLog(tx *gorm.DB, request *models.RentalRequest, change Change) error {
+	return m.statusLogRepo.WithTx(tx).CreateRequestStatusLog(&models.RequestStatusLog{
+		RequestID: request.ID,
+		Status:    request.Status,
+		Timestamp: time.Now(),
+		Comment:   change.Comment,
+		ActorID:   change.ActorID,
+	})
+}
@@ -0,0 +1,353 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var allStatuses = []Status{Pending, AwaitingReview, Approved, Rejected, CheckedOut, Returned, Cancelled, Expired}
+
+func TestTransitions(t *testing.T) {
+	allowed := map[Status][]Status{
+		Pending:        {AwaitingReview, Approved, Rejected, Cancelled, Expired},
+		AwaitingReview: {Pending, Approved, Rejected, Cancelled, Expired},
+		Approved:       {CheckedOut, Cancelled, Expired},
+		CheckedOut:     {Returned},
+	}
+
+	// Проверяются все пары статусов: всё, чего нет в allowed, запрещено
+	for _, from := range allStatuses {
+		for _, to := range allStatuses {
+			want := false
+			for _, next := range allowed[from] {
+				if next == to {
+					want = true
+				}
+			}
+
+			if got := CanTransition(from, to); got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+
+			err := Validate(from, to)
+			if want && err != nil {
+				t.Errorf("Validate(%s, %s) = %v, want nil", from, to, err)
+			}
+			if !want {
+				var transitionErr *TransitionError
+				if !errors.As(err, &transitionErr) || !errors.Is(err, ErrInvalidTransition) {
+					t.Errorf("Validate(%s, %s) = %v, want TransitionError", from, to, err)
+				} else if transitionErr.From != from || transitionErr.To != to {
+					t.Errorf("TransitionError = %+v, want %s -> %s", transitionErr, from, to)
+				}
+			}
+		}
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	terminal := map[Status]bool{Rejected: true, Returned: true, Cancelled: true, Expired: true}
+	for _, status := range allStatuses {
+		if got := IsTerminal(status); got != terminal[status] {
+			t.Errorf("IsTerminal(%s) = %v, want %v", status, got, terminal[status])
+		}
+	}
+}
+
+func TestStatusValid(t *testing.T) {
+	for _, status := range allStatuses {
+		if !status.Valid() {
+			t.Errorf("%s is not valid", status)
+		}
+	}
+	for _, status := range []Status{"", "active", "Approved"} {
+		if status.Valid() {
+			t.Errorf("%q is valid", status)
+		}
+	}
+}
+
+// fakeTransactor выполняет fn без транзакции и считает вызовы.
+type fakeTransactor struct {
+	calls int
+}
+
+func (f *fakeTransactor) WithinTransaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	f.calls++
+	return fn(nil)
+}
+
+type fakeRentalRequestRepo struct {
+	repository.RentalRequestRepository
+	requests map[uint]*models.RentalRequest
+	nextID   uint
+	updates  int
+}
+
+func (f *fakeRentalRequestRepo) CreateRentalRequest(request *models.RentalRequest) error {
+	f.nextID++
+	request.ID = f.nextID
+	copied := *request
+	f.requests[request.ID] = &copied
+	return nil
+}
+
+func (f *fakeRentalRequestRepo) UpdateRentalRequest(request *models.RentalRequest) error {
+	f.updates++
+	copied := *request
+	f.requests[request.ID] = &copied
+	return nil
+}
+
+func (f *fakeRentalRequestRepo) GetRentalRequestByIDForUpdate(ctx context.Context, id uint) (*models.RentalRequest, error) {
+	request, ok := f.requests[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *request
+	return &copied, nil
+}
+
+func (f *fakeRentalRequestRepo) ListByOrderID(ctx context.Context, orderID uint) ([]models.RentalRequest, error) {
+	var lines []models.RentalRequest
+	for id := uint(1); id <= f.nextID; id++ {
+		if request, ok := f.requests[id]; ok && request.OrderID != nil && *request.OrderID == orderID {
+			lines = append(lines, *request)
+		}
+	}
+	return lines, nil
+}
+
+func (f *fakeRentalRequestRepo) WithTx(tx *gorm.DB) repository.RentalRequestRepository {
+	return f
+}
+
+type fakeRentalOrderRepo struct {
+	repository.RentalOrderRepository
+	orders map[uint]*models.RentalOrder
+}
+
+func (f *fakeRentalOrderRepo) GetOrderByIDForUpdate(ctx context.Context, id uint) (*models.RentalOrder, error) {
+	order, ok := f.orders[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *order
+	return &copied, nil
+}
+
+func (f *fakeRentalOrderRepo) UpdateOrder(ctx context.Context, order *models.RentalOrder) error {
+	copied := *order
+	f.orders[order.ID] = &copied
+	return nil
+}
+
+func (f *fakeRentalOrderRepo) WithTx(tx *gorm.DB) repository.RentalOrderRepository {
+	return f
+}
+
+type fakeStatusLogRepo struct {
+	repository.RequestStatusLogRepository
+	logs []models.RequestStatusLog
+}
+
+func (f *fakeStatusLogRepo) CreateRequestStatusLog(log *models.RequestStatusLog) error {
+	f.logs = append(f.logs, *log)
+	return nil
+}
+
+func (f *fakeStatusLogRepo) WithTx(tx *gorm.DB) repository.RequestStatusLogRepository {
+	return f
+}
+
+func newTestMachine() (*Machine, *fakeTransactor, *fakeRentalRequestRepo, *fakeStatusLogRepo) {
+	transactor := &fakeTransactor{}
+	requests := &fakeRentalRequestRepo{requests: map[uint]*models.RentalRequest{}}
+	logs := &fakeStatusLogRepo{}
+	orders := &fakeRentalOrderRepo{orders: map[uint]*models.RentalOrder{}}
+	return NewMachine(transactor, requests, logs, orders), transactor, requests, logs
+}
+
+func TestMachineCreate(t *testing.T) {
+	m, transactor, requests, logs := newTestMachine()
+	actor := uint(7)
+
+	request := &models.RentalRequest{Status: string(Approved), EquipmentID: 1}
+	if err := m.Create(context.Background(), request, Change{Comment: "created", ActorID: &actor}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Статус новой заявки задаёт машина, а не вызывающий код
+	if request.Status != string(Pending) || requests.requests[request.ID].Status != string(Pending) {
+		t.Errorf("status = %s, want pending", request.Status)
+	}
+	if transactor.calls != 1 {
+		t.Errorf("transactions = %d, want 1", transactor.calls)
+	}
+	if len(logs.logs) != 1 {
+		t.Fatalf("got %d log entries, want 1", len(logs.logs))
+	}
+	log := logs.logs[0]
+	if log.RequestID != request.ID || log.Status != string(Pending) || log.Comment != "created" || log.ActorID == nil || *log.ActorID != actor {
+		t.Errorf("log entry = %+v", log)
+	}
+}
+
+func TestMachineTransition(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    Status
+		to      Status
+		wantErr error
+	}{
+		{"approve", Pending, Approved, nil},
+		{"send to review", Pending, AwaitingReview, nil},
+		{"check out", Approved, CheckedOut, nil},
+		{"reopen rejected", Rejected, Pending, ErrInvalidTransition},
+		{"return before check-out", Approved, Returned, ErrInvalidTransition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, requests, logs := newTestMachine()
+			requests.requests[1] = &models.RentalRequest{ID: 1, Status: string(tt.from)}
+
+			request, err := m.Transition(context.Background(), 1, tt.to, Change{Comment: tt.name})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Transition error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				// Запрещённый переход ничего не меняет и не пишет в журнал
+				if requests.updates != 0 || len(logs.logs) != 0 {
+					t.Errorf("rejected transition wrote %d updates and %d log entries", requests.updates, len(logs.logs))
+				}
+				if requests.requests[1].Status != string(tt.from) {
+					t.Errorf("status = %s, want %s", requests.requests[1].Status, tt.from)
+				}
+				return
+			}
+			if request.Status != string(tt.to) || requests.requests[1].Status != string(tt.to) {
+				t.Errorf("status = %s, want %s", requests.requests[1].Status, tt.to)
+			}
+			if len(logs.logs) != 1 || logs.logs[0].Status != string(tt.to) || logs.logs[0].Comment != tt.name {
+				t.Errorf("log entries = %+v", logs.logs)
+			}
+		})
+	}
+}
+
+func TestMachineTransitionNotFound(t *testing.T) {
+	m, _, _, _ := newTestMachine()
+	if _, err := m.Transition(context.Background(), 42, Approved, Change{}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Transition error = %v, want record not found", err)
+	}
+}
+
+func TestMachineAmendTx(t *testing.T) {
+	m, _, requests, logs := newTestMachine()
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	requests.requests[1] = &models.RentalRequest{ID: 1, Status: string(Approved), FromDate: from, ToDate: from.AddDate(0, 0, 1)}
+
+	request := *requests.requests[1]
+	request.ToDate = from.AddDate(0, 0, 3)
+	if err := m.AmendTx(context.Background(), nil, &request, Change{Comment: "extended"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Изменение записывается в журнал с прежним статусом
+	if !requests.requests[1].ToDate.Equal(request.ToDate) || requests.requests[1].Status != string(Approved) {
+		t.Errorf("request = %+v", requests.requests[1])
+	}
+	if len(logs.logs) != 1 || logs.logs[0].Status != string(Approved) || logs.logs[0].Comment != "extended" {
+		t.Errorf("log entries = %+v", logs.logs)
+	}
+}
+
+func TestOrderStatus(t *testing.T) {
+	tests := []struct {
+		lines []Status
+		want  Status
+	}{
+		{[]Status{Pending, Pending}, Pending},
+		{[]Status{Pending, Cancelled}, Pending},
+		{[]Status{Approved, Approved}, Approved},
+		// Заказ выдан, как только выдана хотя бы одна строка
+		{[]Status{Approved, CheckedOut}, CheckedOut},
+		// и остаётся выданным, пока не вернут все строки
+		{[]Status{Returned, CheckedOut}, CheckedOut},
+		{[]Status{Returned, Returned}, Returned},
+		{[]Status{Rejected, Cancelled}, Rejected},
+		{[]Status{Cancelled, Cancelled}, Cancelled},
+		{nil, Pending},
+	}
+	for _, tt := range tests {
+		lines := make([]models.RentalRequest, len(tt.lines))
+		for i, status := range tt.lines {
+			lines[i].Status = string(status)
+		}
+		if got := OrderStatus(lines); got != tt.want {
+			t.Errorf("OrderStatus(%v) = %s, want %s", tt.lines, got, tt.want)
+		}
+	}
+}
+
+func TestMachineTransitionSyncsOrderStatus(t *testing.T) {
+	m, _, requests, _ := newTestMachine()
+	orders := m.rentalOrderRepo.(*fakeRentalOrderRepo)
+	orderID := uint(1)
+	orders.orders[orderID] = &models.RentalOrder{ID: orderID, Status: string(Approved)}
+	for i := 0; i < 2; i++ {
+		if err := requests.CreateRentalRequest(&models.RentalRequest{OrderID: &orderID, Status: string(Approved)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		requestID uint
+		to        Status
+		want      Status
+	}{
+		{1, CheckedOut, CheckedOut},
+		{2, CheckedOut, CheckedOut},
+		{1, Returned, CheckedOut},
+		{2, Returned, Returned},
+	}
+	for _, step := range steps {
+		if _, err := m.Transition(context.Background(), step.requestID, step.to, Change{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := orders.orders[orderID].Status; got != string(step.want) {
+			t.Errorf("after request %d -> %s order status = %s, want %s", step.requestID, step.to, got, step.want)
+		}
+	}
+}
+
+func TestMachineAmendTxSyncsOrderDates(t *testing.T) {
+	m, _, requests, _ := newTestMachine()
+	orders := m.rentalOrderRepo.(*fakeRentalOrderRepo)
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	orderID := uint(1)
+	orders.orders[orderID] = &models.RentalOrder{ID: orderID, Status: string(Approved), FromDate: from, ToDate: from.AddDate(0, 0, 1)}
+	for i := 0; i < 2; i++ {
+		line := &models.RentalRequest{OrderID: &orderID, Status: string(Approved), FromDate: from, ToDate: from.AddDate(0, 0, 1)}
+		if err := requests.CreateRentalRequest(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Пока продлена только одна строка, заказ покрывает и её
+	line := *requests.requests[1]
+	line.ToDate = from.AddDate(0, 0, 3)
+	if err := m.AmendTx(context.Background(), nil, &line, Change{Comment: "extended"}); err != nil {
+		t.Fatal(err)
+	}
+	if order := orders.orders[orderID]; !order.FromDate.Equal(from) || !order.ToDate.Equal(line.ToDate) || order.Status != string(Approved) {
+		t.Errorf("order = %+v, want %s – %s approved", order, from, line.ToDate)
+	}
+}
@@ -0,0 +1,42 @@
+package lifecycle
+
+import (
+	"ticketprocessing/internal/models"
+	"time"
+)
+
+// orderStatusPriority — порядок, в котором статусы строк определяют статус
+// заказа. Пока у заказа есть незавершённые строки, он не завершён: выдача
+// части оборудования делает заказ выданным, а возврат одной строки не
+// закрывает заказ, пока не вернут остальные.
+var orderStatusPriority = []Status{
+	CheckedOut, Approved, AwaitingReview, Pending,
+	Returned, Rejected, Expired, Cancelled,
+}
+
+// OrderStatus вычисляет статус заказа по статусам его строк.
+func OrderStatus(lines []models.RentalRequest) Status {
+	seen := make(map[Status]bool, len(lines))
+	for _, line := range lines {
+		seen[Status(line.Status)] = true
+	}
+	for _, status := range orderStatusPriority {
+		if seen[status] {
+			return status
+		}
+	}
+	return Pending
+}
+
+// OrderPeriod возвращает период, который покрывают строки заказа.
+func OrderPeriod(lines []models.RentalRequest) (from, to time.Time) {
+	for i, line := range lines {
+		if i == 0 || line.FromDate.Before(from) {
+			from = line.FromDate
+		}
+		if i == 0 || line.ToDate.After(to) {
+			to = line.ToDate
+		}
+	}
+	return from, to
+}
@@ -0,0 +1,74 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Status string
+
+const (
+	Pending        Status = "pending"
+	AwaitingReview Status = "awaiting_review"
+	Approved       Status = "approved"
+	Rejected       Status = "rejected"
+	CheckedOut     Status = "checked_out"
+	Returned       Status = "returned"
+	Cancelled      Status = "cancelled"
+	Expired        Status = "expired"
+)
+
+// Valid сообщает, что статус известен системе.
+func (s Status) Valid() bool {
+	switch s {
+	case Pending, AwaitingReview, Approved, Rejected, CheckedOut, Returned, Cancelled, Expired:
+		return true
+	}
+	return false
+}
+
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// TransitionError описывает недопустимый переход и оборачивает ErrInvalidTransition.
+type TransitionError struct {
+	From Status
+	To   Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("invalid status transition from %q to %q", e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+var transitions = map[Status][]Status{
+	Pending:        {AwaitingReview, Approved, Rejected, Cancelled, Expired},
+	AwaitingReview: {Pending, Approved, Rejected, Cancelled, Expired},
+	Approved:       {CheckedOut, Cancelled, Expired},
+	CheckedOut:     {Returned},
+}
+
+// CanTransition сообщает, разрешён ли переход from -> to.
+func CanTransition(from, to Status) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate возвращает *TransitionError, если переход from -> to запрещён.
+func Validate(from, to Status) error {
+	if !CanTransition(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+	return nil
+}
+
+// IsTerminal сообщает, что из статуса нет переходов.
+func IsTerminal(status Status) bool {
+	return len(transitions[status]) == 0
+}
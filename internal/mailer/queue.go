@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+var ErrQueueFull = errors.New("mail queue is full")
+
+const queueSize = 100
+
+// Queue отправляет письма в фоне. Send только ставит письмо в очередь, поэтому
+// время ответа не зависит от SMTP-сервера и не выдаёт, было ли письмо вообще:
+// по нему нельзя узнать, зарегистрирован ли адрес. Письма, не отправленные
+// до остановки сервиса, теряются — как и ссылки в них, их можно запросить
+// повторно.
+type Queue struct {
+	next     Mailer
+	log      *slog.Logger
+	messages chan Message
+}
+
+func NewQueue(next Mailer, log *slog.Logger) *Queue {
+	return &Queue{
+		next:     next,
+		log:      log,
+		messages: make(chan Message, queueSize),
+	}
+}
+
+func (q *Queue) Send(ctx context.Context, msg Message) error {
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Run отправляет письма из очереди до отмены контекста.
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-q.messages:
+			// Начатая отправка доводится до конца и при остановке сервиса,
+			// её ограничивает собственный таймаут отправителя
+			if err := q.next.Send(context.WithoutCancel(ctx), msg); err != nil {
+				q.log.Error("failed to send email", slog.String("subject", msg.Subject), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// recordingMailer передаёт отправленные письма в канал.
+type recordingMailer struct {
+	sent chan Message
+	ctx  chan context.Context
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg Message) error {
+	m.ctx <- ctx
+	m.sent <- msg
+	return nil
+}
+
+func TestQueueDelivers(t *testing.T) {
+	next := &recordingMailer{sent: make(chan Message, 1), ctx: make(chan context.Context, 1)}
+	queue := NewQueue(next, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	want := Message{To: "user@example.com", Subject: "Сброс пароля"}
+	if err := queue.Send(context.Background(), want); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case sendCtx := <-next.ctx:
+		got := <-next.sent
+		if got != want {
+			t.Errorf("sent %+v, want %+v", got, want)
+		}
+		// Отправка не обрывается при остановке сервиса
+		cancel()
+		if sendCtx.Err() != nil {
+			t.Error("send context is canceled together with Run")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message was not sent")
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	// Run не запущен, очередь никто не разбирает
+	queue := NewQueue(&recordingMailer{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for i := range queueSize {
+		if err := queue.Send(context.Background(), Message{}); err != nil {
+			t.Fatalf("Send %d: %v", i, err)
+		}
+	}
+	if err := queue.Send(context.Background(), Message{}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Send to full queue = %v, want ErrQueueFull", err)
+	}
+}
@@ -0,0 +1,223 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"ticketprocessing/internal/config"
+	"time"
+)
+
+// smtpServer — SMTP-заглушка для одного соединения: записывает команды и
+// текст письма, на RCPT отвечает rcptReply.
+type smtpServer struct {
+	listener  net.Listener
+	auth      bool
+	rcptReply string
+
+	commands []string
+	data     string
+	done     chan struct{}
+}
+
+func newSMTPServer(t *testing.T, auth bool) *smtpServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener: listener, auth: auth, rcptReply: "250 OK", done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *smtpServer) config(username, password string) *config.MailerConfig {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	return &config.MailerConfig{
+		Driver: config.MailerSMTP,
+		From:   "noreply@example.com",
+		SMTP:   config.SMTPConfig{Host: host, Port: portNum, Username: username, Password: password},
+	}
+}
+
+func (s *smtpServer) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP test")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.commands = append(s.commands, line)
+		verb := strings.ToUpper(strings.Fields(line + " ")[0])
+
+		switch verb {
+		case "EHLO":
+			if s.auth {
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			} else {
+				reply("250 localhost")
+			}
+		case "AUTH":
+			reply("235 Authentication successful")
+		case "MAIL":
+			reply("250 OK")
+		case "RCPT":
+			reply(s.rcptReply)
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.data = data.String()
+			reply("250 OK: queued")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpServer) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("smtp session did not finish")
+	}
+}
+
+func (s *smtpServer) command(prefix string) (string, bool) {
+	for _, c := range s.commands {
+		if strings.HasPrefix(strings.ToUpper(c), prefix) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := newSMTPServer(t, false)
+	go server.serve()
+
+	msg := Message{To: "user@example.com", Subject: "Подтверждение email", Body: "Ссылка:\nhttps://example.com/verify"}
+	if err := NewSMTPMailer(server.config("", "")).Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	server.wait(t)
+
+	if c, _ := server.command("MAIL FROM"); c != "MAIL FROM:<noreply@example.com>" {
+		t.Errorf("MAIL command = %q", c)
+	}
+	if c, _ := server.command("RCPT TO"); c != "RCPT TO:<user@example.com>" {
+		t.Errorf("RCPT command = %q", c)
+	}
+	// Сервер не предлагает AUTH, учётные данные не заданы — авторизации нет
+	if c, ok := server.command("AUTH"); ok {
+		t.Errorf("unexpected %q", c)
+	}
+
+	for _, want := range []string{
+		"From: noreply@example.com\r\n",
+		"To: user@example.com\r\n",
+		"Subject: =?utf-8?q?",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"\r\n\r\nСсылка:\r\nhttps://example.com/verify",
+	} {
+		if !strings.Contains(server.data, want) {
+			t.Errorf("message does not contain %q:\n%s", want, server.data)
+		}
+	}
+}
+
+func TestSMTPMailerAuth(t *testing.T) {
+	server := newSMTPServer(t, true)
+	go server.serve()
+
+	mailer := NewSMTPMailer(server.config("mailer", "secret"))
+	if err := mailer.Send(context.Background(), Message{To: "user@example.com", Subject: "s", Body: "b"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	server.wait(t)
+
+	c, ok := server.command("AUTH PLAIN")
+	if !ok {
+		t.Fatalf("no AUTH PLAIN in %q", server.commands)
+	}
+	creds, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(c, "AUTH PLAIN "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(creds) != "\x00mailer\x00secret" {
+		t.Errorf("credentials = %q", creds)
+	}
+}
+
+func TestSMTPMailerRejectedRecipient(t *testing.T) {
+	server := newSMTPServer(t, false)
+	server.rcptReply = "550 No such user"
+	go server.serve()
+
+	err := NewSMTPMailer(server.config("", "")).Send(context.Background(), Message{To: "nobody@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "No such user") {
+		t.Errorf("Send error = %v, want rejected recipient", err)
+	}
+}
+
+func TestSMTPMailerUnreachable(t *testing.T) {
+	server := newSMTPServer(t, false)
+	cfg := server.config("", "")
+	server.listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := NewSMTPMailer(cfg).Send(ctx, Message{To: "user@example.com"}); err == nil {
+		t.Error("Send to closed port succeeded")
+	}
+}
+
+func TestComposeStripsHeaderInjection(t *testing.T) {
+	msg := Message{
+		To:      "user@example.com\r\nBcc: victim@example.com",
+		Subject: "Hello\nBcc: victim@example.com",
+		Body:    "body",
+	}
+	composed := string(compose("noreply@example.com", msg))
+	headers, _, _ := strings.Cut(composed, "\r\n\r\n")
+
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(strings.ToLower(line), "bcc:") {
+			t.Errorf("injected header %q", line)
+		}
+	}
+	if !strings.Contains(headers, "To: user@example.comBcc: victim@example.com\r\n") {
+		t.Errorf("unexpected To header in:\n%s", headers)
+	}
+}
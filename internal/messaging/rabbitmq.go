@@ -3,106 +3,177 @@ package messaging
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"ticketprocessing/internal/config"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// События, по которым воркер заново оценивает заявку
+const (
+	EventRentalRequestCreated   = "rental_request.created"
+	EventRentalRequestModified  = "rental_request.modified"
+	EventRentalRequestExtended  = "rental_request.extended"
+	EventRentalRequestCancelled = "rental_request.cancelled"
+	// Заказ оценивается целиком, RequestID в сообщении не заполняется
+	EventRentalOrderCreated   = "rental_order.created"
+	EventRentalOrderModified  = "rental_order.modified"
+	EventRentalOrderExtended  = "rental_order.extended"
+	EventRentalOrderCancelled = "rental_order.cancelled"
+)
+
 type RabbitMQPublisher interface {
-	PublishRentalRequest(ctx context.Context, requestID uint, userID uint, equipmentID uint, fromDate, toDate string) error
+	Publish(ctx context.Context, body []byte) error
 	Close() error
 }
 
+// rabbitMQPublisher держит одно соединение и канал в режиме подтверждений.
+// Если брокер закрыл канал или соединение (перезапуск, обрыв сети), об этом
+// сообщает NotifyClose, и следующий Publish подключается заново.
 type rabbitMQPublisher struct {
+	cfg *config.RabbitMQConfig
+
+	mu      sync.Mutex
 	conn    *amqp.Connection
 	channel *amqp.Channel
-	queue   string
+	closed  chan *amqp.Error
 }
 
 func NewRabbitMQPublisher(cfg *config.RabbitMQConfig) (RabbitMQPublisher, error) {
-	url := fmt.Sprintf("amqp://%s:%s@%s:%d/",
-		cfg.User,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
-	)
+	p := &rabbitMQPublisher{cfg: cfg}
+	if err := p.connect(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
 
-	conn, err := amqp.Dial(url)
+// connect открывает соединение и канал, объявляет топологию и включает
+// подтверждения публикации. Вызывать под p.mu.
+func (p *rabbitMQPublisher) connect() error {
+	conn, err := Dial(p.cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+		return err
 	}
 
 	ch, err := conn.Channel()
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to open channel: %w", err)
+		return fmt.Errorf("failed to open channel: %w", err)
 	}
 
-	// Объявляем очередь
-	_, err = ch.QueueDeclare(
-		cfg.Queue, // name
-		true,      // durable
-		false,     // delete when unused
-		false,     // exclusive
-		false,     // no-wait
-		nil,       // arguments
-	)
-	if err != nil {
+	if err := DeclareTopology(ch, p.cfg); err != nil {
 		ch.Close()
 		conn.Close()
-		return nil, fmt.Errorf("failed to declare queue: %w", err)
+		return err
+	}
+
+	// Включаем подтверждения публикации, чтобы знать, что брокер принял сообщение
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
 	}
 
-	return &rabbitMQPublisher{
-		conn:    conn,
-		channel: ch,
-		queue:   cfg.Queue,
-	}, nil
+	// Канал закрывается и при закрытии соединения, поэтому достаточно следить за ним
+	p.conn = conn
+	p.channel = ch
+	p.closed = ch.NotifyClose(make(chan *amqp.Error, 1))
+	return nil
 }
 
-type rentalRequestMessage struct {
+// ensureChannel возвращает открытый канал, при необходимости подключаясь
+// заново. Вызывать под p.mu.
+func (p *rabbitMQPublisher) ensureChannel() (*amqp.Channel, error) {
+	if p.channel != nil {
+		select {
+		case <-p.closed:
+		default:
+			return p.channel, nil
+		}
+		if !p.conn.IsClosed() {
+			p.conn.Close()
+		}
+		p.conn, p.channel = nil, nil
+	}
+
+	if err := p.connect(); err != nil {
+		return nil, fmt.Errorf("failed to reconnect to RabbitMQ: %w", err)
+	}
+	return p.channel, nil
+}
+
+type RentalRequestMessage struct {
+	Event       string `json:"event"`
 	RequestID   uint   `json:"request_id"`
+	OrderID     uint   `json:"order_id,omitempty"`
 	UserID      uint   `json:"user_id"`
 	EquipmentID uint   `json:"equipment_id"`
+	Quantity    int    `json:"quantity"`
 	FromDate    string `json:"from_date"`
 	ToDate      string `json:"to_date"`
+	// PreviousToDate заполняется для продления, чтобы воркер мог откатить его
+	PreviousToDate string `json:"previous_to_date,omitempty"`
 }
 
-func (p *rabbitMQPublisher) PublishRentalRequest(ctx context.Context, requestID uint, userID uint, equipmentID uint, fromDate, toDate string) error {
-	msg := rentalRequestMessage{
-		RequestID:   requestID,
-		UserID:      userID,
-		EquipmentID: equipmentID,
-		FromDate:    fromDate,
-		ToDate:      toDate,
+// MarshalRentalRequest формирует тело сообщения о заявке для очереди воркера.
+func MarshalRentalRequest(msg RentalRequestMessage) ([]byte, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
 	}
+	return body, nil
+}
 
-	body, err := json.Marshal(msg)
+// Publish отправляет сообщение в очередь и ждёт подтверждения от брокера.
+func (p *rabbitMQPublisher) Publish(ctx context.Context, body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch, err := p.ensureChannel()
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return err
 	}
 
-	err = p.channel.PublishWithContext(ctx,
-		"",      // exchange
-		p.queue, // routing key
-		false,   // mandatory
-		false,   // immediate
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx,
+		"",          // exchange
+		p.cfg.Queue, // routing key
+		false,       // mandatory
+		false,       // immediate
 		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Body:         body,
 		},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to publish message: %w", err)
 	}
 
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for publisher confirm: %w", err)
+	}
+	if !acked {
+		return fmt.Errorf("message was nacked by broker")
+	}
+
 	return nil
 }
 
 func (p *rabbitMQPublisher) Close() error {
-	if err := p.channel.Close(); err != nil {
-		return err
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+	// Закрытие соединения закрывает и канал
+	err := p.conn.Close()
+	p.conn, p.channel = nil, nil
+	if errors.Is(err, amqp.ErrClosed) {
+		return nil
 	}
-	return p.conn.Close()
+	return err
 }
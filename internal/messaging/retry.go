@@ -0,0 +1,153 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"ticketprocessing/internal/config"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// AttemptHeader хранит число уже неудачных попыток обработки сообщения.
+	AttemptHeader = "x-attempt"
+	// ErrorHeader хранит причину, по которой сообщение попало в DLQ.
+	ErrorHeader = "x-error"
+)
+
+const defaultMaxAttempts = 5
+
+var defaultRetryDelays = []time.Duration{
+	time.Second,
+	5 * time.Second,
+	30 * time.Second,
+	2 * time.Minute,
+}
+
+type RetryPolicy struct {
+	MaxAttempts int
+	Delays      []time.Duration
+}
+
+func NewRetryPolicy(cfg *config.RabbitMQConfig) RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts: cfg.MaxAttempts,
+		Delays:      defaultRetryDelays,
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultMaxAttempts
+	}
+	if len(cfg.RetryDelaysMS) > 0 {
+		policy.Delays = make([]time.Duration, len(cfg.RetryDelaysMS))
+		for i, ms := range cfg.RetryDelaysMS {
+			policy.Delays[i] = time.Duration(ms) * time.Millisecond
+		}
+	}
+	return policy
+}
+
+// Delay возвращает задержку перед попыткой attempt (начиная с 1). После
+// исчерпания списка используется последняя задержка.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	if attempt > len(p.Delays) {
+		attempt = len(p.Delays)
+	}
+	return p.Delays[attempt-1]
+}
+
+// Attempts читает счётчик попыток из заголовков сообщения.
+func Attempts(headers amqp.Table) int {
+	switch v := headers[AttemptHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
+
+// Retrier откладывает повторную обработку сообщений и переносит в DLQ те,
+// что исчерпали попытки. Канал должен быть в режиме подтверждений
+// (Channel.Confirm): исходное сообщение подтверждается только после того,
+// как брокер принял копию.
+type Retrier struct {
+	channel *amqp.Channel
+	queue   string
+	policy  RetryPolicy
+}
+
+func NewRetrier(ch *amqp.Channel, cfg *config.RabbitMQConfig) *Retrier {
+	return &Retrier{
+		channel: ch,
+		queue:   cfg.Queue,
+		policy:  NewRetryPolicy(cfg),
+	}
+}
+
+// Retry публикует копию сообщения в очередь задержки или, если попытки
+// исчерпаны, в DLQ. Исходное сообщение вызывающий код должен подтвердить
+// только после успешного возврата. Возвращает true, если сообщение ушло в DLQ.
+func (r *Retrier) Retry(ctx context.Context, msg amqp.Delivery, cause error) (bool, error) {
+	attempts := Attempts(msg.Headers) + 1
+	if attempts >= r.policy.MaxAttempts {
+		return true, r.DeadLetter(ctx, msg, cause)
+	}
+
+	headers := copyHeaders(msg.Headers)
+	headers[AttemptHeader] = int32(attempts)
+	headers[ErrorHeader] = cause.Error()
+
+	return false, r.publish(ctx, RetryQueue(r.queue, r.policy.Delay(attempts)), msg, headers)
+}
+
+// DeadLetter публикует копию сообщения в DLQ с причиной в заголовке.
+func (r *Retrier) DeadLetter(ctx context.Context, msg amqp.Delivery, cause error) error {
+	headers := copyHeaders(msg.Headers)
+	headers[AttemptHeader] = int32(Attempts(msg.Headers) + 1)
+	headers[ErrorHeader] = cause.Error()
+
+	return r.publish(ctx, DeadLetterQueue(r.queue), msg, headers)
+}
+
+func (r *Retrier) publish(ctx context.Context, routingKey string, msg amqp.Delivery, headers amqp.Table) error {
+	return PublishConfirmed(ctx, r.channel, routingKey, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  msg.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.MessageId,
+		Body:         msg.Body,
+	})
+}
+
+// PublishConfirmed публикует сообщение в очередь routingKey и ждёт
+// подтверждения брокера. Канал должен быть в режиме подтверждений.
+func PublishConfirmed(ctx context.Context, ch *amqp.Channel, routingKey string, msg amqp.Publishing) error {
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", routingKey, false, false, msg)
+	if err != nil {
+		return fmt.Errorf("failed to publish message to %s: %w", routingKey, err)
+	}
+	if confirmation == nil {
+		return fmt.Errorf("failed to publish message to %s: channel is not in confirm mode", routingKey)
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for publisher confirm: %w", err)
+	}
+	if !acked {
+		return fmt.Errorf("message to %s was nacked by broker", routingKey)
+	}
+	return nil
+}
+
+func copyHeaders(headers amqp.Table) amqp.Table {
+	result := amqp.Table{}
+	for k, v := range headers {
+		result[k] = v
+	}
+	return result
+}
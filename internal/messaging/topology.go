@@ -0,0 +1,102 @@
+package messaging
+
+import (
+	"fmt"
+	"ticketprocessing/internal/config"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Dial подключается к RabbitMQ по настройкам из конфига.
+func Dial(cfg *config.RabbitMQConfig) (*amqp.Connection, error) {
+	url := fmt.Sprintf("amqp://%s:%s@%s:%d/",
+		cfg.User,
+		cfg.Password,
+		cfg.Host,
+		cfg.Port,
+	)
+
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	return conn, nil
+}
+
+func DeadLetterExchange(queue string) string {
+	return queue + ".dlx"
+}
+
+func DeadLetterQueue(queue string) string {
+	return queue + ".dlq"
+}
+
+func RetryQueue(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", queue, delay.Milliseconds())
+}
+
+// DeclareTopology объявляет основную очередь, очереди задержки для повторов
+// и dead-letter очередь. Аргументы очередей должны совпадать у всех клиентов,
+// поэтому и сервер, и воркер объявляют их только через эту функцию.
+//
+// Основная очередь объявляется без аргументов, как и до появления DLQ:
+// durable-очередь нельзя переобъявить с другими аргументами, а на уже
+// работающем брокере это остановило бы и сервер, и воркер. В DLQ сообщения
+// переносит Retrier. Чтобы брокер и сам перенаправлял в DLQ отклонённые
+// сообщения, dead-letter exchange подключается политикой:
+//
+//	rabbitmqctl set_policy rental-dlx '^<queue>$' \
+//	  '{"dead-letter-exchange":"<queue>.dlx","dead-letter-routing-key":"<queue>.dlq"}' \
+//	  --apply-to queues
+//
+// Очереди задержки не имеют потребителей: по истечении TTL сообщение
+// возвращается в основную очередь.
+func DeclareTopology(ch *amqp.Channel, cfg *config.RabbitMQConfig) error {
+	dlx := DeadLetterExchange(cfg.Queue)
+	dlq := DeadLetterQueue(cfg.Queue)
+
+	if err := ch.ExchangeDeclare(dlx, amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead-letter exchange: %w", err)
+	}
+
+	if _, err := ch.QueueDeclare(dlq, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue: %w", err)
+	}
+
+	if err := ch.QueueBind(dlq, dlq, dlx, false, nil); err != nil {
+		return fmt.Errorf("failed to bind dead-letter queue: %w", err)
+	}
+
+	_, err := ch.QueueDeclare(
+		cfg.Queue, // name
+		true,      // durable
+		false,     // delete when unused
+		false,     // exclusive
+		false,     // no-wait
+		nil,       // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	for _, delay := range NewRetryPolicy(cfg).Delays {
+		_, err := ch.QueueDeclare(
+			RetryQueue(cfg.Queue, delay),
+			true,
+			false,
+			false,
+			false,
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": cfg.Queue,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to declare retry queue: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Ресурсы, к которым может относиться область действия API-ключа. Область
+// записывается как "<ресурс>:read" или "<ресурс>:write"; write включает read.
+var APIKeyResources = []string{"equipment", "categories", "rental_requests", "rental_orders"}
+
+// APIKey — ключ сервисной учётной записи для доступа без входа по паролю.
+// Сам ключ показывается один раз при выпуске, хранится только его хеш.
+type APIKey struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	UserID uint   `json:"user_id" gorm:"not null;index"`
+	Name   string `json:"name" gorm:"not null"`
+	// Prefix — начало ключа, по которому его можно узнать в списке
+	Prefix     string     `json:"prefix" gorm:"not null"`
+	KeyHash    string     `json:"-" gorm:"not null;uniqueIndex"`
+	Scopes     StringList `json:"scopes" gorm:"type:jsonb;not null;default:'[]'"`
+	CreatedBy  uint       `json:"created_by"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ValidAPIKeyScope сообщает, что область действия известна системе.
+func ValidAPIKeyScope(scope string) bool {
+	for _, resource := range APIKeyResources {
+		if scope == resource+":read" || scope == resource+":write" {
+			return true
+		}
+	}
+	return false
+}
+
+// Active сообщает, что ключ не отозван и не истёк.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Allows сообщает, что ключ даёт доступ к ресурсу на чтение или запись.
+func (k *APIKey) Allows(resource string, write bool) bool {
+	if slices.Contains(k.Scopes, resource+":write") {
+		return true
+	}
+	return !write && slices.Contains(k.Scopes, resource+":read")
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+type AssetStatus string
+
+const (
+	AssetAvailable   AssetStatus = "available"
+	AssetCheckedOut  AssetStatus = "checked_out"
+	AssetMaintenance AssetStatus = "maintenance"
+	AssetRetired     AssetStatus = "retired"
+)
+
+// Valid сообщает, что статус известен системе.
+func (s AssetStatus) Valid() bool {
+	switch s {
+	case AssetAvailable, AssetCheckedOut, AssetMaintenance, AssetRetired:
+		return true
+	}
+	return false
+}
+
+// InService сообщает, что единица учитывается в количестве оборудования.
+// Выданные единицы вернутся, а списанные и на обслуживании — нет.
+func (s AssetStatus) InService() bool {
+	return s == AssetAvailable || s == AssetCheckedOut
+}
+
+// Asset — конкретная физическая единица оборудования.
+type Asset struct {
+	ID           uint        `json:"id" gorm:"primaryKey"`
+	EquipmentID  uint        `json:"equipment_id" gorm:"not null;index"`
+	SerialNumber string      `json:"serial_number" gorm:"not null;uniqueIndex"`
+	AssetTag     string      `json:"asset_tag" gorm:"not null;uniqueIndex"`
+	Status       AssetStatus `json:"status" gorm:"not null;default:available"`
+	Location     string      `json:"location"`
+	// RequestID — заявка, по которой единица сейчас выдана
+	RequestID *uint     `json:"request_id" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AssetEvent — запись истории единицы: смена статуса, места или выдача по заявке.
+type AssetEvent struct {
+	ID        uint        `json:"id" gorm:"primaryKey"`
+	AssetID   uint        `json:"asset_id" gorm:"not null;index"`
+	Status    AssetStatus `json:"status" gorm:"not null"`
+	Location  string      `json:"location"`
+	RequestID *uint       `json:"request_id"`
+	ActorID   *uint       `json:"actor_id"`
+	Comment   string      `json:"comment"`
+	Timestamp time.Time   `json:"timestamp" gorm:"not null"`
+}
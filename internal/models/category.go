@@ -0,0 +1,48 @@
+package models
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+type AttributeType string
+
+const (
+	AttributeString  AttributeType = "string"
+	AttributeNumber  AttributeType = "number"
+	AttributeInteger AttributeType = "integer"
+	AttributeBoolean AttributeType = "boolean"
+	AttributeEnum    AttributeType = "enum"
+)
+
+// AttributeSpec описывает одно свойство оборудования категории.
+type AttributeSpec struct {
+	Type     AttributeType `json:"type"`
+	Required bool          `json:"required,omitempty"`
+	// Values — допустимые значения для типа enum
+	Values []string `json:"values,omitempty"`
+}
+
+// AttributeSchema — свойства по имени. Подкатегория наследует схемы
+// всех родителей и может переопределять их свойства.
+type AttributeSchema map[string]AttributeSpec
+
+func (s AttributeSchema) Value() (driver.Value, error) {
+	if s == nil {
+		return "{}", nil
+	}
+	return jsonValue(s)
+}
+
+func (s *AttributeSchema) Scan(src any) error {
+	return scanJSON(src, s)
+}
+
+type Category struct {
+	ID              uint            `json:"id" gorm:"primaryKey"`
+	Name            string          `json:"name" gorm:"not null"`
+	ParentID        *uint           `json:"parent_id" gorm:"index"`
+	AttributeSchema AttributeSchema `json:"attribute_schema" gorm:"type:jsonb;not null;default:'{}'"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
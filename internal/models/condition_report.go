@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type HandoverKind string
+
+const (
+	HandoverCheckOut HandoverKind = "check_out"
+	HandoverReturn   HandoverKind = "return"
+)
+
+// ConditionReport фиксирует выдачу или возврат оборудования: кто из
+// сотрудников передал его, когда и в каком состоянии.
+type ConditionReport struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	RequestID uint         `json:"request_id" gorm:"not null;index"`
+	Kind      HandoverKind `json:"kind" gorm:"not null"`
+	StaffID   uint         `json:"staff_id" gorm:"not null"`
+	Note      string       `json:"note"`
+	Damaged   bool         `json:"damaged" gorm:"not null;default:false"`
+	CreatedAt time.Time    `json:"created_at"`
+}
@@ -1,7 +1,11 @@
 package models
 
 type Equipment struct {
-	ID                uint   `json:"id" gorm:"primaryKey"`
-	Name              string `json:"name" gorm:"not null"`
-	AvailableQuantity int    `json:"available_quantity" gorm:"not null"`
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	Name              string     `json:"name" gorm:"not null"`
+	AvailableQuantity int        `json:"available_quantity" gorm:"not null"`
+	CategoryID        *uint      `json:"category_id" gorm:"index"`
+	Tags              StringList `json:"tags" gorm:"type:jsonb;not null;default:'[]'"`
+	// Attributes проверяются по схеме категории
+	Attributes Attributes `json:"attributes" gorm:"type:jsonb;not null;default:'{}'"`
 }
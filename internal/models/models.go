@@ -4,11 +4,55 @@ import (
 	"gorm.io/gorm"
 )
 
+// indexes — индексы, которые не описать тегами gorm.
+var indexes = []string{
+	// Полнотекстовый поиск по названию оборудования
+	`CREATE INDEX IF NOT EXISTS idx_equipment_name_fts ON equipment USING GIN (to_tsvector('simple', name))`,
+	// Фильтр по тегам через @>
+	`CREATE INDEX IF NOT EXISTS idx_equipment_tags ON equipment USING GIN (tags jsonb_path_ops)`,
+	// Сортировки списка оборудования вместе с id для keyset-пагинации
+	`CREATE INDEX IF NOT EXISTS idx_equipment_name_id ON equipment (name, id)`,
+	`CREATE INDEX IF NOT EXISTS idx_equipment_quantity_id ON equipment (available_quantity, id)`,
+	// Списки заявок пользователя и администратора
+	`CREATE INDEX IF NOT EXISTS idx_rental_requests_user_created ON rental_requests (user_id, created_at, id)`,
+	`CREATE INDEX IF NOT EXISTS idx_rental_requests_status_created ON rental_requests (status, created_at, id)`,
+	// Подсчёт занятых единиц на период
+	`CREATE INDEX IF NOT EXISTS idx_rental_requests_overlap ON rental_requests (equipment_id, from_date, to_date)`,
+}
+
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	// Учётные записи, созданные до появления подтверждения email, считаются
+	// подтверждёнными, иначе после включения accounts.require_verification
+	// они не смогут войти. Проставляется один раз, вместе с колонкой.
+	backfillVerified := !db.Migrator().HasColumn(&User{}, "EmailVerifiedAt")
+
+	err := db.AutoMigrate(
 		&User{},
+		&APIKey{},
+		&Category{},
 		&Equipment{},
+		&RentalOrder{},
+		&ConditionReport{},
+		&Asset{},
+		&AssetEvent{},
 		&RentalRequest{},
 		&RequestStatusLog{},
+		&OutboxMessage{},
 	)
+	if err != nil {
+		return err
+	}
+
+	if backfillVerified {
+		if err := db.Exec(`UPDATE users SET email_verified_at = now() WHERE email_verified_at IS NULL`).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, index := range indexes {
+		if err := db.Exec(index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+)
+
+type OutboxMessage struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Event         string     `json:"event" gorm:"not null"`
+	Payload       []byte     `json:"payload" gorm:"type:jsonb;not null"`
+	Status        string     `json:"status" gorm:"not null;index:idx_outbox_due,priority:1"`
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null;index:idx_outbox_due,priority:2"`
+	LastError     string     `json:"last_error"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at"`
+}
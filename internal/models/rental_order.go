@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RentalOrder объединяет заявки на разное оборудование с общими датами.
+// Заявки заказа одобряются или отклоняются только вместе.
+type RentalOrder struct {
+	ID        uint            `json:"id" gorm:"primaryKey"`
+	UserID    uint            `json:"user_id" gorm:"not null"`
+	FromDate  time.Time       `json:"from_date" gorm:"not null"`
+	ToDate    time.Time       `json:"to_date" gorm:"not null"`
+	Status    string          `json:"status" gorm:"not null"`
+	Lines     []RentalRequest `json:"lines" gorm:"foreignKey:OrderID"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
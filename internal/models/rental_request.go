@@ -7,10 +7,15 @@ import (
 type RentalRequest struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
 	UserID      uint      `json:"user_id" gorm:"not null"`
+	OrderID     *uint     `json:"order_id" gorm:"index"`
 	EquipmentID uint      `json:"equipment_id" gorm:"not null"`
+	Quantity    int       `json:"quantity" gorm:"not null;default:1"`
 	FromDate    time.Time `json:"from_date" gorm:"not null"`
 	ToDate      time.Time `json:"to_date" gorm:"not null"`
 	Status      string    `json:"status" gorm:"not null"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	// PreviousToDate задана, пока продление ждёт решения менеджера: при
+	// отказе дата окончания возвращается к ней
+	PreviousToDate *time.Time `json:"previous_to_date,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
 }
@@ -8,4 +8,5 @@ type RequestStatusLog struct {
 	Status    string    `json:"status" gorm:"not null"`
 	Timestamp time.Time `json:"timestamp" gorm:"not null"`
 	Comment   string    `json:"comment"`
+	ActorID   *uint     `json:"actor_id"`
 }
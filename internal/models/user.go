@@ -1,8 +1,49 @@
 package models
 
+import "time"
+
+type Role string
+
+const (
+	RoleUser    Role = "user"
+	RoleManager Role = "manager"
+	RoleAdmin   Role = "admin"
+)
+
+var roleRank = map[Role]int{
+	RoleUser:    1,
+	RoleManager: 2,
+	RoleAdmin:   3,
+}
+
+// Valid сообщает, что роль известна системе.
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Includes сообщает, что роль r имеет не меньше прав, чем other:
+// admin включает права manager, manager — права user.
+func (r Role) Includes(other Role) bool {
+	return r.Valid() && roleRank[r] >= roleRank[other]
+}
+
 type User struct {
 	ID           uint   `json:"id" gorm:"primaryKey"`
 	Name         string `json:"name" gorm:"not null"`
 	Email        string `json:"email" gorm:"unique;not null"`
-	PasswordHash string `json:"password_hash" gorm:"not null"`
+	PasswordHash string `json:"-" gorm:"not null"`
+	Role         Role   `json:"role" gorm:"not null;default:user"`
+	// EmailVerifiedAt пуст, пока пользователь не подтвердил адрес
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// Секрет TOTP задаётся при настройке, но проверяется только после TOTPEnabled
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled" gorm:"not null;default:false"`
+	// Хеши неиспользованных резервных кодов
+	RecoveryCodes StringList `json:"-" gorm:"type:jsonb;not null;default:'[]'"`
+	// ServiceAccount — учётная запись для скриптов: без пароля, доступ только по API-ключам
+	ServiceAccount bool `json:"service_account" gorm:"not null;default:false"`
+	// Учётная запись у провайдера OIDC, привязывается при первом входе через него
+	OIDCIssuer  *string `json:"-" gorm:"column:oidc_issuer;uniqueIndex:idx_users_oidc_subject"`
+	OIDCSubject *string `json:"-" gorm:"column:oidc_subject;uniqueIndex:idx_users_oidc_subject"`
 }
@@ -0,0 +1,300 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"ticketprocessing/internal/config"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "ticketprocessing"
+	testClientSecret = "s3cret/+"
+	testKeyID        = "test-key"
+)
+
+// mockIdP — провайдер OpenID Connect для тестов. Токен-эндпоинт проверяет
+// учётные данные клиента и отдаёт id_token, подписанный claims.
+type mockIdP struct {
+	server *httptest.Server
+	key    ed25519.PrivateKey
+	issuer string
+	claims func(issuer string) jwt.MapClaims
+	// form — параметры последнего запроса к токен-эндпоинту
+	form url.Values
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: priv}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(discovery{
+			Issuer:                idp.issuer,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwkSet{Keys: []jwk{
+			{KeyType: "OKP", KeyID: testKeyID, Use: "sig", Curve: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub)},
+			// Ключ шифрования пропускается
+			{KeyType: "RSA", KeyID: "enc", Use: "enc"},
+		}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		user, _ = url.QueryUnescape(user)
+		pass, _ = url.QueryUnescape(pass)
+		if user != testClientID || pass != testClientSecret {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		idp.form = r.PostForm
+		if r.PostForm.Get("code") != "good-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, idp.claims(idp.issuer))
+		token.Header["kid"] = testKeyID
+		idToken, err := token.SignedString(idp.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	idp.issuer = idp.server.URL
+	idp.claims = validClaims
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) provider() *Provider {
+	return NewProvider(&config.OIDCConfig{
+		Enabled:      true,
+		Issuer:       idp.issuer,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+	})
+}
+
+func validClaims(issuer string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            issuer,
+		"sub":            "user-1",
+		"aud":            testClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          "nonce-1",
+		"email":          "staff@example.com",
+		"email_verified": "true",
+		"name":           "Staff",
+		"amr":            []string{"pwd", "mfa"},
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newMockIdP(t)
+
+	raw, err := idp.provider().AuthCodeURL(context.Background(), "state-1", "nonce-1", "challenge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != idp.server.URL+"/authorize" {
+		t.Errorf("endpoint = %s", got)
+	}
+
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          "http://localhost:8080/api/auth/oidc/callback",
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "challenge-1",
+		"code_challenge_method": "S256",
+	}
+	query := u.Query()
+	for key, value := range want {
+		if got := query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp := newMockIdP(t)
+
+	claims, err := idp.provider().Exchange(context.Background(), "good-code", "verifier-1", "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "staff@example.com" || claims.Name != "Staff" {
+		t.Errorf("claims = %+v", claims)
+	}
+	// email_verified пришёл строкой
+	if !claims.EmailVerified {
+		t.Error("email_verified = false, want true")
+	}
+	if len(claims.AMR) != 2 || claims.AMR[1] != "mfa" {
+		t.Errorf("amr = %v", claims.AMR)
+	}
+
+	if got := idp.form.Get("code_verifier"); got != "verifier-1" {
+		t.Errorf("code_verifier = %q", got)
+	}
+	if got := idp.form.Get("grant_type"); got != "authorization_code" {
+		t.Errorf("grant_type = %q", got)
+	}
+	// Конфиденциальный клиент передаёт client_id только в Basic-авторизации
+	if idp.form.Has("client_id") {
+		t.Error("client_id sent in form together with basic auth")
+	}
+}
+
+func TestExchangeRejectsIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		nonce  string
+		modify func(claims jwt.MapClaims)
+	}{
+		{"nonce mismatch", "other-nonce", nil},
+		{"wrong audience", "nonce-1", func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{"wrong issuer", "nonce-1", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"expired", "nonce-1", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * clockSkew).Unix() }},
+		{"no expiry", "nonce-1", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"no subject", "nonce-1", func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.claims = func(issuer string) jwt.MapClaims {
+				claims := validClaims(issuer)
+				if tt.modify != nil {
+					tt.modify(claims)
+				}
+				return claims
+			}
+
+			_, err := idp.provider().Exchange(context.Background(), "good-code", "verifier-1", tt.nonce)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("Exchange error = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsForeignSignature(t *testing.T) {
+	idp := newMockIdP(t)
+	// Подпись ключом, которого нет в JWKS провайдера
+	_, idp.key, _ = ed25519.GenerateKey(rand.Reader)
+
+	_, err := idp.provider().Exchange(context.Background(), "good-code", "verifier-1", "nonce-1")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Exchange error = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestExchangeFailed(t *testing.T) {
+	idp := newMockIdP(t)
+
+	_, err := idp.provider().Exchange(context.Background(), "bad-code", "verifier-1", "nonce-1")
+	if !errors.Is(err, ErrExchangeFailed) || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Exchange error = %v, want ErrExchangeFailed", err)
+	}
+
+	p := idp.provider()
+	p.cfg.ClientSecret = "wrong"
+	if _, err := p.Exchange(context.Background(), "good-code", "verifier-1", "nonce-1"); !errors.Is(err, ErrExchangeFailed) {
+		t.Errorf("Exchange with wrong secret = %v, want ErrExchangeFailed", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.issuer = "https://other.example.com"
+
+	p := NewProvider(&config.OIDCConfig{Issuer: idp.server.URL, ClientID: testClientID})
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "c"); err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Errorf("AuthCodeURL error = %v, want issuer mismatch", err)
+	}
+}
+
+func TestNewPKCE(t *testing.T) {
+	pkce, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 7636: verifier от 43 до 128 символов, challenge = BASE64URL(SHA256(verifier))
+	if n := len(pkce.Verifier); n < 43 || n > 128 {
+		t.Errorf("verifier length = %d", n)
+	}
+	sum := sha256.Sum256([]byte(pkce.Verifier))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); pkce.Challenge != want {
+		t.Errorf("challenge = %q, want %q", pkce.Challenge, want)
+	}
+}
+
+func TestFlexBool(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{`true`, true},
+		{`false`, false},
+		{`"true"`, true},
+		{`"TRUE"`, true},
+		{`"false"`, false},
+		{`"yes"`, false},
+		{`null`, false},
+	}
+	for _, tt := range tests {
+		var got struct {
+			V flexBool `json:"v"`
+		}
+		if err := json.Unmarshal([]byte(`{"v":`+tt.input+`}`), &got); err != nil {
+			t.Errorf("%s: %v", tt.input, err)
+			continue
+		}
+		if bool(got.V) != tt.want {
+			t.Errorf("%s = %v, want %v", tt.input, got.V, tt.want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"ticketprocessing/internal/config"
+	"ticketprocessing/internal/messaging"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+	defaultBaseBackoff  = time.Second
+	defaultMaxBackoff   = 5 * time.Minute
+	defaultLease        = time.Minute
+	defaultRetention    = 7 * 24 * time.Hour
+
+	pruneInterval  = time.Hour
+	pruneBatchSize = 1000
+)
+
+// Relay периодически вычитывает неотправленные сообщения outbox, публикует их
+// в RabbitMQ с подтверждением и помечает отправленными. При ошибке следующая
+// попытка откладывается с экспоненциальной задержкой.
+//
+// Сообщения забираются в короткой транзакции: их next_attempt_at сдвигается
+// на время аренды, и публикация идёт уже без блокировок. Если релей упал или
+// не успел отметить сообщение до конца аренды, его отправят ещё раз, поэтому
+// доставка «как минимум один раз» и потребители должны быть идемпотентными.
+//
+// Отправленные сообщения хранятся retention и затем удаляются.
+type Relay struct {
+	transactor   repository.Transactor
+	repo         repository.OutboxRepository
+	publisher    messaging.RabbitMQPublisher
+	log          *slog.Logger
+	pollInterval time.Duration
+	batchSize    int
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	lease        time.Duration
+	retention    time.Duration
+}
+
+func NewRelay(
+	cfg *config.OutboxConfig,
+	transactor repository.Transactor,
+	repo repository.OutboxRepository,
+	publisher messaging.RabbitMQPublisher,
+	log *slog.Logger,
+) *Relay {
+	r := &Relay{
+		transactor:   transactor,
+		repo:         repo,
+		publisher:    publisher,
+		log:          log,
+		pollInterval: time.Duration(cfg.PollIntervalMS) * time.Millisecond,
+		batchSize:    cfg.BatchSize,
+		baseBackoff:  time.Duration(cfg.BaseBackoffMS) * time.Millisecond,
+		maxBackoff:   time.Duration(cfg.MaxBackoffSeconds) * time.Second,
+		lease:        time.Duration(cfg.LeaseSeconds) * time.Second,
+		retention:    time.Duration(cfg.RetentionHours) * time.Hour,
+	}
+	if r.pollInterval <= 0 {
+		r.pollInterval = defaultPollInterval
+	}
+	if r.batchSize <= 0 {
+		r.batchSize = defaultBatchSize
+	}
+	if r.baseBackoff <= 0 {
+		r.baseBackoff = defaultBaseBackoff
+	}
+	if r.maxBackoff <= 0 {
+		r.maxBackoff = defaultMaxBackoff
+	}
+	if r.lease <= 0 {
+		r.lease = defaultLease
+	}
+	if r.retention <= 0 {
+		r.retention = defaultRetention
+	}
+	return r
+}
+
+// Run работает до отмены ctx.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(pruneInterval)
+	defer pruneTicker.Stop()
+
+	for {
+		for {
+			sent, err := r.relayBatch(ctx)
+			if err != nil {
+				r.log.Error("failed to relay outbox messages", slog.String("error", err.Error()))
+				break
+			}
+			// Если пачка заполнена, сразу забираем следующую
+			if sent < r.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-pruneTicker.C:
+			r.prune(ctx)
+		}
+	}
+}
+
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	messages, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Публикация должна уложиться в аренду, иначе сообщения заберёт другой релей
+	publishCtx, cancel := context.WithTimeout(ctx, r.lease)
+	defer cancel()
+
+	for _, msg := range messages {
+		if err := r.publisher.Publish(publishCtx, msg.Payload); err != nil {
+			attempts := msg.Attempts + 1
+			nextAttemptAt := time.Now().Add(r.backoff(attempts))
+			r.log.Warn("failed to publish outbox message",
+				slog.Uint64("outbox_id", uint64(msg.ID)),
+				slog.String("event", msg.Event),
+				slog.Int("attempts", attempts),
+				slog.Time("next_attempt_at", nextAttemptAt),
+				slog.String("error", err.Error()),
+			)
+			if err := r.repo.MarkFailed(ctx, msg.ID, attempts, nextAttemptAt, err.Error()); err != nil {
+				return len(messages), err
+			}
+			continue
+		}
+
+		if err := r.repo.MarkSent(ctx, msg.ID, time.Now()); err != nil {
+			return len(messages), err
+		}
+	}
+	return len(messages), nil
+}
+
+// claim забирает пачку готовых к отправке сообщений и сдвигает их
+// next_attempt_at на время аренды. Брокер в транзакции не участвует.
+func (r *Relay) claim(ctx context.Context) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+	err := r.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		repo := r.repo.WithTx(tx)
+
+		var err error
+		messages, err = repo.LockDueMessages(ctx, time.Now(), r.batchSize)
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+
+		ids := make([]uint, 0, len(messages))
+		for _, msg := range messages {
+			ids = append(ids, msg.ID)
+		}
+		return repo.LeaseMessages(ctx, ids, time.Now().Add(r.lease))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// prune удаляет отправленные сообщения старше retention небольшими пачками,
+// чтобы не держать долгую блокировку таблицы.
+func (r *Relay) prune(ctx context.Context) {
+	before := time.Now().Add(-r.retention)
+	var total int64
+	for {
+		deleted, err := r.repo.DeleteSentBefore(ctx, before, pruneBatchSize)
+		if err != nil {
+			r.log.Error("failed to prune outbox messages", slog.String("error", err.Error()))
+			return
+		}
+		total += deleted
+		if deleted < pruneBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		r.log.Info("pruned sent outbox messages", slog.Int64("deleted", total))
+	}
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.baseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= r.maxBackoff {
+			return r.maxBackoff
+		}
+	}
+	return delay
+}
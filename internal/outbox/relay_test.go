@@ -0,0 +1,163 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"ticketprocessing/internal/config"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// fakeTransactor выполняет fn без транзакции и запоминает, открыта ли она.
+type fakeTransactor struct {
+	inTx bool
+}
+
+func (f *fakeTransactor) WithinTransaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	f.inTx = true
+	defer func() { f.inTx = false }()
+	return fn(nil)
+}
+
+type fakeOutboxRepo struct {
+	repository.OutboxRepository
+	messages map[uint]*models.OutboxMessage
+	sent     []uint
+}
+
+func (f *fakeOutboxRepo) LockDueMessages(ctx context.Context, now time.Time, limit int) ([]models.OutboxMessage, error) {
+	var due []models.OutboxMessage
+	for id := uint(1); id <= uint(len(f.messages)); id++ {
+		msg := f.messages[id]
+		if msg.Status == models.OutboxPending && !msg.NextAttemptAt.After(now) && len(due) < limit {
+			due = append(due, *msg)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeOutboxRepo) LeaseMessages(ctx context.Context, ids []uint, until time.Time) error {
+	for _, id := range ids {
+		f.messages[id].NextAttemptAt = until
+	}
+	return nil
+}
+
+func (f *fakeOutboxRepo) MarkSent(ctx context.Context, id uint, sentAt time.Time) error {
+	f.messages[id].Status = models.OutboxSent
+	f.sent = append(f.sent, id)
+	return nil
+}
+
+func (f *fakeOutboxRepo) MarkFailed(ctx context.Context, id uint, attempts int, nextAttemptAt time.Time, lastError string) error {
+	msg := f.messages[id]
+	msg.Attempts, msg.NextAttemptAt, msg.LastError = attempts, nextAttemptAt, lastError
+	return nil
+}
+
+func (f *fakeOutboxRepo) WithTx(tx *gorm.DB) repository.OutboxRepository {
+	return f
+}
+
+// fakePublisher отклоняет сообщения с телом "fail" и проверяет, что
+// публикация идёт вне транзакции.
+type fakePublisher struct {
+	transactor *fakeTransactor
+	inTx       bool
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, body []byte) error {
+	f.inTx = f.inTx || f.transactor.inTx
+	if string(body) == "fail" {
+		return errors.New("connection closed")
+	}
+	return nil
+}
+
+func (f *fakePublisher) Close() error { return nil }
+
+func TestRelayBatch(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	repo := &fakeOutboxRepo{messages: map[uint]*models.OutboxMessage{
+		1: {ID: 1, Payload: []byte("ok"), Status: models.OutboxPending, NextAttemptAt: past},
+		2: {ID: 2, Payload: []byte("fail"), Status: models.OutboxPending, NextAttemptAt: past, Attempts: 2},
+		3: {ID: 3, Payload: []byte("ok"), Status: models.OutboxPending, NextAttemptAt: time.Now().Add(time.Hour)},
+	}}
+	transactor := &fakeTransactor{}
+	publisher := &fakePublisher{transactor: transactor}
+	relay := NewRelay(&config.OutboxConfig{BaseBackoffMS: 1000, LeaseSeconds: 30}, transactor, repo, publisher,
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	processed, err := relay.relayBatch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed != 2 {
+		t.Errorf("processed %d messages, want 2", processed)
+	}
+	if publisher.inTx {
+		t.Error("published inside the claiming transaction")
+	}
+	if len(repo.sent) != 1 || repo.sent[0] != 1 {
+		t.Errorf("sent %v, want [1]", repo.sent)
+	}
+
+	// Неудачная попытка откладывается по backoff, а не до конца аренды
+	failed := repo.messages[2]
+	if failed.Status != models.OutboxPending || failed.Attempts != 3 || failed.LastError == "" {
+		t.Errorf("failed message = %+v", failed)
+	}
+	if wait := time.Until(failed.NextAttemptAt); wait < 3*time.Second || wait > 4*time.Second {
+		t.Errorf("next attempt in %s, want about 4s", wait)
+	}
+
+	// Сообщение, время которого не пришло, не трогается
+	if repo.messages[3].Status != models.OutboxPending {
+		t.Errorf("message 3 status = %s, want pending", repo.messages[3].Status)
+	}
+}
+
+func TestRelayLeasesClaimedMessages(t *testing.T) {
+	repo := &fakeOutboxRepo{messages: map[uint]*models.OutboxMessage{
+		1: {ID: 1, Payload: []byte("ok"), Status: models.OutboxPending, NextAttemptAt: time.Now()},
+	}}
+	relay := NewRelay(&config.OutboxConfig{LeaseSeconds: 30}, &fakeTransactor{}, repo, nil, nil)
+
+	messages, err := relay.claim(context.Background())
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("claim = %v, %v; want one message", messages, err)
+	}
+	if wait := time.Until(repo.messages[1].NextAttemptAt); wait < 29*time.Second {
+		t.Errorf("leased for %s, want 30s", wait)
+	}
+
+	// Пока аренда не истекла, сообщение не забирается повторно
+	if messages, err := relay.claim(context.Background()); err != nil || len(messages) != 0 {
+		t.Errorf("second claim = %v, %v; want nothing", messages, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	relay := NewRelay(&config.OutboxConfig{BaseBackoffMS: 1000, MaxBackoffSeconds: 10}, nil, nil, nil, nil)
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := relay.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
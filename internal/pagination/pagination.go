@@ -0,0 +1,144 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort")
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Request — параметры страницы из запроса. Sort — ключ сортировки,
+// "-" в начале означает обратный порядок; Cursor — значение next_cursor
+// предыдущей страницы.
+type Request struct {
+	Sort   string
+	Cursor string
+	Limit  int
+}
+
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Column — допустимое поле сортировки: колонка в запросе и значение у записи.
+type Column[T any] struct {
+	Name  string
+	Value func(item T) any
+}
+
+// Sorting описывает сортировки одной таблицы. Колонки сортировки берутся
+// только отсюда, поэтому их можно подставлять в SQL. Id добавляется
+// вторым ключом, чтобы порядок был однозначным.
+type Sorting[T any] struct {
+	Columns map[string]Column[T]
+	Default string
+	ID      func(item T) uint
+}
+
+// cursor кодируется в base64, клиенту его содержимое не важно.
+type cursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+}
+
+// Find выбирает страницу записей из query с keyset-пагинацией: следующая
+// страница начинается строго после последней записи предыдущей.
+func (s Sorting[T]) Find(query *gorm.DB, req Request) (Page[T], error) {
+	key := req.Sort
+	if key == "" {
+		key = s.Default
+	}
+	desc := strings.HasPrefix(key, "-")
+	column, ok := s.Columns[strings.TrimPrefix(key, "-")]
+	if !ok {
+		return Page[T]{}, fmt.Errorf("%w: %s", ErrInvalidSort, key)
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	direction, op := "ASC", ">"
+	if desc {
+		direction, op = "DESC", "<"
+	}
+
+	if req.Cursor != "" {
+		after, value, err := decode(req.Cursor, column)
+		if err != nil || after.Sort != key {
+			return Page[T]{}, ErrInvalidCursor
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column.Name, op), value, after.ID)
+	}
+
+	items := []T{}
+	err := query.
+		Order(fmt.Sprintf("%s %s, id %s", column.Name, direction, direction)).
+		Limit(limit + 1).
+		Find(&items).Error
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	page := Page[T]{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		last := page.Items[limit-1]
+		value, err := json.Marshal(column.Value(last))
+		if err != nil {
+			return Page[T]{}, err
+		}
+		page.NextCursor, err = encode(cursor{Sort: key, Value: value, ID: s.ID(last)})
+		if err != nil {
+			return Page[T]{}, err
+		}
+	}
+	return page, nil
+}
+
+func encode(c cursor) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decode разбирает курсор и приводит значение к типу колонки.
+func decode[T any](token string, column Column[T]) (cursor, any, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, nil, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, nil, err
+	}
+
+	var zero T
+	value := reflect.New(reflect.TypeOf(column.Value(zero)))
+	if err := json.Unmarshal(c.Value, value.Interface()); err != nil {
+		return c, nil, err
+	}
+	return c, value.Elem().Interface(), nil
+}
@@ -0,0 +1,232 @@
+package pagination
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type item struct {
+	ID        uint
+	Name      string
+	Price     float64
+	CreatedAt time.Time
+}
+
+var itemSorting = Sorting[item]{
+	Columns: map[string]Column[item]{
+		"id":         {Name: "id", Value: func(i item) any { return i.ID }},
+		"name":       {Name: "name", Value: func(i item) any { return i.Name }},
+		"price":      {Name: "price", Value: func(i item) any { return i.Price }},
+		"created_at": {Name: "created_at", Value: func(i item) any { return i.CreatedAt }},
+	},
+	Default: "-created_at",
+	ID:      func(i item) uint { return i.ID },
+}
+
+// cursorFor строит курсор так же, как Find для последней записи страницы.
+func cursorFor(t *testing.T, key string, last item) string {
+	t.Helper()
+	column := itemSorting.Columns[strings.TrimPrefix(key, "-")]
+	value, err := json.Marshal(column.Value(last))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := encode(cursor{Sort: key, Value: value, ID: last.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	last := item{
+		ID:        42,
+		Name:      "Палатка, 4 места",
+		Price:     1250.5,
+		CreatedAt: time.Date(2024, 3, 1, 12, 30, 15, 123456000, time.UTC),
+	}
+
+	tests := []struct {
+		key  string
+		want any
+	}{
+		{"id", uint(42)},
+		{"-name", "Палатка, 4 места"},
+		{"price", 1250.5},
+		{"-created_at", last.CreatedAt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			token := cursorFor(t, tt.key, last)
+			column := itemSorting.Columns[strings.TrimPrefix(tt.key, "-")]
+
+			c, value, err := decode(token, column)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if c.Sort != tt.key || c.ID != last.ID {
+				t.Errorf("cursor = %+v, want sort %q and id %d", c, tt.key, last.ID)
+			}
+			// Значение должно вернуться с типом колонки, а не как string или float64 из JSON
+			if got, ok := value.(time.Time); ok {
+				if !got.Equal(tt.want.(time.Time)) {
+					t.Errorf("value = %v, want %v", got, tt.want)
+				}
+				return
+			}
+			if value != tt.want {
+				t.Errorf("value = %#v, want %#v", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	column := itemSorting.Columns["created_at"]
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"not base64", "!!!"},
+		{"not json", "bm90IGpzb24"},
+		{"wrong value type", mustEncode(t, cursor{Sort: "created_at", Value: []byte(`"yesterday"`), ID: 1})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decode(tt.token, column); err == nil {
+				t.Error("decode accepted invalid cursor")
+			}
+		})
+	}
+}
+
+func TestFindQuery(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	last := item{ID: 7, Name: "Котелок", CreatedAt: createdAt}
+
+	tests := []struct {
+		name      string
+		req       Request
+		where     string
+		order     string
+		limit     int
+		wantValue any
+	}{
+		{
+			name:  "default sort",
+			req:   Request{},
+			order: "ORDER BY created_at DESC, id DESC",
+			limit: 21,
+		},
+		{
+			name:      "ascending after cursor",
+			req:       Request{Sort: "name", Cursor: cursorFor(t, "name", last), Limit: 5},
+			where:     "(name, id) > ($1, $2)",
+			order:     "ORDER BY name ASC, id ASC",
+			limit:     6,
+			wantValue: "Котелок",
+		},
+		{
+			name:      "descending after cursor",
+			req:       Request{Sort: "-created_at", Cursor: cursorFor(t, "-created_at", last), Limit: 1000},
+			where:     "(created_at, id) < ($1, $2)",
+			order:     "ORDER BY created_at DESC, id DESC",
+			limit:     101,
+			wantValue: createdAt,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, stmt := dryRun(t)
+			if _, err := itemSorting.Find(db.Table("items"), tt.req); err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+
+			sql := (*stmt).SQL.String()
+			for _, part := range []string{tt.where, tt.order} {
+				if !strings.Contains(sql, part) {
+					t.Errorf("query %q does not contain %q", sql, part)
+				}
+			}
+			// Выбирается на одну запись больше страницы, чтобы узнать, есть ли следующая
+			vars := (*stmt).Vars
+			if len(vars) == 0 || vars[len(vars)-1] != tt.limit {
+				t.Errorf("query vars = %v, want limit %d last", vars, tt.limit)
+			}
+			if tt.wantValue == nil {
+				return
+			}
+			if len(vars) < 3 {
+				t.Fatalf("query vars = %v", vars)
+			}
+			if got, ok := vars[0].(time.Time); ok {
+				if !got.Equal(tt.wantValue.(time.Time)) {
+					t.Errorf("cursor value = %v, want %v", got, tt.wantValue)
+				}
+			} else if vars[0] != tt.wantValue {
+				t.Errorf("cursor value = %#v, want %#v", vars[0], tt.wantValue)
+			}
+			if vars[1] != last.ID {
+				t.Errorf("cursor id = %#v, want %d", vars[1], last.ID)
+			}
+		})
+	}
+}
+
+func TestFindRejectsBadRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+		want error
+	}{
+		{"unknown sort", Request{Sort: "password"}, ErrInvalidSort},
+		{"garbage cursor", Request{Sort: "name", Cursor: "garbage"}, ErrInvalidCursor},
+		// Курсор другой сортировки нельзя применить: значение не той колонки
+		{"cursor of other sort", Request{Sort: "-name", Cursor: cursorFor(t, "name", item{ID: 1, Name: "a"})}, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := dryRun(t)
+			_, err := itemSorting.Find(db.Table("items"), tt.req)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Find error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// dryRun возвращает gorm с диалектом Postgres, который только строит SQL и
+// не подключается к базе, и последний построенный запрос.
+func dryRun(t *testing.T) (*gorm.DB, **gorm.Statement) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt := new(*gorm.Statement)
+	err = db.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) {
+		*stmt = tx.Statement
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, stmt
+}
+
+func mustEncode(t *testing.T, c cursor) string {
+	t.Helper()
+	token, err := encode(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
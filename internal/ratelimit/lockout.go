@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"ticketprocessing/internal/config"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Lockout временно блокирует вход в учётную запись после серии неудачных
+// попыток. Первая блокировка длится base, каждая следующая вдвое дольше, но
+// не дольше max. Успешный вход обнуляет счётчик.
+type Lockout struct {
+	client    *redis.Client
+	threshold int64
+	base      time.Duration
+	max       time.Duration
+	reset     time.Duration
+}
+
+func NewLockout(cfg *config.LockoutConfig, client *redis.Client) *Lockout {
+	return &Lockout{
+		client:    client,
+		threshold: int64(cfg.Threshold),
+		base:      time.Duration(cfg.BaseSeconds) * time.Second,
+		max:       time.Duration(cfg.MaxSeconds) * time.Second,
+		reset:     time.Duration(cfg.ResetHours) * time.Hour,
+	}
+}
+
+// LockedFor возвращает, сколько ещё действует блокировка; ноль — вход разрешён.
+func (l *Lockout) LockedFor(ctx context.Context, userID uint) (time.Duration, error) {
+	ttl, err := l.client.PTTL(ctx, lockKey(userID)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// Отрицательный TTL означает, что ключа нет
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Fail учитывает неудачную попытку и возвращает длительность блокировки,
+// если она наступила.
+func (l *Lockout) Fail(ctx context.Context, userID uint) (time.Duration, error) {
+	pipe := l.client.TxPipeline()
+	failures := pipe.Incr(ctx, failuresKey(userID))
+	pipe.Expire(ctx, failuresKey(userID), l.reset)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	over := failures.Val() - l.threshold
+	if over < 0 {
+		return 0, nil
+	}
+
+	duration := l.base
+	for range over {
+		duration *= 2
+		if duration >= l.max {
+			duration = l.max
+			break
+		}
+	}
+	if err := l.client.Set(ctx, lockKey(userID), 1, duration).Err(); err != nil {
+		return 0, err
+	}
+	return duration, nil
+}
+
+// Succeed обнуляет счётчик неудачных попыток.
+func (l *Lockout) Succeed(ctx context.Context, userID uint) error {
+	return l.client.Del(ctx, failuresKey(userID)).Err()
+}
+
+func failuresKey(userID uint) string {
+	return fmt.Sprintf("login_failures:%d", userID)
+}
+
+func lockKey(userID uint) string {
+	return fmt.Sprintf("login_lock:%d", userID)
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"ticketprocessing/internal/auth"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindow хранит в sorted set отметки времени принятых запросов за
+// последнее окно. Отклонённые запросы не учитываются, поэтому клиент,
+// выждавший Retry-After, сразу получает доступ.
+var slidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	return {1, limit - count - 1, 0}
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return {0, 0, tonumber(oldest[2]) + window - now}
+`)
+
+// Result — решение по одному запросу.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter — через сколько освободится место в окне; нулевой у принятых запросов
+	RetryAfter time.Duration
+}
+
+// Limiter — ограничитель запросов со скользящим окном. Счётчики лежат в
+// Redis и общие для всех экземпляров сервиса.
+type Limiter struct {
+	client *redis.Client
+}
+
+func NewLimiter(client *redis.Client) *Limiter {
+	return &Limiter{client: client}
+}
+
+// Allow учитывает запрос по ключу, если за окно их было меньше limit.
+func (l *Limiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	// Запросы в одну миллисекунду должны быть разными элементами множества
+	member, err := auth.RandomHex(8)
+	if err != nil {
+		return Result{}, err
+	}
+
+	now := time.Now().UnixMilli()
+	values, err := slidingWindow.Run(ctx, l.client, []string{"rate:" + key},
+		now, window.Milliseconds(), limit, fmt.Sprintf("%d-%s", now, member)).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Скрипт скользящего окна выполняется в Redis; тесты запускаются, только
+// если задан REDIS_ADDR.
+func testLimiter(t *testing.T) (*Limiter, string) {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	key := fmt.Sprintf("test:%s:%d", t.Name(), time.Now().UnixNano())
+	t.Cleanup(func() {
+		client.Del(context.Background(), "rate:"+key)
+		client.Close()
+	})
+	return NewLimiter(client), key
+}
+
+func TestAllowWithinLimit(t *testing.T) {
+	limiter, key := testLimiter(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		allowed   bool
+		remaining int
+	}{
+		{true, 2},
+		{true, 1},
+		{true, 0},
+		{false, 0},
+		{false, 0},
+	}
+	for i, tt := range tests {
+		res, err := limiter.Allow(ctx, key, 3, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != tt.allowed || res.Remaining != tt.remaining {
+			t.Errorf("request %d: allowed=%v remaining=%d, want allowed=%v remaining=%d",
+				i+1, res.Allowed, res.Remaining, tt.allowed, tt.remaining)
+		}
+		if res.Allowed && res.RetryAfter != 0 {
+			t.Errorf("request %d: RetryAfter = %v for allowed request", i+1, res.RetryAfter)
+		}
+		if !res.Allowed && (res.RetryAfter <= 0 || res.RetryAfter > time.Minute) {
+			t.Errorf("request %d: RetryAfter = %v, want within the window", i+1, res.RetryAfter)
+		}
+	}
+}
+
+func TestAllowWindowSlides(t *testing.T) {
+	limiter, key := testLimiter(t)
+	ctx := context.Background()
+	window := 300 * time.Millisecond
+
+	for range 2 {
+		if res, err := limiter.Allow(ctx, key, 2, window); err != nil || !res.Allowed {
+			t.Fatalf("Allow = %+v, %v; want allowed", res, err)
+		}
+	}
+	res, err := limiter.Allow(ctx, key, 2, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed {
+		t.Fatal("third request within the window was allowed")
+	}
+
+	// Отклонённые запросы окно не продлевают: после Retry-After место есть
+	time.Sleep(res.RetryAfter + 20*time.Millisecond)
+	res, err = limiter.Allow(ctx, key, 2, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed {
+		t.Errorf("request after Retry-After was rejected, RetryAfter = %v", res.RetryAfter)
+	}
+}
+
+func TestAllowKeysAreIndependent(t *testing.T) {
+	limiter, key := testLimiter(t)
+	ctx := context.Background()
+	other := key + ":other"
+	t.Cleanup(func() { limiter.client.Del(context.Background(), "rate:"+other) })
+
+	if res, err := limiter.Allow(ctx, key, 1, time.Minute); err != nil || !res.Allowed {
+		t.Fatalf("Allow = %+v, %v; want allowed", res, err)
+	}
+	if res, err := limiter.Allow(ctx, other, 1, time.Minute); err != nil || !res.Allowed {
+		t.Errorf("Allow for another key = %+v, %v; want allowed", res, err)
+	}
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"ticketprocessing/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AssetRepository interface {
+	CreateAsset(ctx context.Context, asset *models.Asset) error
+	GetAssetByID(ctx context.Context, id uint) (*models.Asset, error)
+	GetAssetByIDForUpdate(ctx context.Context, id uint) (*models.Asset, error)
+	UpdateAsset(ctx context.Context, asset *models.Asset) error
+	ListByEquipmentID(ctx context.Context, equipmentID uint) ([]models.Asset, error)
+	ListByIDsForUpdate(ctx context.Context, ids []uint) ([]models.Asset, error)
+	ListByRequestIDForUpdate(ctx context.Context, requestID uint) ([]models.Asset, error)
+	CountByEquipmentID(ctx context.Context, equipmentID uint, statuses []models.AssetStatus) (int64, error)
+	ExistsSerialOrTag(ctx context.Context, serialNumber, assetTag string, excludeID uint) (bool, error)
+	CreateEvent(ctx context.Context, event *models.AssetEvent) error
+	ListEvents(ctx context.Context, assetID uint) ([]models.AssetEvent, error)
+	WithTx(tx *gorm.DB) AssetRepository
+}
+
+type assetRepository struct {
+	db *gorm.DB
+}
+
+func NewAssetRepository(db *gorm.DB) AssetRepository {
+	return &assetRepository{db: db}
+}
+
+func (r *assetRepository) CreateAsset(ctx context.Context, asset *models.Asset) error {
+	return r.db.WithContext(ctx).Create(asset).Error
+}
+
+func (r *assetRepository) GetAssetByID(ctx context.Context, id uint) (*models.Asset, error) {
+	var asset models.Asset
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&asset).Error; err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (r *assetRepository) GetAssetByIDForUpdate(ctx context.Context, id uint) (*models.Asset, error) {
+	var asset models.Asset
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		First(&asset).Error; err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (r *assetRepository) UpdateAsset(ctx context.Context, asset *models.Asset) error {
+	return r.db.WithContext(ctx).Save(asset).Error
+}
+
+func (r *assetRepository) ListByEquipmentID(ctx context.Context, equipmentID uint) ([]models.Asset, error) {
+	var assets []models.Asset
+	err := r.db.WithContext(ctx).
+		Where("equipment_id = ?", equipmentID).
+		Order("id").
+		Find(&assets).Error
+	return assets, err
+}
+
+// ListByIDsForUpdate блокирует единицы в порядке ID, чтобы параллельные
+// выдачи не взаимоблокировались.
+func (r *assetRepository) ListByIDsForUpdate(ctx context.Context, ids []uint) ([]models.Asset, error) {
+	var assets []models.Asset
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).
+		Order("id").
+		Find(&assets).Error
+	return assets, err
+}
+
+func (r *assetRepository) ListByRequestIDForUpdate(ctx context.Context, requestID uint) ([]models.Asset, error) {
+	var assets []models.Asset
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("request_id = ?", requestID).
+		Order("id").
+		Find(&assets).Error
+	return assets, err
+}
+
+// CountByEquipmentID считает единицы оборудования; пустой statuses — все единицы.
+func (r *assetRepository) CountByEquipmentID(ctx context.Context, equipmentID uint, statuses []models.AssetStatus) (int64, error) {
+	var count int64
+	query := r.db.WithContext(ctx).
+		Model(&models.Asset{}).
+		Where("equipment_id = ?", equipmentID)
+	if len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+func (r *assetRepository) ExistsSerialOrTag(ctx context.Context, serialNumber, assetTag string, excludeID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.Asset{}).
+		Where("(serial_number = ? OR asset_tag = ?) AND id <> ?", serialNumber, assetTag, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *assetRepository) CreateEvent(ctx context.Context, event *models.AssetEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+func (r *assetRepository) ListEvents(ctx context.Context, assetID uint) ([]models.AssetEvent, error) {
+	var events []models.AssetEvent
+	err := r.db.WithContext(ctx).
+		Where("asset_id = ?", assetID).
+		Order("timestamp, id").
+		Find(&events).Error
+	return events, err
+}
+
+func (r *assetRepository) WithTx(tx *gorm.DB) AssetRepository {
+	return &assetRepository{db: tx}
+}
@@ -9,8 +9,12 @@ import (
 type AuthRepository interface {
 	CreateUser(user *models.User) error
 	GetUserByEmail(email string) (*models.User, error)
+	GetUserByID(id uint) (*models.User, error)
+	GetUsersByIDs(ids []uint) ([]models.User, error)
 	UpdateUser(user *models.User) error
 	DeleteUser(user *models.User) error
+	ListServiceAccounts() ([]models.User, error)
+	GetUserByOIDCSubject(issuer, subject string) (*models.User, error)
 }
 
 type authRepository struct {
@@ -33,6 +37,22 @@ func (r *authRepository) GetUserByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
+func (r *authRepository) GetUserByID(id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *authRepository) GetUsersByIDs(ids []uint) ([]models.User, error) {
+	var users []models.User
+	if err := r.db.Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (r *authRepository) UpdateUser(user *models.User) error {
 	return r.db.Save(user).Error
 }
@@ -40,3 +60,19 @@ func (r *authRepository) UpdateUser(user *models.User) error {
 func (r *authRepository) DeleteUser(user *models.User) error {
 	return r.db.Delete(user).Error
 }
+
+func (r *authRepository) ListServiceAccounts() ([]models.User, error) {
+	var users []models.User
+	if err := r.db.Where("service_account = ?", true).Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *authRepository) GetUserByOIDCSubject(issuer, subject string) (*models.User, error) {
+	var user models.User
+	if err := r.db.Where("oidc_issuer = ? AND oidc_subject = ?", issuer, subject).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
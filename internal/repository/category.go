@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"ticketprocessing/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type CategoryRepository interface {
+	CreateCategory(ctx context.Context, category *models.Category) error
+	GetCategoryByID(ctx context.Context, id uint) (*models.Category, error)
+	UpdateCategory(ctx context.Context, category *models.Category) error
+	DeleteCategory(ctx context.Context, category *models.Category) error
+	ListCategories(ctx context.Context) ([]models.Category, error)
+	ListDescendantIDs(ctx context.Context, id uint) ([]uint, error)
+	CountChildren(ctx context.Context, id uint) (int64, error)
+}
+
+type categoryRepository struct {
+	db *gorm.DB
+}
+
+func NewCategoryRepository(db *gorm.DB) CategoryRepository {
+	return &categoryRepository{db: db}
+}
+
+func (r *categoryRepository) CreateCategory(ctx context.Context, category *models.Category) error {
+	return r.db.WithContext(ctx).Create(category).Error
+}
+
+func (r *categoryRepository) GetCategoryByID(ctx context.Context, id uint) (*models.Category, error) {
+	var category models.Category
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&category).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r *categoryRepository) UpdateCategory(ctx context.Context, category *models.Category) error {
+	return r.db.WithContext(ctx).Save(category).Error
+}
+
+func (r *categoryRepository) DeleteCategory(ctx context.Context, category *models.Category) error {
+	return r.db.WithContext(ctx).Delete(category).Error
+}
+
+func (r *categoryRepository) ListCategories(ctx context.Context) ([]models.Category, error) {
+	var categories []models.Category
+	err := r.db.WithContext(ctx).Order("id").Find(&categories).Error
+	return categories, err
+}
+
+// ListDescendantIDs возвращает ID категории и всех её подкатегорий.
+func (r *categoryRepository) ListDescendantIDs(ctx context.Context, id uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM categories WHERE id = ?
+			UNION ALL
+			SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+		)
+		SELECT id FROM subtree`, id).
+		Scan(&ids).Error
+	return ids, err
+}
+
+func (r *categoryRepository) CountChildren(ctx context.Context, id uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.Category{}).
+		Where("parent_id = ?", id).
+		Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"ticketprocessing/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type ConditionReportRepository interface {
+	CreateReport(ctx context.Context, report *models.ConditionReport) error
+	ListByRequestID(ctx context.Context, requestID uint) ([]models.ConditionReport, error)
+	WithTx(tx *gorm.DB) ConditionReportRepository
+}
+
+type conditionReportRepository struct {
+	db *gorm.DB
+}
+
+func NewConditionReportRepository(db *gorm.DB) ConditionReportRepository {
+	return &conditionReportRepository{db: db}
+}
+
+func (r *conditionReportRepository) CreateReport(ctx context.Context, report *models.ConditionReport) error {
+	return r.db.WithContext(ctx).Create(report).Error
+}
+
+func (r *conditionReportRepository) ListByRequestID(ctx context.Context, requestID uint) ([]models.ConditionReport, error) {
+	var reports []models.ConditionReport
+	err := r.db.WithContext(ctx).
+		Where("request_id = ?", requestID).
+		Order("created_at, id").
+		Find(&reports).Error
+	return reports, err
+}
+
+func (r *conditionReportRepository) WithTx(tx *gorm.DB) ConditionReportRepository {
+	return &conditionReportRepository{db: tx}
+}
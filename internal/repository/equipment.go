@@ -1,16 +1,59 @@
 package repository
 
 import (
+	"context"
+	"strings"
 	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/pagination"
+	"time"
+	"unicode"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// EquipmentFilter отбирает оборудование для списка. Пустые поля не ограничивают выборку.
+type EquipmentFilter struct {
+	// CategoryIDs — категория вместе с подкатегориями
+	CategoryIDs []uint
+	// Tags — оборудование должно иметь все теги
+	Tags []string
+	// Attributes сравниваются с текстовым значением свойства
+	Attributes map[string]string
+	// Search — полнотекстовый поиск по названию, слова ищутся по префиксу
+	Search string
+	// Available оставляет оборудование, свободное на период
+	Available *AvailabilityFilter
+}
+
+// AvailabilityFilter требует не меньше Quantity свободных единиц на [From, To).
+// Занятыми считаются заявки в статусах BookedStatuses.
+type AvailabilityFilter struct {
+	From           time.Time
+	To             time.Time
+	Quantity       int
+	BookedStatuses []string
+}
+
+var equipmentSorting = pagination.Sorting[models.Equipment]{
+	Columns: map[string]pagination.Column[models.Equipment]{
+		"id":                 {Name: "id", Value: func(e models.Equipment) any { return e.ID }},
+		"name":               {Name: "name", Value: func(e models.Equipment) any { return e.Name }},
+		"available_quantity": {Name: "available_quantity", Value: func(e models.Equipment) any { return e.AvailableQuantity }},
+	},
+	Default: "id",
+	ID:      func(e models.Equipment) uint { return e.ID },
+}
+
 type EquipmentRepository interface {
 	CreateEquipment(equipment *models.Equipment) error
 	GetEquipmentByID(id uint) (*models.Equipment, error)
 	UpdateEquipment(equipment *models.Equipment) error
 	DeleteEquipment(equipment *models.Equipment) error
+	GetEquipmentByIDForUpdate(ctx context.Context, id uint) (*models.Equipment, error)
+	ListEquipment(ctx context.Context, filter EquipmentFilter, page pagination.Request) (pagination.Page[models.Equipment], error)
+	CountByCategoryIDs(ctx context.Context, categoryIDs []uint) (int64, error)
+	WithTx(tx *gorm.DB) EquipmentRepository
 }
 
 type equipmentRepository struct {
@@ -40,3 +83,77 @@ func (r *equipmentRepository) UpdateEquipment(equipment *models.Equipment) error
 func (r *equipmentRepository) DeleteEquipment(equipment *models.Equipment) error {
 	return r.db.Delete(equipment).Error
 }
+
+// GetEquipmentByIDForUpdate блокирует строку оборудования до конца транзакции.
+func (r *equipmentRepository) GetEquipmentByIDForUpdate(ctx context.Context, id uint) (*models.Equipment, error) {
+	var equipment models.Equipment
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		First(&equipment).Error; err != nil {
+		return nil, err
+	}
+	return &equipment, nil
+}
+
+// ListEquipment возвращает страницу оборудования. Поиск и фильтры
+// опираются на индексы из models.AutoMigrate.
+func (r *equipmentRepository) ListEquipment(ctx context.Context, filter EquipmentFilter, page pagination.Request) (pagination.Page[models.Equipment], error) {
+	query := r.db.WithContext(ctx).Model(&models.Equipment{})
+	if filter.CategoryIDs != nil {
+		query = query.Where("category_id IN ?", filter.CategoryIDs)
+	}
+	if len(filter.Tags) > 0 {
+		tags, err := models.StringList(filter.Tags).Value()
+		if err != nil {
+			return pagination.Page[models.Equipment]{}, err
+		}
+		query = query.Where("tags @> ?::jsonb", tags)
+	}
+	for key, value := range filter.Attributes {
+		query = query.Where("attributes ->> ? = ?", key, value)
+	}
+	if tsquery := prefixTSQuery(filter.Search); tsquery != "" {
+		query = query.Where("to_tsvector('simple', name) @@ to_tsquery('simple', ?)", tsquery)
+	}
+	if a := filter.Available; a != nil {
+		// Условие пересечения совпадает с SumOverlappingQuantity
+		query = query.Where(`available_quantity - COALESCE((
+			SELECT SUM(r.quantity) FROM rental_requests r
+			WHERE r.equipment_id = equipment.id AND r.status IN ? AND r.from_date < ? AND r.to_date > ?
+		), 0) >= ?`, a.BookedStatuses, a.To, a.From, a.Quantity)
+	}
+
+	return equipmentSorting.Find(query, page)
+}
+
+// prefixTSQuery превращает строку поиска в "слово:* & слово:*". Из слов
+// удаляется всё, кроме букв и цифр, чтобы ввод не ломал синтаксис tsquery.
+func prefixTSQuery(search string) string {
+	var terms []string
+	for _, word := range strings.Fields(search) {
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, word)
+		if word != "" {
+			terms = append(terms, word+":*")
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+func (r *equipmentRepository) CountByCategoryIDs(ctx context.Context, categoryIDs []uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.Equipment{}).
+		Where("category_id IN ?", categoryIDs).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *equipmentRepository) WithTx(tx *gorm.DB) EquipmentRepository {
+	return &equipmentRepository{db: tx}
+}
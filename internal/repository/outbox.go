@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"ticketprocessing/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxRepository interface {
+	CreateMessage(ctx context.Context, msg *models.OutboxMessage) error
+	LockDueMessages(ctx context.Context, now time.Time, limit int) ([]models.OutboxMessage, error)
+	LeaseMessages(ctx context.Context, ids []uint, until time.Time) error
+	MarkSent(ctx context.Context, id uint, sentAt time.Time) error
+	MarkFailed(ctx context.Context, id uint, attempts int, nextAttemptAt time.Time, lastError string) error
+	DeleteSentBefore(ctx context.Context, before time.Time, limit int) (int64, error)
+	WithTx(tx *gorm.DB) OutboxRepository
+}
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+func (r *outboxRepository) CreateMessage(ctx context.Context, msg *models.OutboxMessage) error {
+	return r.db.WithContext(ctx).Create(msg).Error
+}
+
+// LockDueMessages выбирает неотправленные сообщения, время попытки которых
+// наступило. Строки блокируются с SKIP LOCKED, поэтому несколько релеев
+// не отправят одно сообщение одновременно. Вызывать внутри транзакции.
+func (r *outboxRepository) LockDueMessages(ctx context.Context, now time.Time, limit int) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND next_attempt_at <= ?", models.OutboxPending, now).
+		Order("id").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+// LeaseMessages откладывает следующую попытку отправки сообщений до until.
+// Пока аренда не истекла, LockDueMessages их не вернёт.
+func (r *outboxRepository) LeaseMessages(ctx context.Context, ids []uint, until time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&models.OutboxMessage{}).
+		Where("id IN ?", ids).
+		Update("next_attempt_at", until).Error
+}
+
+func (r *outboxRepository) MarkSent(ctx context.Context, id uint, sentAt time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&models.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":     models.OutboxSent,
+			"sent_at":    sentAt,
+			"last_error": "",
+		}).Error
+}
+
+func (r *outboxRepository) MarkFailed(ctx context.Context, id uint, attempts int, nextAttemptAt time.Time, lastError string) error {
+	return r.db.WithContext(ctx).
+		Model(&models.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":        attempts,
+			"next_attempt_at": nextAttemptAt,
+			"last_error":      lastError,
+		}).Error
+}
+
+// DeleteSentBefore удаляет не больше limit сообщений, отправленных раньше
+// before, и возвращает число удалённых строк.
+func (r *outboxRepository) DeleteSentBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	db := r.db.WithContext(ctx)
+	sent := db.Model(&models.OutboxMessage{}).
+		Select("id").
+		Where("status = ? AND sent_at < ?", models.OutboxSent, before).
+		Order("id").
+		Limit(limit)
+	result := db.Where("id IN (?)", sent).Delete(&models.OutboxMessage{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *outboxRepository) WithTx(tx *gorm.DB) OutboxRepository {
+	return &outboxRepository{db: tx}
+}
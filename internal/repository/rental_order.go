@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"ticketprocessing/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RentalOrderRepository interface {
+	CreateOrder(ctx context.Context, order *models.RentalOrder) error
+	GetOrderByID(ctx context.Context, id uint) (*models.RentalOrder, error)
+	GetOrderByIDForUpdate(ctx context.Context, id uint) (*models.RentalOrder, error)
+	UpdateOrder(ctx context.Context, order *models.RentalOrder) error
+	WithTx(tx *gorm.DB) RentalOrderRepository
+}
+
+type rentalOrderRepository struct {
+	db *gorm.DB
+}
+
+func NewRentalOrderRepository(db *gorm.DB) RentalOrderRepository {
+	return &rentalOrderRepository{db: db}
+}
+
+// CreateOrder сохраняет только сам заказ, строки создаются через lifecycle.Machine.
+func (r *rentalOrderRepository) CreateOrder(ctx context.Context, order *models.RentalOrder) error {
+	return r.db.WithContext(ctx).Omit("Lines").Create(order).Error
+}
+
+func (r *rentalOrderRepository) GetOrderByID(ctx context.Context, id uint) (*models.RentalOrder, error) {
+	var order models.RentalOrder
+	if err := r.db.WithContext(ctx).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("id = ?", id).
+		First(&order).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *rentalOrderRepository) GetOrderByIDForUpdate(ctx context.Context, id uint) (*models.RentalOrder, error) {
+	var order models.RentalOrder
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		First(&order).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// UpdateOrder сохраняет статус и даты заказа; строки не затрагиваются.
+func (r *rentalOrderRepository) UpdateOrder(ctx context.Context, order *models.RentalOrder) error {
+	return r.db.WithContext(ctx).
+		Model(order).
+		Select("status", "from_date", "to_date").
+		Updates(order).Error
+}
+
+func (r *rentalOrderRepository) WithTx(tx *gorm.DB) RentalOrderRepository {
+	return &rentalOrderRepository{db: tx}
+}
@@ -1,16 +1,54 @@
 package repository
 
 import (
+	"context"
 	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/pagination"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// RentalRequestFilter отбирает заявки для списка. Пустые поля не ограничивают выборку.
+type RentalRequestFilter struct {
+	UserID      *uint
+	EquipmentID *uint
+	Statuses    []string
+	// From и To оставляют заявки, пересекающиеся с периодом; любую границу можно опустить
+	From *time.Time
+	To   *time.Time
+	// CreatedFrom и CreatedTo ограничивают время создания: [CreatedFrom, CreatedTo)
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
+var rentalRequestSorting = pagination.Sorting[models.RentalRequest]{
+	Columns: map[string]pagination.Column[models.RentalRequest]{
+		"id":         {Name: "id", Value: func(r models.RentalRequest) any { return r.ID }},
+		"created_at": {Name: "created_at", Value: func(r models.RentalRequest) any { return r.CreatedAt }},
+		"from_date":  {Name: "from_date", Value: func(r models.RentalRequest) any { return r.FromDate }},
+		"to_date":    {Name: "to_date", Value: func(r models.RentalRequest) any { return r.ToDate }},
+	},
+	Default: "-created_at",
+	ID:      func(r models.RentalRequest) uint { return r.ID },
+}
+
 type RentalRequestRepository interface {
 	CreateRentalRequest(request *models.RentalRequest) error
 	GetRentalRequestByID(id uint) (*models.RentalRequest, error)
 	UpdateRentalRequest(request *models.RentalRequest) error
 	DeleteRentalRequest(request *models.RentalRequest) error
+	GetRentalRequestByIDForUpdate(ctx context.Context, id uint) (*models.RentalRequest, error)
+	SumOverlappingQuantity(ctx context.Context, equipmentID uint, from, to time.Time, statuses []string, excludeID uint) (int64, error)
+	CountUserOverlapping(ctx context.Context, userID, equipmentID uint, from, to time.Time, statuses []string, excludeID uint) (int64, error)
+	ListByOrderID(ctx context.Context, orderID uint) ([]models.RentalRequest, error)
+	ListByOrderIDForUpdate(ctx context.Context, orderID uint) ([]models.RentalRequest, error)
+	ListByStatus(ctx context.Context, status string) ([]models.RentalRequest, error)
+	ListPendingExtensions(ctx context.Context, statuses []string) ([]models.RentalRequest, error)
+	ListRentalRequests(ctx context.Context, filter RentalRequestFilter, page pagination.Request) (pagination.Page[models.RentalRequest], error)
+	ListOverlapping(ctx context.Context, equipmentID uint, from, to time.Time, statuses []string) ([]models.RentalRequest, error)
+	WithTx(tx *gorm.DB) RentalRequestRepository
 }
 
 type rentalRequestRepository struct {
@@ -40,3 +78,130 @@ func (r *rentalRequestRepository) UpdateRentalRequest(request *models.RentalRequ
 func (r *rentalRequestRepository) DeleteRentalRequest(request *models.RentalRequest) error {
 	return r.db.Delete(request).Error
 }
+
+// GetRentalRequestByIDForUpdate блокирует строку заявки до конца транзакции.
+func (r *rentalRequestRepository) GetRentalRequestByIDForUpdate(ctx context.Context, id uint) (*models.RentalRequest, error) {
+	var request models.RentalRequest
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		First(&request).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// SumOverlappingQuantity считает единицы оборудования в заявках с указанными
+// статусами, период которых пересекается с [from, to). Заявка excludeID не учитывается.
+func (r *rentalRequestRepository) SumOverlappingQuantity(ctx context.Context, equipmentID uint, from, to time.Time, statuses []string, excludeID uint) (int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).
+		Model(&models.RentalRequest{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("equipment_id = ? AND status IN ? AND from_date < ? AND to_date > ? AND id <> ?",
+			equipmentID, statuses, to, from, excludeID).
+		Scan(&total).Error
+	return total, err
+}
+
+// CountUserOverlapping считает заявки пользователя в указанных статусах,
+// пересекающиеся с [from, to). Нулевой equipmentID означает любое оборудование.
+func (r *rentalRequestRepository) CountUserOverlapping(ctx context.Context, userID, equipmentID uint, from, to time.Time, statuses []string, excludeID uint) (int64, error) {
+	query := r.db.WithContext(ctx).
+		Model(&models.RentalRequest{}).
+		Where("user_id = ? AND status IN ? AND from_date < ? AND to_date > ? AND id <> ?",
+			userID, statuses, to, from, excludeID)
+	if equipmentID != 0 {
+		query = query.Where("equipment_id = ?", equipmentID)
+	}
+
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
+
+func (r *rentalRequestRepository) ListByOrderID(ctx context.Context, orderID uint) ([]models.RentalRequest, error) {
+	var requests []models.RentalRequest
+	err := r.db.WithContext(ctx).
+		Where("order_id = ?", orderID).
+		Order("equipment_id, id").
+		Find(&requests).Error
+	return requests, err
+}
+
+// ListByOrderIDForUpdate блокирует и возвращает заявки заказа. Порядок по
+// оборудованию совпадает с порядком блокировки строк оборудования, что
+// исключает взаимоблокировки между воркерами.
+func (r *rentalRequestRepository) ListByOrderIDForUpdate(ctx context.Context, orderID uint) ([]models.RentalRequest, error) {
+	var requests []models.RentalRequest
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ?", orderID).
+		Order("equipment_id, id").
+		Find(&requests).Error
+	return requests, err
+}
+
+func (r *rentalRequestRepository) ListRentalRequests(ctx context.Context, filter RentalRequestFilter, page pagination.Request) (pagination.Page[models.RentalRequest], error) {
+	query := r.db.WithContext(ctx).Model(&models.RentalRequest{})
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.EquipmentID != nil {
+		query = query.Where("equipment_id = ?", *filter.EquipmentID)
+	}
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+	if filter.From != nil {
+		query = query.Where("to_date > ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("from_date < ?", *filter.To)
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at < ?", *filter.CreatedTo)
+	}
+
+	return rentalRequestSorting.Find(query, page)
+}
+
+// ListByStatus возвращает заявки в статусе status, начиная с самых старых.
+func (r *rentalRequestRepository) ListByStatus(ctx context.Context, status string) ([]models.RentalRequest, error) {
+	var requests []models.RentalRequest
+	err := r.db.WithContext(ctx).
+		Where("status = ?", status).
+		Order("created_at, id").
+		Find(&requests).Error
+	return requests, err
+}
+
+// ListPendingExtensions возвращает заявки в статусах statuses, продление
+// которых ждёт решения менеджера, начиная с самых старых.
+func (r *rentalRequestRepository) ListPendingExtensions(ctx context.Context, statuses []string) ([]models.RentalRequest, error) {
+	var requests []models.RentalRequest
+	err := r.db.WithContext(ctx).
+		Where("previous_to_date IS NOT NULL AND status IN ?", statuses).
+		Order("created_at, id").
+		Find(&requests).Error
+	return requests, err
+}
+
+// ListOverlapping возвращает заявки на оборудование в указанных статусах,
+// период которых пересекается с [from, to), упорядоченные по началу аренды.
+func (r *rentalRequestRepository) ListOverlapping(ctx context.Context, equipmentID uint, from, to time.Time, statuses []string) ([]models.RentalRequest, error) {
+	var requests []models.RentalRequest
+	err := r.db.WithContext(ctx).
+		Where("equipment_id = ? AND status IN ? AND from_date < ? AND to_date > ?",
+			equipmentID, statuses, to, from).
+		Order("from_date").
+		Find(&requests).Error
+	return requests, err
+}
+
+func (r *rentalRequestRepository) WithTx(tx *gorm.DB) RentalRequestRepository {
+	return &rentalRequestRepository{db: tx}
+}
@@ -15,6 +15,8 @@ type RequestStatusLogRepository interface {
 	DeleteRequestStatusLog(log *models.RequestStatusLog) error
 	GetLatestStatusByRequestID(ctx context.Context, requestID uint, log *models.RequestStatusLog) error
 	GetStatusAt(ctx context.Context, requestID uint, datetime time.Time, log *models.RequestStatusLog) error
+	ListByRequestID(ctx context.Context, requestID uint) ([]models.RequestStatusLog, error)
+	WithTx(tx *gorm.DB) RequestStatusLogRepository
 }
 
 type requestStatusLogRepository struct {
@@ -56,3 +58,16 @@ func (r *requestStatusLogRepository) GetStatusAt(ctx context.Context, requestID
 		Order("timestamp DESC").
 		First(log).Error
 }
+
+func (r *requestStatusLogRepository) ListByRequestID(ctx context.Context, requestID uint) ([]models.RequestStatusLog, error) {
+	var logs []models.RequestStatusLog
+	err := r.db.WithContext(ctx).
+		Where("request_id = ?", requestID).
+		Order("timestamp, id").
+		Find(&logs).Error
+	return logs, err
+}
+
+func (r *requestStatusLogRepository) WithTx(tx *gorm.DB) RequestStatusLogRepository {
+	return &requestStatusLogRepository{db: tx}
+}
@@ -0,0 +1,174 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ticketprocessing/internal/availability"
+	"ticketprocessing/internal/config"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FromConfig собирает конвейер из настроек. Проверка доступности оборудования
+// включена всегда и идёт последней: она блокирует строку оборудования до
+// конца транзакции, в которой заявка будет одобрена.
+func FromConfig(cfg *config.RulesConfig, rentalRequestRepo repository.RentalRequestRepository, checker *availability.Checker) (*Pipeline, error) {
+	var rules []Rule
+
+	if cfg.MaxDurationHours > 0 {
+		rules = append(rules, &MaxDuration{Limit: time.Duration(cfg.MaxDurationHours) * time.Hour})
+	}
+
+	if cfg.MaxConcurrentPerUser > 0 {
+		rules = append(rules, &MaxConcurrent{Limit: cfg.MaxConcurrentPerUser, repo: rentalRequestRepo})
+	}
+
+	if len(cfg.BlackoutDates) > 0 {
+		blackout := &Blackout{}
+		for _, b := range cfg.BlackoutDates {
+			from, err := time.Parse(time.DateOnly, b.From)
+			if err != nil {
+				return nil, fmt.Errorf("invalid blackout from date %q: %w", b.From, err)
+			}
+			to, err := time.Parse(time.DateOnly, b.To)
+			if err != nil {
+				return nil, fmt.Errorf("invalid blackout to date %q: %w", b.To, err)
+			}
+			blackout.Periods = append(blackout.Periods, BlackoutPeriod{
+				From:   from,
+				To:     to.AddDate(0, 0, 1),
+				Reason: b.Reason,
+			})
+		}
+		rules = append(rules, blackout)
+	}
+
+	if len(cfg.Equipment) > 0 {
+		limits := &EquipmentLimits{Limits: map[uint]config.EquipmentRuleConfig{}, repo: rentalRequestRepo}
+		for _, l := range cfg.Equipment {
+			limits.Limits[l.EquipmentID] = l
+		}
+		rules = append(rules, limits)
+	}
+
+	rules = append(rules, &Availability{checker: checker})
+
+	return NewPipeline(rules...), nil
+}
+
+// MaxDuration ограничивает длительность аренды.
+type MaxDuration struct {
+	Limit time.Duration
+}
+
+func (r *MaxDuration) Name() string { return "max_duration" }
+
+func (r *MaxDuration) Evaluate(ctx context.Context, tx *gorm.DB, request *models.RentalRequest) (Verdict, error) {
+	duration := request.ToDate.Sub(request.FromDate)
+	if duration > r.Limit {
+		return fail("rental lasts %s, limit is %s", duration, r.Limit)
+	}
+	return pass("rental lasts %s", duration)
+}
+
+// MaxConcurrent ограничивает число одобренных и выданных пользователю заявок,
+// пересекающихся с периодом новой заявки.
+type MaxConcurrent struct {
+	Limit int
+	repo  repository.RentalRequestRepository
+}
+
+func (r *MaxConcurrent) Name() string { return "max_concurrent_per_user" }
+
+func (r *MaxConcurrent) Evaluate(ctx context.Context, tx *gorm.DB, request *models.RentalRequest) (Verdict, error) {
+	count, err := r.repo.WithTx(tx).CountUserOverlapping(ctx, request.UserID, 0, request.FromDate, request.ToDate,
+		availability.BookedStatusStrings(), request.ID)
+	if err != nil {
+		return Verdict{}, err
+	}
+	if count >= int64(r.Limit) {
+		return fail("user already has %d concurrent rentals, limit is %d", count, r.Limit)
+	}
+	return pass("user has %d concurrent rentals", count)
+}
+
+type BlackoutPeriod struct {
+	From   time.Time
+	To     time.Time
+	Reason string
+}
+
+// Blackout запрещает аренду, пересекающуюся с закрытыми периодами.
+type Blackout struct {
+	Periods []BlackoutPeriod
+}
+
+func (r *Blackout) Name() string { return "blackout_dates" }
+
+func (r *Blackout) Evaluate(ctx context.Context, tx *gorm.DB, request *models.RentalRequest) (Verdict, error) {
+	for _, p := range r.Periods {
+		if request.FromDate.Before(p.To) && request.ToDate.After(p.From) {
+			return fail("overlaps blackout %s – %s: %s",
+				p.From.Format(time.DateOnly), p.To.AddDate(0, 0, -1).Format(time.DateOnly), p.Reason)
+		}
+	}
+	return pass("no blackout dates")
+}
+
+// EquipmentLimits применяет ограничения, заданные для конкретного оборудования.
+type EquipmentLimits struct {
+	Limits map[uint]config.EquipmentRuleConfig
+	repo   repository.RentalRequestRepository
+}
+
+func (r *EquipmentLimits) Name() string { return "equipment_limits" }
+
+func (r *EquipmentLimits) Evaluate(ctx context.Context, tx *gorm.DB, request *models.RentalRequest) (Verdict, error) {
+	limit, ok := r.Limits[request.EquipmentID]
+	if !ok {
+		return pass("no limits for equipment %d", request.EquipmentID)
+	}
+
+	if limit.MaxDurationHours > 0 {
+		maxDuration := time.Duration(limit.MaxDurationHours) * time.Hour
+		if duration := request.ToDate.Sub(request.FromDate); duration > maxDuration {
+			return fail("rental of equipment %d lasts %s, limit is %s", request.EquipmentID, duration, maxDuration)
+		}
+	}
+
+	if limit.MaxConcurrentPerUser > 0 {
+		count, err := r.repo.WithTx(tx).CountUserOverlapping(ctx, request.UserID, request.EquipmentID,
+			request.FromDate, request.ToDate, availability.BookedStatusStrings(), request.ID)
+		if err != nil {
+			return Verdict{}, err
+		}
+		if count >= int64(limit.MaxConcurrentPerUser) {
+			return fail("user already rents equipment %d %d time(s), limit is %d",
+				request.EquipmentID, count, limit.MaxConcurrentPerUser)
+		}
+	}
+
+	return pass("within limits for equipment %d", request.EquipmentID)
+}
+
+// Availability резервирует оборудование через availability.Checker.
+type Availability struct {
+	checker *availability.Checker
+}
+
+func (r *Availability) Name() string { return "availability" }
+
+func (r *Availability) Evaluate(ctx context.Context, tx *gorm.DB, request *models.RentalRequest) (Verdict, error) {
+	result, err := r.checker.Reserve(ctx, tx, request.EquipmentID, request.FromDate, request.ToDate, request.Quantity, request.ID)
+	switch {
+	case errors.Is(err, availability.ErrUnavailable):
+		return fail("%d unit(s) requested, %d of %d free for the requested period", request.Quantity, result.Free, result.Total)
+	case err != nil:
+		return Verdict{}, err
+	}
+	return pass("%d of %d unit(s) free", result.Free, result.Total)
+}
@@ -0,0 +1,294 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"ticketprocessing/internal/availability"
+	"ticketprocessing/internal/config"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// fakeRentalRequestRepo возвращает заранее заданное число пересекающихся
+// заявок и запоминает параметры запроса.
+type fakeRentalRequestRepo struct {
+	repository.RentalRequestRepository
+	overlapping int64
+	booked      int64
+
+	equipmentID uint
+	excludeID   uint
+	statuses    []string
+}
+
+func (f *fakeRentalRequestRepo) CountUserOverlapping(ctx context.Context, userID, equipmentID uint, from, to time.Time, statuses []string, excludeID uint) (int64, error) {
+	f.equipmentID, f.excludeID, f.statuses = equipmentID, excludeID, statuses
+	return f.overlapping, nil
+}
+
+func (f *fakeRentalRequestRepo) SumOverlappingQuantity(ctx context.Context, equipmentID uint, from, to time.Time, statuses []string, excludeID uint) (int64, error) {
+	return f.booked, nil
+}
+
+func (f *fakeRentalRequestRepo) WithTx(tx *gorm.DB) repository.RentalRequestRepository {
+	return f
+}
+
+type fakeEquipmentRepo struct {
+	repository.EquipmentRepository
+	total int
+}
+
+func (f *fakeEquipmentRepo) GetEquipmentByIDForUpdate(ctx context.Context, id uint) (*models.Equipment, error) {
+	return &models.Equipment{AvailableQuantity: f.total}, nil
+}
+
+func (f *fakeEquipmentRepo) WithTx(tx *gorm.DB) repository.EquipmentRepository {
+	return f
+}
+
+var start = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func rentalRequest(hours int) *models.RentalRequest {
+	return &models.RentalRequest{
+		ID:          5,
+		UserID:      3,
+		EquipmentID: 1,
+		Quantity:    1,
+		FromDate:    start,
+		ToDate:      start.Add(time.Duration(hours) * time.Hour),
+	}
+}
+
+func evaluate(t *testing.T, rule Rule, request *models.RentalRequest) Verdict {
+	t.Helper()
+	verdict, err := rule.Evaluate(context.Background(), nil, request)
+	if err != nil {
+		t.Fatalf("%s: %v", rule.Name(), err)
+	}
+	return verdict
+}
+
+func TestMaxDuration(t *testing.T) {
+	rule := &MaxDuration{Limit: 72 * time.Hour}
+	tests := []struct {
+		hours int
+		want  Outcome
+	}{
+		{1, Pass},
+		{72, Pass},
+		{73, Fail},
+	}
+	for _, tt := range tests {
+		if got := evaluate(t, rule, rentalRequest(tt.hours)); got.Outcome != tt.want {
+			t.Errorf("%dh: %s (%s), want %s", tt.hours, got.Outcome, got.Reason, tt.want)
+		}
+	}
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	tests := []struct {
+		overlapping int64
+		want        Outcome
+	}{
+		{0, Pass},
+		{1, Pass},
+		{2, Fail},
+		{5, Fail},
+	}
+	for _, tt := range tests {
+		repo := &fakeRentalRequestRepo{overlapping: tt.overlapping}
+		rule := &MaxConcurrent{Limit: 2, repo: repo}
+		if got := evaluate(t, rule, rentalRequest(1)); got.Outcome != tt.want {
+			t.Errorf("%d overlapping: %s (%s), want %s", tt.overlapping, got.Outcome, got.Reason, tt.want)
+		}
+		// Считаются заявки на любое оборудование, кроме самой проверяемой
+		if repo.equipmentID != 0 || repo.excludeID != 5 {
+			t.Errorf("counted with equipment %d excluding %d, want 0 and 5", repo.equipmentID, repo.excludeID)
+		}
+		if strings.Join(repo.statuses, ",") != strings.Join(availability.BookedStatusStrings(), ",") {
+			t.Errorf("counted statuses %v, want booked statuses", repo.statuses)
+		}
+	}
+}
+
+func TestBlackout(t *testing.T) {
+	pipeline, err := FromConfig(&config.RulesConfig{
+		BlackoutDates: []config.BlackoutConfig{{From: "2024-03-08", To: "2024-03-10", Reason: "inventory"}},
+	}, &fakeRentalRequestRepo{}, availability.NewChecker(&fakeRentalRequestRepo{}, &fakeEquipmentRepo{total: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := pipeline.rules[0]
+	if rule.Name() != "blackout_dates" {
+		t.Fatalf("first rule = %s, want blackout_dates", rule.Name())
+	}
+
+	day := func(d, h int) time.Time { return time.Date(2024, 3, d, h, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     Outcome
+	}{
+		{"before", day(5, 0), day(8, 0), Pass},
+		{"overlaps start", day(7, 12), day(8, 1), Fail},
+		{"inside", day(9, 0), day(9, 5), Fail},
+		// Последний день периода закрыт целиком
+		{"last day evening", day(10, 23), day(11, 2), Fail},
+		{"after", day(11, 0), day(12, 0), Pass},
+		{"covers period", day(1, 0), day(20, 0), Fail},
+	}
+	for _, tt := range tests {
+		request := rentalRequest(0)
+		request.FromDate, request.ToDate = tt.from, tt.to
+		got := evaluate(t, rule, request)
+		if got.Outcome != tt.want {
+			t.Errorf("%s: %s (%s), want %s", tt.name, got.Outcome, got.Reason, tt.want)
+		}
+		if got.Outcome == Fail && !strings.Contains(got.Reason, "2024-03-08 – 2024-03-10: inventory") {
+			t.Errorf("%s: reason %q", tt.name, got.Reason)
+		}
+	}
+}
+
+func TestEquipmentLimits(t *testing.T) {
+	limits := map[uint]config.EquipmentRuleConfig{
+		1: {EquipmentID: 1, MaxDurationHours: 24, MaxConcurrentPerUser: 1},
+	}
+	tests := []struct {
+		name        string
+		equipmentID uint
+		hours       int
+		overlapping int64
+		want        Outcome
+	}{
+		{"no limits for equipment", 2, 100, 10, Pass},
+		{"within limits", 1, 24, 0, Pass},
+		{"too long", 1, 25, 0, Fail},
+		{"already rented", 1, 2, 1, Fail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRentalRequestRepo{overlapping: tt.overlapping}
+			rule := &EquipmentLimits{Limits: limits, repo: repo}
+			request := rentalRequest(tt.hours)
+			request.EquipmentID = tt.equipmentID
+
+			got := evaluate(t, rule, request)
+			if got.Outcome != tt.want {
+				t.Errorf("%s (%s), want %s", got.Outcome, got.Reason, tt.want)
+			}
+			if tt.name == "already rented" && repo.equipmentID != 1 {
+				t.Errorf("counted equipment %d, want 1", repo.equipmentID)
+			}
+		})
+	}
+}
+
+func TestAvailability(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int
+		booked   int64
+		quantity int
+		want     Outcome
+	}{
+		{"free", 3, 1, 2, Pass},
+		{"not enough", 3, 2, 2, Fail},
+		{"fully booked", 1, 1, 1, Fail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := availability.NewChecker(&fakeRentalRequestRepo{booked: tt.booked}, &fakeEquipmentRepo{total: tt.total})
+			request := rentalRequest(1)
+			request.Quantity = tt.quantity
+
+			if got := evaluate(t, &Availability{checker: checker}, request); got.Outcome != tt.want {
+				t.Errorf("%s (%s), want %s", got.Outcome, got.Reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	repo := &fakeRentalRequestRepo{}
+	checker := availability.NewChecker(repo, &fakeEquipmentRepo{total: 1})
+
+	tests := []struct {
+		name string
+		cfg  config.RulesConfig
+		want []string
+	}{
+		{"only availability", config.RulesConfig{}, []string{"availability"}},
+		{"all rules", config.RulesConfig{
+			MaxDurationHours:     24,
+			MaxConcurrentPerUser: 2,
+			BlackoutDates:        []config.BlackoutConfig{{From: "2024-01-01", To: "2024-01-02"}},
+			Equipment:            []config.EquipmentRuleConfig{{EquipmentID: 1, MaxDurationHours: 1}},
+		}, []string{"max_duration", "max_concurrent_per_user", "blackout_dates", "equipment_limits", "availability"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline, err := FromConfig(&tt.cfg, repo, checker)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, rule := range pipeline.rules {
+				names = append(names, rule.Name())
+			}
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("rules = %v, want %v", names, tt.want)
+			}
+		})
+	}
+
+	for _, date := range []string{"2024-13-01", "01.02.2024"} {
+		cfg := config.RulesConfig{BlackoutDates: []config.BlackoutConfig{{From: date, To: "2024-01-02"}}}
+		if _, err := FromConfig(&cfg, repo, checker); err == nil {
+			t.Errorf("FromConfig accepted blackout date %q", date)
+		}
+	}
+}
+
+// failingRule возвращает ошибку вместо решения.
+type failingRule struct{}
+
+func (failingRule) Name() string { return "broken" }
+
+func (failingRule) Evaluate(ctx context.Context, tx *gorm.DB, request *models.RentalRequest) (Verdict, error) {
+	return Verdict{}, errors.New("database is down")
+}
+
+func TestPipeline(t *testing.T) {
+	pipeline := NewPipeline(&MaxDuration{Limit: time.Hour}, &Blackout{}, &MaxDuration{Limit: time.Minute})
+
+	// Конвейер не останавливается на первом отказе
+	result, err := pipeline.Evaluate(context.Background(), nil, rentalRequest(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Verdicts) != 3 || result.Passed() {
+		t.Fatalf("verdicts = %+v, want 3 with a failure", result.Verdicts)
+	}
+	if result.Verdicts[1].Rule != "blackout_dates" || result.Verdicts[1].Outcome != Pass {
+		t.Errorf("second verdict = %+v", result.Verdicts[1])
+	}
+	if summary := result.Summary(); !strings.HasPrefix(summary, "max_duration: fail (") || strings.Count(summary, "; ") != 2 {
+		t.Errorf("summary = %q", summary)
+	}
+
+	result, err = NewPipeline(&Blackout{}).Evaluate(context.Background(), nil, rentalRequest(2))
+	if err != nil || !result.Passed() {
+		t.Errorf("Evaluate = %+v, %v; want passed", result, err)
+	}
+
+	if _, err := NewPipeline(&Blackout{}, failingRule{}).Evaluate(context.Background(), nil, rentalRequest(2)); err == nil || !strings.Contains(err.Error(), "rule broken") {
+		t.Errorf("Evaluate error = %v, want error of rule broken", err)
+	}
+}
@@ -0,0 +1,86 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"ticketprocessing/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type Outcome string
+
+const (
+	Pass Outcome = "pass"
+	Fail Outcome = "fail"
+)
+
+// Verdict — решение одного правила по заявке.
+type Verdict struct {
+	Rule    string
+	Outcome Outcome
+	Reason  string
+}
+
+// Rule — автоматическая проверка заявки. Evaluate вызывается внутри
+// транзакции воркера, обращения к базе должны идти через tx.
+type Rule interface {
+	Name() string
+	Evaluate(ctx context.Context, tx *gorm.DB, request *models.RentalRequest) (Verdict, error)
+}
+
+// Result — решения всех правил конвейера.
+type Result struct {
+	Verdicts []Verdict
+}
+
+// Passed сообщает, что ни одно правило не отклонило заявку.
+func (r Result) Passed() bool {
+	for _, v := range r.Verdicts {
+		if v.Outcome == Fail {
+			return false
+		}
+	}
+	return true
+}
+
+// Summary формирует текст для комментария в журнале статусов.
+func (r Result) Summary() string {
+	parts := make([]string, len(r.Verdicts))
+	for i, v := range r.Verdicts {
+		parts[i] = fmt.Sprintf("%s: %s (%s)", v.Rule, v.Outcome, v.Reason)
+	}
+	return strings.Join(parts, "; ")
+}
+
+type Pipeline struct {
+	rules []Rule
+}
+
+func NewPipeline(rules ...Rule) *Pipeline {
+	return &Pipeline{rules: rules}
+}
+
+// Evaluate прогоняет заявку через все правила, не останавливаясь на первом
+// отказе, чтобы пользователь видел все причины сразу.
+func (p *Pipeline) Evaluate(ctx context.Context, tx *gorm.DB, request *models.RentalRequest) (Result, error) {
+	result := Result{Verdicts: make([]Verdict, 0, len(p.rules))}
+	for _, rule := range p.rules {
+		verdict, err := rule.Evaluate(ctx, tx, request)
+		if err != nil {
+			return Result{}, fmt.Errorf("rule %s: %w", rule.Name(), err)
+		}
+		verdict.Rule = rule.Name()
+		result.Verdicts = append(result.Verdicts, verdict)
+	}
+	return result, nil
+}
+
+func pass(reason string, args ...any) (Verdict, error) {
+	return Verdict{Outcome: Pass, Reason: fmt.Sprintf(reason, args...)}, nil
+}
+
+func fail(reason string, args ...any) (Verdict, error) {
+	return Verdict{Outcome: Fail, Reason: fmt.Sprintf(reason, args...)}, nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"ticketprocessing/internal/auth"
+	"ticketprocessing/internal/mailer"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/utils"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrWeakPassword = errors.New("password is too short")
+)
+
+const minPasswordLength = 6
+
+// VerifyEmail подтверждает адрес по токену из письма.
+func (s *authService) VerifyEmail(ctx context.Context, token string) error {
+	user, err := s.consumeToken(ctx, auth.PurposeVerifyEmail, token)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	if err := s.repo.UpdateUser(user); err != nil {
+		return ErrInternal
+	}
+	return nil
+}
+
+// ResendVerification повторно отправляет письмо подтверждения. Чтобы по ответу
+// нельзя было проверить, зарегистрирован ли адрес, неизвестный или уже
+// подтверждённый email не считается ошибкой.
+func (s *authService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByEmail(email)
+	if err != nil || user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	if err := s.sendVerification(ctx, user); err != nil {
+		slog.Warn("failed to send verification email", slog.Uint64("user_id", uint64(user.ID)), slog.String("error", err.Error()))
+	}
+	return nil
+}
+
+// ForgotPassword отправляет письмо со ссылкой для сброса пароля. Как и
+// ResendVerification, не раскрывает, существует ли адрес.
+func (s *authService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByEmail(email)
+	if err != nil || user.ServiceAccount {
+		return nil
+	}
+
+	ttl := time.Duration(s.accounts.ResetTTLMinutes) * time.Minute
+	token, err := s.tokenStore.IssueOneTimeToken(ctx, auth.PurposePasswordReset, user.ID, ttl)
+	if err != nil {
+		return ErrInternal
+	}
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Hello, %s!\n\n"+
+			"To set a new password, send this token with the new password to POST %s/password/reset:\n\n"+
+			"%s\n\n"+
+			"The token expires in %d minutes. If you did not request a password reset, ignore this email.\n",
+			user.Name, s.accounts.PublicURL, token, s.accounts.ResetTTLMinutes),
+	})
+	if err != nil {
+		slog.Warn("failed to send password reset email", slog.Uint64("user_id", uint64(user.ID)), slog.String("error", err.Error()))
+	}
+	return nil
+}
+
+// ResetPassword задаёт новый пароль по токену из письма и завершает все
+// сессии пользователя. Письмо доказывает владение адресом, поэтому
+// неподтверждённый email заодно подтверждается.
+func (s *authService) ResetPassword(ctx context.Context, token, password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+
+	user, err := s.consumeToken(ctx, auth.PurposePasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return ErrInternal
+	}
+	user.PasswordHash = hash
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := s.repo.UpdateUser(user); err != nil {
+		return ErrInternal
+	}
+
+	if _, err := s.tokenStore.DeleteAllSessions(ctx, user.ID); err != nil {
+		return ErrInternal
+	}
+	return nil
+}
+
+func (s *authService) sendVerification(ctx context.Context, user *models.User) error {
+	ttl := time.Duration(s.accounts.VerifyTTLHours) * time.Hour
+	token, err := s.tokenStore.IssueOneTimeToken(ctx, auth.PurposeVerifyEmail, user.ID, ttl)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Hello, %s!\n\n"+
+			"Confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %d hours.\n",
+			user.Name, s.accounts.PublicURL+"/email/verify?token="+url.QueryEscape(token), s.accounts.VerifyTTLHours),
+	})
+}
+
+func (s *authService) consumeToken(ctx context.Context, purpose, token string) (*models.User, error) {
+	userID, err := s.tokenStore.ConsumeOneTimeToken(ctx, purpose, token)
+	switch {
+	case errors.Is(err, auth.ErrTokenNotFound):
+		return nil, ErrInvalidToken
+	case err != nil:
+		return nil, ErrInternal
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return user, nil
+}
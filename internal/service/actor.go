@@ -0,0 +1,24 @@
+package service
+
+import (
+	"errors"
+	"ticketprocessing/internal/models"
+)
+
+var ErrForbidden = errors.New("access denied")
+
+// Actor — пользователь, от имени которого выполняется операция.
+type Actor struct {
+	UserID uint
+	Role   models.Role
+}
+
+// IsStaff сообщает, что пользователь может работать с чужими заявками.
+func (a Actor) IsStaff() bool {
+	return a.Role.Includes(models.RoleManager)
+}
+
+// CanAccess сообщает, что заявка принадлежит пользователю или он сотрудник.
+func (a Actor) CanAccess(request *models.RentalRequest) bool {
+	return a.IsStaff() || request.UserID == a.UserID
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"ticketprocessing/internal/auth"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+	ErrInvalidAPIKey      = errors.New("invalid api key")
+	ErrNotServiceAccount  = errors.New("user is not a service account")
+	ErrInvalidScope       = errors.New("invalid api key scope")
+	ErrNameRequired       = errors.New("name is required")
+	ErrInvalidKeyLifetime = errors.New("expires_in_days must not be negative")
+)
+
+const (
+	// apiKeyPrefix отличает ключи сервиса от других секретов, например при поиске утечек
+	apiKeyPrefix = "rk_"
+	// Видимая часть ключа: префикс и первые 8 символов
+	apiKeyPrefixLength = len(apiKeyPrefix) + 8
+	// Время использования ключа пишется в базу не чаще раза в минуту
+	lastUsedInterval = time.Minute
+)
+
+type CreateServiceAccountRequest struct {
+	Name string      `json:"name"`
+	Role models.Role `json:"role"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays — срок действия ключа; 0 — бессрочный
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// CreatedAPIKey — выпущенный ключ. Key возвращается только при выпуске.
+type CreatedAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyPrincipal — сервисная учётная запись, предъявившая ключ.
+type APIKeyPrincipal struct {
+	User *models.User
+	Key  *models.APIKey
+}
+
+type APIKeyService interface {
+	CreateServiceAccount(ctx context.Context, req CreateServiceAccountRequest) (*models.User, error)
+	ListServiceAccounts(ctx context.Context) ([]models.User, error)
+	CreateAPIKey(ctx context.Context, actor Actor, userID uint, req CreateAPIKeyRequest) (*CreatedAPIKey, error)
+	ListAPIKeys(ctx context.Context, userID uint) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id uint) (*models.APIKey, error)
+	Authenticate(ctx context.Context, key string) (*APIKeyPrincipal, error)
+}
+
+type apiKeyService struct {
+	repo     repository.APIKeyRepository
+	authRepo repository.AuthRepository
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository, authRepo repository.AuthRepository) APIKeyService {
+	return &apiKeyService{
+		repo:     repo,
+		authRepo: authRepo,
+	}
+}
+
+// CreateServiceAccount создаёт учётную запись без пароля. Войти в неё
+// нельзя, доступ только по API-ключам.
+func (s *apiKeyService) CreateServiceAccount(ctx context.Context, req CreateServiceAccountRequest) (*models.User, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrNameRequired
+	}
+	role := req.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+
+	// Email обязателен и уникален, а у сервисной учётной записи его нет
+	suffix, err := auth.RandomHex(6)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	user := &models.User{
+		Name:           name,
+		Email:          "service-" + suffix + "@service-accounts.invalid",
+		Role:           role,
+		ServiceAccount: true,
+	}
+	if err := s.authRepo.CreateUser(user); err != nil {
+		return nil, ErrInternal
+	}
+	return user, nil
+}
+
+func (s *apiKeyService) ListServiceAccounts(ctx context.Context) ([]models.User, error) {
+	users, err := s.authRepo.ListServiceAccounts()
+	if err != nil {
+		return nil, ErrInternal
+	}
+	return users, nil
+}
+
+func (s *apiKeyService) CreateAPIKey(ctx context.Context, actor Actor, userID uint, req CreateAPIKeyRequest) (*CreatedAPIKey, error) {
+	if _, err := s.serviceAccount(userID); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrNameRequired
+	}
+	if len(req.Scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	for _, scope := range req.Scopes {
+		if !models.ValidAPIKeyScope(scope) {
+			return nil, ErrInvalidScope
+		}
+	}
+	if req.ExpiresInDays < 0 {
+		return nil, ErrInvalidKeyLifetime
+	}
+
+	secret, err := auth.RandomHex(20)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	key := apiKeyPrefix + secret
+
+	apiKey := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:apiKeyPrefixLength],
+		KeyHash:   auth.HashToken(key),
+		Scopes:    req.Scopes,
+		CreatedBy: actor.UserID,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.CreateAPIKey(ctx, apiKey); err != nil {
+		return nil, ErrInternal
+	}
+
+	return &CreatedAPIKey{APIKey: *apiKey, Key: key}, nil
+}
+
+func (s *apiKeyService) ListAPIKeys(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	if _, err := s.serviceAccount(userID); err != nil {
+		return nil, err
+	}
+
+	keys, err := s.repo.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает ключ. Повторный отзыв не меняет время отзыва.
+func (s *apiKeyService) RevokeAPIKey(ctx context.Context, id uint) (*models.APIKey, error) {
+	if _, err := s.repo.GetAPIKeyByID(ctx, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, ErrInternal
+	}
+
+	if err := s.repo.RevokeAPIKey(ctx, id, time.Now()); err != nil {
+		return nil, ErrInternal
+	}
+
+	key, err := s.repo.GetAPIKeyByID(ctx, id)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	return key, nil
+}
+
+// Authenticate проверяет ключ из заголовка X-API-Key и отмечает его использование.
+func (s *apiKeyService) Authenticate(ctx context.Context, key string) (*APIKeyPrincipal, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.repo.GetAPIKeyByHash(ctx, auth.HashToken(key))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	now := time.Now()
+	if !apiKey.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.authRepo.GetUserByID(apiKey.UserID)
+	if err != nil || !user.ServiceAccount {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if err := s.repo.TouchLastUsed(ctx, apiKey.ID, now, now.Add(-lastUsedInterval)); err != nil {
+		slog.Warn("failed to update api key last use", slog.Uint64("api_key_id", uint64(apiKey.ID)), slog.String("error", err.Error()))
+	}
+
+	return &APIKeyPrincipal{User: user, Key: apiKey}, nil
+}
+
+func (s *apiKeyService) serviceAccount(userID uint) (*models.User, error) {
+	user, err := s.authRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.ServiceAccount {
+		return nil, ErrNotServiceAccount
+	}
+	return user, nil
+}
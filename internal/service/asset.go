@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAssetNotFound       = errors.New("asset not found")
+	ErrAssetFieldsRequired = errors.New("serial_number and asset_tag are required")
+	ErrDuplicateAsset      = errors.New("asset with this serial number or tag already exists")
+	ErrInvalidAssetStatus  = errors.New("invalid asset status")
+	ErrAssetInUse          = errors.New("asset is checked out")
+	ErrAssetUnavailable    = errors.New("asset is not available for check-out")
+	ErrAssetCountMismatch  = errors.New("number of assets must match the requested quantity")
+)
+
+type UpdateAssetRequest struct {
+	SerialNumber string             `json:"serial_number"`
+	AssetTag     string             `json:"asset_tag"`
+	Status       models.AssetStatus `json:"status"`
+	Location     string             `json:"location"`
+	Comment      string             `json:"comment"`
+}
+
+// inServiceStatuses — статусы единиц, из которых складывается AvailableQuantity.
+var inServiceStatuses = []models.AssetStatus{models.AssetAvailable, models.AssetCheckedOut}
+
+type AssetService struct {
+	repo          repository.AssetRepository
+	equipmentRepo repository.EquipmentRepository
+	transactor    repository.Transactor
+}
+
+func NewAsset(repo repository.AssetRepository, equipmentRepo repository.EquipmentRepository, transactor repository.Transactor) *AssetService {
+	return &AssetService{
+		repo:          repo,
+		equipmentRepo: equipmentRepo,
+		transactor:    transactor,
+	}
+}
+
+// Create регистрирует единицу оборудования и пересчитывает его количество.
+func (as *AssetService) Create(ctx context.Context, actor Actor, equipmentID uint, asset *models.Asset) error {
+	if strings.TrimSpace(asset.SerialNumber) == "" || strings.TrimSpace(asset.AssetTag) == "" {
+		return ErrAssetFieldsRequired
+	}
+	if asset.Status == "" {
+		asset.Status = models.AssetAvailable
+	}
+	// Выдать единицу можно только по заявке
+	if !asset.Status.Valid() || asset.Status == models.AssetCheckedOut {
+		return ErrInvalidAssetStatus
+	}
+
+	return as.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		equipmentRepo := as.equipmentRepo.WithTx(tx)
+		assetRepo := as.repo.WithTx(tx)
+
+		// Блокировка оборудования упорядочивает пересчёт количества
+		if _, err := equipmentRepo.GetEquipmentByIDForUpdate(ctx, equipmentID); err != nil {
+			return ErrEquipmentNotFound
+		}
+
+		exists, err := assetRepo.ExistsSerialOrTag(ctx, asset.SerialNumber, asset.AssetTag, 0)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrDuplicateAsset
+		}
+
+		asset.ID = 0
+		asset.EquipmentID = equipmentID
+		asset.RequestID = nil
+		if err := assetRepo.CreateAsset(ctx, asset); err != nil {
+			return err
+		}
+
+		if err := recordAssetEvent(ctx, assetRepo, asset, &actor.UserID, "Asset registered"); err != nil {
+			return err
+		}
+		return syncEquipmentQuantity(ctx, assetRepo, equipmentRepo, equipmentID)
+	})
+}
+
+func (as *AssetService) GetByID(ctx context.Context, id uint) (*models.Asset, error) {
+	asset, err := as.repo.GetAssetByID(ctx, id)
+	if err != nil {
+		return nil, ErrAssetNotFound
+	}
+	return asset, nil
+}
+
+func (as *AssetService) ListByEquipment(ctx context.Context, equipmentID uint) ([]models.Asset, error) {
+	if _, err := as.equipmentRepo.GetEquipmentByID(equipmentID); err != nil {
+		return nil, ErrEquipmentNotFound
+	}
+	return as.repo.ListByEquipmentID(ctx, equipmentID)
+}
+
+// Update меняет данные единицы. Статус выданной единицы меняется только
+// через выдачу и возврат по заявке.
+func (as *AssetService) Update(ctx context.Context, actor Actor, id uint, req UpdateAssetRequest) (*models.Asset, error) {
+	if req.Status != "" && (!req.Status.Valid() || req.Status == models.AssetCheckedOut) {
+		return nil, ErrInvalidAssetStatus
+	}
+
+	var asset *models.Asset
+	err := as.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		equipmentRepo := as.equipmentRepo.WithTx(tx)
+		assetRepo := as.repo.WithTx(tx)
+
+		current, err := assetRepo.GetAssetByID(ctx, id)
+		if err != nil {
+			return ErrAssetNotFound
+		}
+		if _, err := equipmentRepo.GetEquipmentByIDForUpdate(ctx, current.EquipmentID); err != nil {
+			return err
+		}
+		if asset, err = assetRepo.GetAssetByIDForUpdate(ctx, id); err != nil {
+			return ErrAssetNotFound
+		}
+
+		if req.SerialNumber != "" {
+			asset.SerialNumber = req.SerialNumber
+		}
+		if req.AssetTag != "" {
+			asset.AssetTag = req.AssetTag
+		}
+		exists, err := assetRepo.ExistsSerialOrTag(ctx, asset.SerialNumber, asset.AssetTag, asset.ID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrDuplicateAsset
+		}
+
+		var changes []string
+		if req.Status != "" && req.Status != asset.Status {
+			if asset.Status == models.AssetCheckedOut {
+				return ErrAssetInUse
+			}
+			changes = append(changes, fmt.Sprintf("status %s → %s", asset.Status, req.Status))
+			asset.Status = req.Status
+		}
+		if req.Location != "" && req.Location != asset.Location {
+			changes = append(changes, fmt.Sprintf("location %q → %q", asset.Location, req.Location))
+			asset.Location = req.Location
+		}
+
+		if err := assetRepo.UpdateAsset(ctx, asset); err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+
+		comment := strings.Join(changes, ", ")
+		if req.Comment != "" {
+			comment += ": " + req.Comment
+		}
+		if err := recordAssetEvent(ctx, assetRepo, asset, &actor.UserID, comment); err != nil {
+			return err
+		}
+		return syncEquipmentQuantity(ctx, assetRepo, equipmentRepo, asset.EquipmentID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asset, nil
+}
+
+func (as *AssetService) History(ctx context.Context, id uint) ([]models.AssetEvent, error) {
+	if _, err := as.repo.GetAssetByID(ctx, id); err != nil {
+		return nil, ErrAssetNotFound
+	}
+	return as.repo.ListEvents(ctx, id)
+}
+
+// recordAssetEvent записывает текущее состояние единицы в её историю.
+func recordAssetEvent(ctx context.Context, assetRepo repository.AssetRepository, asset *models.Asset, actorID *uint, comment string) error {
+	return assetRepo.CreateEvent(ctx, &models.AssetEvent{
+		AssetID:   asset.ID,
+		Status:    asset.Status,
+		Location:  asset.Location,
+		RequestID: asset.RequestID,
+		ActorID:   actorID,
+		Comment:   comment,
+		Timestamp: time.Now(),
+	})
+}
+
+// syncEquipmentQuantity выводит AvailableQuantity из состояний единиц.
+// Оборудование без единиц сохраняет количество, заданное вручную.
+// Репозитории должны быть привязаны к транзакции с заблокированным оборудованием.
+func syncEquipmentQuantity(ctx context.Context, assetRepo repository.AssetRepository, equipmentRepo repository.EquipmentRepository, equipmentID uint) error {
+	total, err := assetRepo.CountByEquipmentID(ctx, equipmentID, nil)
+	if err != nil || total == 0 {
+		return err
+	}
+
+	inService, err := assetRepo.CountByEquipmentID(ctx, equipmentID, inServiceStatuses)
+	if err != nil {
+		return err
+	}
+
+	equipment, err := equipmentRepo.GetEquipmentByIDForUpdate(ctx, equipmentID)
+	if err != nil {
+		return err
+	}
+	equipment.AvailableQuantity = int(inService)
+	return equipmentRepo.UpdateEquipment(equipment)
+}
@@ -3,34 +3,126 @@ package service
 import (
 	"context"
 	"errors"
+	"log/slog"
+	"slices"
+	"strings"
 	"ticketprocessing/internal/auth"
+	"ticketprocessing/internal/config"
+	"ticketprocessing/internal/mailer"
 	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/oidc"
+	"ticketprocessing/internal/ratelimit"
 	"ticketprocessing/internal/repository"
 	"ticketprocessing/internal/utils"
+	"time"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserExists         = errors.New("user already exists")
 	ErrInternal           = errors.New("internal server error")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrSessionNotFound    = errors.New("session not found")
+	// ErrInvalidRefreshToken возвращается и для неизвестного токена, и для
+	// повторно использованного: во втором случае сессия уже отозвана.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrEmailNotVerified    = errors.New("email not verified")
+	ErrAccountLocked       = errors.New("account temporarily locked")
 )
 
+// LockedError сообщает, сколько ещё действует блокировка входа.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return ErrAccountLocked.Error()
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// TokenPair — короткоживущий access-токен и refresh-токен для его обновления.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresIn — время жизни access-токена в секундах
+	ExpiresIn int
+}
+
+// LoginResult — итог проверки пароля. Если у пользователя включён второй
+// фактор, вместо токенов возвращается MFAToken для LoginMFA.
+type LoginResult struct {
+	Tokens       *TokenPair
+	MFAToken     string
+	MFAExpiresIn int
+	// MFASetupRequired — роль требует второго фактора, а он не настроен:
+	// до настройки пользователь работает с правами user
+	MFASetupRequired bool
+}
+
+// SessionMeta — сведения об устройстве, с которого выполнен вход.
+type SessionMeta struct {
+	UserAgent string
+	IP        string
+}
+
+// SessionInfo — сессия пользователя; Current отмечает сессию текущего запроса.
+type SessionInfo struct {
+	auth.Session
+	Current bool `json:"current"`
+}
+
 type AuthService interface {
 	Register(ctx context.Context, name, email, password string) error
-	Login(ctx context.Context, email, password string) (string, error)
+	Login(ctx context.Context, email, password string, meta SessionMeta) (*LoginResult, error)
+	LoginMFA(ctx context.Context, mfaToken, code string, meta SessionMeta) (*TokenPair, error)
+	OIDCLoginURL(ctx context.Context) (string, error)
+	LoginOIDC(ctx context.Context, state, code string, meta SessionMeta) (*LoginResult, error)
+	Refresh(ctx context.Context, refreshToken string) (*TokenPair, error)
+	SetRole(ctx context.Context, userID uint, role models.Role) (*models.User, error)
+	Logout(ctx context.Context, userID uint, sessionID string) error
+	ListSessions(ctx context.Context, userID uint, currentSessionID string) ([]SessionInfo, error)
+	RevokeSession(ctx context.Context, userID uint, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID uint) (int, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	SetupTOTP(ctx context.Context, userID uint) (*TOTPSetup, error)
+	EnableTOTP(ctx context.Context, userID uint, sessionID, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID uint, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error)
 }
 
 type authService struct {
 	repo       repository.AuthRepository
 	jwtManager *auth.JWTManager
 	tokenStore *auth.RedisTokenStore
+	mailer     mailer.Mailer
+	accounts   *config.AccountsConfig
+	mfa        *config.MFAConfig
+	lockout    *ratelimit.Lockout
+	oidcCfg    *config.OIDCConfig
+	// oidc равен nil, если вход через провайдера выключен
+	oidc        *oidc.Provider
+	adminEmails []string
 }
 
-func NewAuthService(repo repository.AuthRepository, jwtManager *auth.JWTManager, tokenStore *auth.RedisTokenStore) AuthService {
+func NewAuthService(repo repository.AuthRepository, jwtManager *auth.JWTManager, tokenStore *auth.RedisTokenStore, mailer mailer.Mailer, accounts *config.AccountsConfig, mfa *config.MFAConfig, lockout *ratelimit.Lockout, oidcCfg *config.OIDCConfig, provider *oidc.Provider, adminEmails []string) AuthService {
 	return &authService{
-		repo:       repo,
-		jwtManager: jwtManager,
-		tokenStore: tokenStore,
+		repo:        repo,
+		jwtManager:  jwtManager,
+		tokenStore:  tokenStore,
+		mailer:      mailer,
+		accounts:    accounts,
+		mfa:         mfa,
+		lockout:     lockout,
+		oidcCfg:     oidcCfg,
+		oidc:        provider,
+		adminEmails: adminEmails,
 	}
 }
 
@@ -48,33 +140,250 @@ func (s *authService) Register(ctx context.Context, name, email, password string
 		Name:         name,
 		Email:        email,
 		PasswordHash: hash,
+		Role:         models.RoleUser,
+	}
+	if s.isBootstrapAdmin(email) {
+		user.Role = models.RoleAdmin
 	}
 
 	if err := s.repo.CreateUser(user); err != nil {
 		return ErrInternal
 	}
 
+	// Учётная запись уже создана: письмо можно запросить повторно
+	if err := s.sendVerification(ctx, user); err != nil {
+		slog.Warn("failed to send verification email", slog.Uint64("user_id", uint64(user.ID)), slog.String("error", err.Error()))
+	}
+
 	return nil
 }
 
-func (s *authService) Login(ctx context.Context, email, password string) (string, error) {
+func (s *authService) Login(ctx context.Context, email, password string, meta SessionMeta) (*LoginResult, error) {
+	// У сервисных учётных записей нет пароля, они работают по API-ключам
 	user, err := s.repo.GetUserByEmail(email)
-	if err != nil {
-		return "", ErrInvalidCredentials
+	if err != nil || user.ServiceAccount {
+		return nil, ErrInvalidCredentials
+	}
+
+	// Во время блокировки пароль не проверяется, чтобы его нельзя было подбирать
+	if err := s.checkLockout(ctx, user.ID); err != nil {
+		return nil, err
 	}
 
 	if !utils.CheckPassword(user.PasswordHash, password) {
-		return "", ErrInvalidCredentials
+		return nil, s.loginFailed(ctx, user.ID, ErrInvalidCredentials)
+	}
+
+	if s.accounts.RequireVerification && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	// Администраторы из конфига получают роль и для уже существующих учётных записей
+	if s.isBootstrapAdmin(user.Email) && user.Role != models.RoleAdmin {
+		user.Role = models.RoleAdmin
+		if err := s.repo.UpdateUser(user); err != nil {
+			return nil, ErrInternal
+		}
+	}
+
+	// Со вторым фактором токены выдаются только после кода, см. LoginMFA.
+	// Счётчик ошибок сбрасывается только после него, иначе верный пароль
+	// позволял бы подбирать код без блокировки.
+	if user.TOTPEnabled {
+		ttl := time.Duration(s.mfa.ChallengeTTLMinutes) * time.Minute
+		challenge, err := s.tokenStore.IssueMFAChallenge(ctx, user.ID, ttl)
+		if err != nil {
+			return nil, ErrInternal
+		}
+		return &LoginResult{MFAToken: challenge, MFAExpiresIn: int(ttl.Seconds())}, nil
+	}
+
+	tokens, err := s.startSession(ctx, user, meta, false)
+	if err != nil {
+		return nil, err
+	}
+	s.loginSucceeded(ctx, user.ID)
+	return &LoginResult{Tokens: tokens, MFASetupRequired: s.mfaEnforced(user.Role)}, nil
+}
+
+func (s *authService) checkLockout(ctx context.Context, userID uint) error {
+	lockedFor, err := s.lockout.LockedFor(ctx, userID)
+	if err != nil {
+		return ErrInternal
+	}
+	if lockedFor > 0 {
+		return &LockedError{RetryAfter: lockedFor}
+	}
+	return nil
+}
+
+// loginFailed учитывает неудачную попытку входа. Если она привела к
+// блокировке, вместо cause возвращается LockedError.
+func (s *authService) loginFailed(ctx context.Context, userID uint, cause error) error {
+	lockedFor, err := s.lockout.Fail(ctx, userID)
+	if err != nil {
+		slog.Warn("failed to record login failure", slog.Uint64("user_id", uint64(userID)), slog.String("error", err.Error()))
+		return cause
+	}
+	if lockedFor > 0 {
+		slog.Warn("login locked after repeated failures", slog.Uint64("user_id", uint64(userID)), slog.Duration("duration", lockedFor))
+		return &LockedError{RetryAfter: lockedFor}
+	}
+	return cause
+}
+
+func (s *authService) loginSucceeded(ctx context.Context, userID uint) {
+	if err := s.lockout.Succeed(ctx, userID); err != nil {
+		slog.Warn("failed to reset login failures", slog.Uint64("user_id", uint64(userID)), slog.String("error", err.Error()))
+	}
+}
+
+// startSession создаёт сессию и выдаёт первую пару токенов.
+func (s *authService) startSession(ctx context.Context, user *models.User, meta SessionMeta, mfa bool) (*TokenPair, error) {
+	sessionID, err := auth.NewSessionID()
+	if err != nil {
+		return nil, ErrInternal
 	}
+	refreshToken, refreshHash, err := auth.NewRefreshToken(sessionID)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	now := time.Now()
+	session := &auth.Session{
+		ID:          sessionID,
+		UserID:      user.ID,
+		UserAgent:   meta.UserAgent,
+		IP:          meta.IP,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		MFA:         mfa,
+		RefreshHash: refreshHash,
+	}
+	if err := s.tokenStore.SaveSession(ctx, session); err != nil {
+		return nil, ErrInternal
+	}
+
+	return s.tokenPair(user, session, refreshToken)
+}
+
+// Refresh обменивает refresh-токен на новую пару токенов. Старый
+// refresh-токен становится недействительным; его повторное предъявление
+// отзывает сессию вместе со всеми выданными в ней токенами.
+func (s *authService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	sessionID, err := auth.RefreshTokenSession(refreshToken)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	newToken, newHash, err := auth.NewRefreshToken(sessionID)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	session, err := s.tokenStore.RotateRefreshToken(ctx, refreshToken, newHash)
+	switch {
+	case errors.Is(err, auth.ErrRefreshTokenReused):
+		slog.Warn("refresh token reuse detected, session revoked", slog.String("session_id", sessionID))
+		return nil, ErrInvalidRefreshToken
+	case errors.Is(err, auth.ErrInvalidRefreshToken):
+		return nil, ErrInvalidRefreshToken
+	case err != nil:
+		return nil, ErrInternal
+	}
+
+	// Роль берём из базы, чтобы изменения прав вступали в силу при обновлении
+	user, err := s.repo.GetUserByID(session.UserID)
+	if err != nil {
+		_ = s.tokenStore.DeleteSession(ctx, session.UserID, session.ID)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.tokenPair(user, session, newToken)
+}
+
+func (s *authService) tokenPair(user *models.User, session *auth.Session, refreshToken string) (*TokenPair, error) {
+	accessToken, err := s.jwtManager.Generate(user.ID, s.effectiveRole(user, session), session.ID)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.jwtManager.TTLMinutes * 60,
+	}, nil
+}
 
-	token, err := s.jwtManager.Generate(user.ID)
+// Logout завершает текущую сессию, её access- и refresh-токены перестают приниматься.
+func (s *authService) Logout(ctx context.Context, userID uint, sessionID string) error {
+	return s.RevokeSession(ctx, userID, sessionID)
+}
+
+func (s *authService) ListSessions(ctx context.Context, userID uint, currentSessionID string) ([]SessionInfo, error) {
+	sessions, err := s.tokenStore.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	// Сначала недавно активные
+	slices.SortFunc(sessions, func(a, b auth.Session) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+
+	infos := make([]SessionInfo, len(sessions))
+	for i, session := range sessions {
+		infos[i] = SessionInfo{Session: session, Current: session.ID == currentSessionID}
+	}
+	return infos, nil
+}
+
+func (s *authService) RevokeSession(ctx context.Context, userID uint, sessionID string) error {
+	err := s.tokenStore.DeleteSession(ctx, userID, sessionID)
+	switch {
+	case errors.Is(err, auth.ErrSessionNotFound):
+		return ErrSessionNotFound
+	case err != nil:
+		return ErrInternal
+	}
+	return nil
+}
+
+// RevokeAllSessions завершает все сессии пользователя, например при
+// компрометации учётной записи.
+func (s *authService) RevokeAllSessions(ctx context.Context, userID uint) (int, error) {
+	if _, err := s.repo.GetUserByID(userID); err != nil {
+		return 0, ErrUserNotFound
+	}
+
+	count, err := s.tokenStore.DeleteAllSessions(ctx, userID)
+	if err != nil {
+		return 0, ErrInternal
+	}
+	return count, nil
+}
+
+// SetRole меняет роль пользователя. Новая роль попадает в токен при следующем обновлении.
+// Для ролей из mfa.enforce_roles она действует только после входа со вторым фактором.
+func (s *authService) SetRole(ctx context.Context, userID uint, role models.Role) (*models.User, error) {
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+
+	user, err := s.repo.GetUserByID(userID)
 	if err != nil {
-		return "", ErrInternal
+		return nil, ErrUserNotFound
 	}
 
-	if err := s.tokenStore.SaveToken(ctx, token, user.ID); err != nil {
-		return "", ErrInternal
+	user.Role = role
+	if err := s.repo.UpdateUser(user); err != nil {
+		return nil, ErrInternal
 	}
 
-	return token, nil
+	return user, nil
+}
+
+func (s *authService) isBootstrapAdmin(email string) bool {
+	return slices.ContainsFunc(s.adminEmails, func(admin string) bool {
+		return strings.EqualFold(admin, email)
+	})
 }
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/repository"
+)
+
+var (
+	ErrCategoryNotFound       = errors.New("category not found")
+	ErrCategoryNameRequired   = errors.New("category name is required")
+	ErrCategoryCycle          = errors.New("category cannot be nested under itself")
+	ErrCategoryInUse          = errors.New("category has subcategories or equipment")
+	ErrInvalidAttributeSchema = errors.New("invalid attribute schema")
+	ErrInvalidAttributes      = errors.New("invalid equipment attributes")
+)
+
+// maxCategoryDepth ограничивает обход предков на случай испорченных данных.
+const maxCategoryDepth = 64
+
+// CategoryDetails — категория со схемой свойств с учётом родителей.
+type CategoryDetails struct {
+	models.Category
+	EffectiveSchema models.AttributeSchema `json:"effective_schema"`
+}
+
+type CategoryService struct {
+	repo          repository.CategoryRepository
+	equipmentRepo repository.EquipmentRepository
+}
+
+func NewCategory(repo repository.CategoryRepository, equipmentRepo repository.EquipmentRepository) *CategoryService {
+	return &CategoryService{
+		repo:          repo,
+		equipmentRepo: equipmentRepo,
+	}
+}
+
+func (cs *CategoryService) Create(ctx context.Context, category *models.Category) error {
+	if err := cs.validate(ctx, category); err != nil {
+		return err
+	}
+	category.ID = 0
+	return cs.repo.CreateCategory(ctx, category)
+}
+
+func (cs *CategoryService) List(ctx context.Context) ([]models.Category, error) {
+	return cs.repo.ListCategories(ctx)
+}
+
+func (cs *CategoryService) GetByID(ctx context.Context, id uint) (*CategoryDetails, error) {
+	category, err := cs.repo.GetCategoryByID(ctx, id)
+	if err != nil {
+		return nil, ErrCategoryNotFound
+	}
+	schema, err := effectiveSchema(ctx, cs.repo, category.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &CategoryDetails{Category: *category, EffectiveSchema: schema}, nil
+}
+
+// Update меняет категорию. Уже сохранённое оборудование по новой схеме
+// не перепроверяется, это произойдёт при его следующем изменении.
+func (cs *CategoryService) Update(ctx context.Context, category *models.Category) error {
+	existing, err := cs.repo.GetCategoryByID(ctx, category.ID)
+	if err != nil {
+		return ErrCategoryNotFound
+	}
+	// Категория приходит из запроса целиком и сохраняется всеми полями
+	category.CreatedAt = existing.CreatedAt
+	if err := cs.validate(ctx, category); err != nil {
+		return err
+	}
+
+	if category.ParentID != nil {
+		subtree, err := cs.repo.ListDescendantIDs(ctx, category.ID)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(subtree, *category.ParentID) {
+			return ErrCategoryCycle
+		}
+	}
+
+	return cs.repo.UpdateCategory(ctx, category)
+}
+
+func (cs *CategoryService) Delete(ctx context.Context, id uint) error {
+	category, err := cs.repo.GetCategoryByID(ctx, id)
+	if err != nil {
+		return ErrCategoryNotFound
+	}
+
+	children, err := cs.repo.CountChildren(ctx, id)
+	if err != nil {
+		return err
+	}
+	equipment, err := cs.equipmentRepo.CountByCategoryIDs(ctx, []uint{id})
+	if err != nil {
+		return err
+	}
+	if children > 0 || equipment > 0 {
+		return ErrCategoryInUse
+	}
+
+	return cs.repo.DeleteCategory(ctx, category)
+}
+
+func (cs *CategoryService) validate(ctx context.Context, category *models.Category) error {
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return ErrCategoryNameRequired
+	}
+
+	if category.ParentID != nil {
+		if *category.ParentID == category.ID {
+			return ErrCategoryCycle
+		}
+		if _, err := cs.repo.GetCategoryByID(ctx, *category.ParentID); err != nil {
+			return fmt.Errorf("%w: parent %d", ErrCategoryNotFound, *category.ParentID)
+		}
+	}
+
+	for name, spec := range category.AttributeSchema {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("%w: empty attribute name", ErrInvalidAttributeSchema)
+		}
+		switch spec.Type {
+		case models.AttributeString, models.AttributeNumber, models.AttributeInteger, models.AttributeBoolean:
+			if len(spec.Values) > 0 {
+				return fmt.Errorf("%w: %s: values are allowed only for enum", ErrInvalidAttributeSchema, name)
+			}
+		case models.AttributeEnum:
+			if len(spec.Values) == 0 {
+				return fmt.Errorf("%w: %s: enum requires values", ErrInvalidAttributeSchema, name)
+			}
+		default:
+			return fmt.Errorf("%w: %s: unknown type %q", ErrInvalidAttributeSchema, name, spec.Type)
+		}
+	}
+	return nil
+}
+
+// effectiveSchema собирает схему категории и её предков; свойства
+// подкатегории переопределяют одноимённые свойства родителей.
+func effectiveSchema(ctx context.Context, repo repository.CategoryRepository, categoryID uint) (models.AttributeSchema, error) {
+	var chain []*models.Category
+	for id := &categoryID; id != nil; {
+		if len(chain) == maxCategoryDepth {
+			return nil, fmt.Errorf("category %d is nested too deep", categoryID)
+		}
+		category, err := repo.GetCategoryByID(ctx, *id)
+		if err != nil {
+			return nil, ErrCategoryNotFound
+		}
+		chain = append(chain, category)
+		id = category.ParentID
+	}
+
+	schema := models.AttributeSchema{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for name, spec := range chain[i].AttributeSchema {
+			schema[name] = spec
+		}
+	}
+	return schema, nil
+}
+
+// validateAttributes проверяет свойства оборудования по схеме категории.
+func validateAttributes(schema models.AttributeSchema, attributes models.Attributes) error {
+	for name, spec := range schema {
+		if _, ok := attributes[name]; !ok && spec.Required {
+			return fmt.Errorf("%w: %s is required", ErrInvalidAttributes, name)
+		}
+	}
+
+	for name, value := range attributes {
+		spec, ok := schema[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown attribute %s", ErrInvalidAttributes, name)
+		}
+
+		valid := false
+		switch spec.Type {
+		case models.AttributeString:
+			_, valid = value.(string)
+		case models.AttributeNumber:
+			_, valid = value.(float64)
+		case models.AttributeInteger:
+			n, ok := value.(float64)
+			valid = ok && n == math.Trunc(n)
+		case models.AttributeBoolean:
+			_, valid = value.(bool)
+		case models.AttributeEnum:
+			s, ok := value.(string)
+			valid = ok && slices.Contains(spec.Values, s)
+		}
+		if !valid {
+			return fmt.Errorf("%w: %s must be %s", ErrInvalidAttributes, name, spec.Type)
+		}
+	}
+	return nil
+}
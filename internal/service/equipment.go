@@ -2,32 +2,172 @@ package service
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"strings"
+	"ticketprocessing/internal/availability"
 	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/pagination"
 	"ticketprocessing/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
 )
 
+// EquipmentListFilter — условия выборки оборудования из запроса.
+type EquipmentListFilter struct {
+	// CategoryID включает и подкатегории
+	CategoryID *uint
+	Tags       []string
+	Attributes map[string]string
+	Search     string
+	// AvailableFrom и AvailableTo задаются вместе; MinFree по умолчанию 1
+	AvailableFrom *time.Time
+	AvailableTo   *time.Time
+	MinFree       int
+}
+
 type EquipmentService struct {
-	repo repository.EquipmentRepository
+	repo         repository.EquipmentRepository
+	assetRepo    repository.AssetRepository
+	categoryRepo repository.CategoryRepository
+	availability *availability.Checker
+	transactor   repository.Transactor
 }
 
-func NewEquipment(repo repository.EquipmentRepository) *EquipmentService {
+func NewEquipment(repo repository.EquipmentRepository, assetRepo repository.AssetRepository, categoryRepo repository.CategoryRepository, availability *availability.Checker, transactor repository.Transactor) *EquipmentService {
 	return &EquipmentService{
-		repo: repo,
+		repo:         repo,
+		assetRepo:    assetRepo,
+		categoryRepo: categoryRepo,
+		availability: availability,
+		transactor:   transactor,
 	}
 }
 
 func (es *EquipmentService) Create(ctx context.Context, equipment *models.Equipment) error {
+	if err := es.validate(ctx, equipment); err != nil {
+		return err
+	}
 	return es.repo.CreateEquipment(equipment)
 }
 
+func (es *EquipmentService) List(ctx context.Context, filter EquipmentListFilter, page pagination.Request) (pagination.Page[models.Equipment], error) {
+	repoFilter := repository.EquipmentFilter{
+		Tags:       normalizeTags(filter.Tags),
+		Attributes: filter.Attributes,
+		Search:     filter.Search,
+	}
+
+	if filter.AvailableFrom != nil || filter.AvailableTo != nil {
+		if filter.AvailableFrom == nil || filter.AvailableTo == nil || !filter.AvailableFrom.Before(*filter.AvailableTo) {
+			return pagination.Page[models.Equipment]{}, ErrInvalidDateRange
+		}
+		if filter.MinFree == 0 {
+			filter.MinFree = 1
+		}
+		if filter.MinFree < 0 {
+			return pagination.Page[models.Equipment]{}, ErrInvalidQuantity
+		}
+		repoFilter.Available = &repository.AvailabilityFilter{
+			From:           *filter.AvailableFrom,
+			To:             *filter.AvailableTo,
+			Quantity:       filter.MinFree,
+			BookedStatuses: availability.BookedStatusStrings(),
+		}
+	}
+
+	if filter.CategoryID != nil {
+		ids, err := es.categoryRepo.ListDescendantIDs(ctx, *filter.CategoryID)
+		if err != nil {
+			return pagination.Page[models.Equipment]{}, err
+		}
+		if len(ids) == 0 {
+			return pagination.Page[models.Equipment]{}, ErrCategoryNotFound
+		}
+		repoFilter.CategoryIDs = ids
+	}
+	return es.repo.ListEquipment(ctx, repoFilter, page)
+}
+
 func (es *EquipmentService) GetByID(ctx context.Context, id uint) (*models.Equipment, error) {
 	return es.repo.GetEquipmentByID(id)
 }
 
+// Update сохраняет оборудование. Если у него есть учтённые единицы,
+// AvailableQuantity из запроса игнорируется и выводится из их состояний.
 func (es *EquipmentService) Update(ctx context.Context, equipment *models.Equipment) error {
-	return es.repo.UpdateEquipment(equipment)
+	if err := es.validate(ctx, equipment); err != nil {
+		return err
+	}
+
+	return es.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		equipmentRepo := es.repo.WithTx(tx)
+		assetRepo := es.assetRepo.WithTx(tx)
+
+		// Блокировка упорядочивает пересчёт количества с регистрацией, выдачей
+		// и возвратом единиц. Save создал бы отсутствующую строку, поэтому
+		// существование проверяется здесь же
+		if _, err := equipmentRepo.GetEquipmentByIDForUpdate(ctx, equipment.ID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrEquipmentNotFound
+			}
+			return err
+		}
+
+		total, err := assetRepo.CountByEquipmentID(ctx, equipment.ID, nil)
+		if err != nil {
+			return err
+		}
+		if total > 0 {
+			inService, err := assetRepo.CountByEquipmentID(ctx, equipment.ID, inServiceStatuses)
+			if err != nil {
+				return err
+			}
+			equipment.AvailableQuantity = int(inService)
+		}
+		return equipmentRepo.UpdateEquipment(equipment)
+	})
+}
+
+// validate нормализует теги и проверяет свойства по схеме категории.
+// Оборудование без категории не может иметь свойств.
+func (es *EquipmentService) validate(ctx context.Context, equipment *models.Equipment) error {
+	equipment.Tags = normalizeTags(equipment.Tags)
+
+	schema := models.AttributeSchema{}
+	if equipment.CategoryID != nil {
+		var err error
+		if schema, err = effectiveSchema(ctx, es.categoryRepo, *equipment.CategoryID); err != nil {
+			return err
+		}
+	}
+	return validateAttributes(schema, equipment.Attributes)
+}
+
+// normalizeTags приводит теги к нижнему регистру и убирает повторы.
+func normalizeTags(tags []string) models.StringList {
+	normalized := models.StringList{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
 }
 
 func (es *EquipmentService) Delete(ctx context.Context, equipment *models.Equipment) error {
 	return es.repo.DeleteEquipment(equipment)
 }
+
+func (es *EquipmentService) Availability(ctx context.Context, id uint, from, to time.Time, granularity availability.Granularity) ([]availability.Bucket, error) {
+	buckets, err := es.availability.Calendar(ctx, id, from, to, granularity)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, ErrEquipmentNotFound
+	case errors.Is(err, availability.ErrInvalidRange):
+		return nil, ErrInvalidDateRange
+	}
+	return buckets, err
+}
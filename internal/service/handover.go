@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ticketprocessing/internal/lifecycle"
+	"ticketprocessing/internal/models"
+
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type HandoverRequest struct {
+	Note    string `json:"note"`
+	Damaged bool   `json:"damaged"`
+	// AssetIDs — выдаваемые единицы; обязательны при выдаче оборудования,
+	// у которого учтены единицы, и не используются при возврате
+	AssetIDs []uint `json:"asset_ids"`
+}
+
+// Handover — заявка после выдачи или возврата вместе с отчётом о состоянии
+// и затронутыми единицами оборудования.
+type Handover struct {
+	Request *models.RentalRequest   `json:"request"`
+	Report  *models.ConditionReport `json:"report"`
+	Assets  []models.Asset          `json:"assets,omitempty"`
+}
+
+// CheckOutRentalRequest отмечает выдачу одобренного оборудования.
+func (s *rentalRequestService) CheckOutRentalRequest(ctx context.Context, actor Actor, requestID uint, req HandoverRequest) (*Handover, error) {
+	return s.handover(ctx, actor, requestID, lifecycle.CheckedOut, models.HandoverCheckOut, "Checked out", req)
+}
+
+// ReturnRentalRequest отмечает возврат оборудования. Заявка в статусе
+// returned больше не занимает единицы, и они сразу снова доступны.
+func (s *rentalRequestService) ReturnRentalRequest(ctx context.Context, actor Actor, requestID uint, req HandoverRequest) (*Handover, error) {
+	return s.handover(ctx, actor, requestID, lifecycle.Returned, models.HandoverReturn, "Returned", req)
+}
+
+func (s *rentalRequestService) GetConditionReports(ctx context.Context, actor Actor, requestID uint) ([]models.ConditionReport, error) {
+	request, err := s.rentalRequestRepo.GetRentalRequestByID(requestID)
+	if err != nil {
+		return nil, ErrRentalRequestNotFound
+	}
+	if !actor.CanAccess(request) {
+		return nil, ErrForbidden
+	}
+	return s.conditionReportRepo.ListByRequestID(ctx, request.ID)
+}
+
+// handover меняет статус и сохраняет отчёт о состоянии в одной транзакции.
+func (s *rentalRequestService) handover(ctx context.Context, actor Actor, requestID uint, to lifecycle.Status, kind models.HandoverKind, action string, req HandoverRequest) (*Handover, error) {
+	report := &models.ConditionReport{
+		Kind:    kind,
+		StaffID: actor.UserID,
+		Note:    req.Note,
+		Damaged: req.Damaged,
+	}
+
+	comment := action
+	if req.Damaged {
+		comment += " (damaged)"
+	}
+	if req.Note != "" {
+		comment += ": " + req.Note
+	}
+
+	var assets []models.Asset
+	request, err := s.change(ctx, actor, requestID, func(tx *gorm.DB, request *models.RentalRequest) error {
+		var err error
+		if kind == models.HandoverCheckOut {
+			assets, err = s.assignAssets(ctx, tx, actor, request, req.AssetIDs)
+		} else {
+			assets, err = s.releaseAssets(ctx, tx, actor, request, req.Damaged)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = s.lifecycle.TransitionTx(ctx, tx, request, to, lifecycle.Change{
+			Comment: comment,
+			ActorID: &actor.UserID,
+		})
+		if errors.Is(err, lifecycle.ErrInvalidTransition) {
+			return ErrInvalidStatus
+		}
+		if err != nil {
+			return err
+		}
+
+		report.RequestID = request.ID
+		return s.conditionReportRepo.WithTx(tx).CreateReport(ctx, report)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handover{Request: request, Report: report, Assets: assets}, nil
+}
+
+// assignAssets закрепляет за заявкой конкретные единицы. Оборудование
+// блокируется раньше единиц, как и при их ручном изменении.
+func (s *rentalRequestService) assignAssets(ctx context.Context, tx *gorm.DB, actor Actor, request *models.RentalRequest, ids []uint) ([]models.Asset, error) {
+	if lifecycle.Status(request.Status) != lifecycle.Approved {
+		return nil, ErrInvalidStatus
+	}
+
+	equipmentRepo := s.equipmentRepo.WithTx(tx)
+	assetRepo := s.assetRepo.WithTx(tx)
+
+	if _, err := equipmentRepo.GetEquipmentByIDForUpdate(ctx, request.EquipmentID); err != nil {
+		return nil, err
+	}
+
+	total, err := assetRepo.CountByEquipmentID(ctx, request.EquipmentID, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Оборудование учитывается только количеством
+	if total == 0 && len(ids) == 0 {
+		return nil, nil
+	}
+
+	unique := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	if len(unique) != len(ids) || len(ids) != request.Quantity {
+		return nil, ErrAssetCountMismatch
+	}
+
+	assets, err := assetRepo.ListByIDsForUpdate(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(assets) != len(ids) {
+		return nil, ErrAssetNotFound
+	}
+
+	for i := range assets {
+		asset := &assets[i]
+		if asset.EquipmentID != request.EquipmentID || asset.Status != models.AssetAvailable {
+			return nil, fmt.Errorf("%w: %s", ErrAssetUnavailable, asset.AssetTag)
+		}
+
+		asset.Status = models.AssetCheckedOut
+		asset.RequestID = &request.ID
+		if err := assetRepo.UpdateAsset(ctx, asset); err != nil {
+			return nil, err
+		}
+		if err := recordAssetEvent(ctx, assetRepo, asset, &actor.UserID, fmt.Sprintf("Checked out for request #%d", request.ID)); err != nil {
+			return nil, err
+		}
+	}
+
+	return assets, nil
+}
+
+// releaseAssets возвращает выданные по заявке единицы. Повреждённые
+// единицы уходят на обслуживание и перестают учитываться в количестве.
+func (s *rentalRequestService) releaseAssets(ctx context.Context, tx *gorm.DB, actor Actor, request *models.RentalRequest, damaged bool) ([]models.Asset, error) {
+	if lifecycle.Status(request.Status) != lifecycle.CheckedOut {
+		return nil, ErrInvalidStatus
+	}
+
+	equipmentRepo := s.equipmentRepo.WithTx(tx)
+	assetRepo := s.assetRepo.WithTx(tx)
+
+	if _, err := equipmentRepo.GetEquipmentByIDForUpdate(ctx, request.EquipmentID); err != nil {
+		return nil, err
+	}
+
+	assets, err := assetRepo.ListByRequestIDForUpdate(ctx, request.ID)
+	if err != nil || len(assets) == 0 {
+		return nil, err
+	}
+
+	status, comment := models.AssetAvailable, fmt.Sprintf("Returned from request #%d", request.ID)
+	if damaged {
+		status, comment = models.AssetMaintenance, fmt.Sprintf("Returned damaged from request #%d", request.ID)
+	}
+
+	for i := range assets {
+		asset := &assets[i]
+		asset.Status = status
+		asset.RequestID = nil
+		if err := assetRepo.UpdateAsset(ctx, asset); err != nil {
+			return nil, err
+		}
+		event := &models.AssetEvent{
+			AssetID:   asset.ID,
+			Status:    asset.Status,
+			Location:  asset.Location,
+			RequestID: &request.ID,
+			ActorID:   &actor.UserID,
+			Comment:   comment,
+			Timestamp: time.Now(),
+		}
+		if err := assetRepo.CreateEvent(ctx, event); err != nil {
+			return nil, err
+		}
+	}
+
+	return assets, syncEquipmentQuantity(ctx, assetRepo, equipmentRepo, request.EquipmentID)
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"ticketprocessing/internal/auth"
+	"ticketprocessing/internal/mailer"
+	"ticketprocessing/internal/models"
+	"time"
+)
+
+var (
+	ErrInvalidMFAToken   = errors.New("invalid or expired mfa token")
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication not enabled")
+	ErrMFASetupRequired  = errors.New("two-factor authentication setup not started")
+	// ErrMFARequired — второй фактор нельзя отключить, его требует роль
+	ErrMFARequired = errors.New("two-factor authentication required for role")
+)
+
+// TOTPSetup — данные для добавления учётной записи в приложение-аутентификатор.
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// LoginMFA завершает вход кодом TOTP или резервным кодом. После
+// maxMFAAttempts неверных кодов challenge сгорает и вход начинается заново.
+func (s *authService) LoginMFA(ctx context.Context, mfaToken, code string, meta SessionMeta) (*TokenPair, error) {
+	userID, err := s.tokenStore.GetMFAChallenge(ctx, mfaToken)
+	switch {
+	case errors.Is(err, auth.ErrTokenNotFound):
+		return nil, ErrInvalidMFAToken
+	case err != nil:
+		return nil, ErrInternal
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	if err := s.checkLockout(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := s.tokenStore.FailMFAChallenge(ctx, mfaToken); err != nil {
+			return nil, ErrInternal
+		}
+		return nil, s.loginFailed(ctx, user.ID, ErrInvalidMFACode)
+	}
+
+	consumed, err := s.tokenStore.ConsumeMFAChallenge(ctx, mfaToken)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	if !consumed {
+		return nil, ErrInvalidMFAToken
+	}
+
+	tokens, err := s.startSession(ctx, user, meta, true)
+	if err != nil {
+		return nil, err
+	}
+	s.loginSucceeded(ctx, user.ID)
+	return tokens, nil
+}
+
+// SetupTOTP выпускает новый секрет. Второй фактор начинает действовать
+// только после EnableTOTP с кодом из приложения.
+func (s *authService) SetupTOTP(ctx context.Context, userID uint) (*TOTPSetup, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return nil, ErrInternal
+	}
+	user.TOTPSecret = secret
+	if err := s.repo.UpdateUser(user); err != nil {
+		return nil, ErrInternal
+	}
+
+	return &TOTPSetup{Secret: secret, URI: auth.TOTPURI(s.mfa.Issuer, user.Email, secret)}, nil
+}
+
+// EnableTOTP включает второй фактор и возвращает резервные коды. Текущая
+// сессия считается подтверждённой: после обновления токена в нём будет
+// полная роль пользователя.
+func (s *authService) EnableTOTP(ctx context.Context, userID uint, sessionID, code string) ([]string, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFASetupRequired
+	}
+
+	ok, err := s.checkTOTP(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, ErrInternal
+	}
+	user.TOTPEnabled = true
+	user.RecoveryCodes = hashes
+	if err := s.repo.UpdateUser(user); err != nil {
+		return nil, ErrInternal
+	}
+
+	session, err := s.tokenStore.GetSession(ctx, sessionID)
+	if err == nil && session.UserID == user.ID {
+		session.MFA = true
+		err = s.tokenStore.TouchSession(ctx, session)
+	}
+	if err != nil {
+		slog.Warn("failed to mark session as mfa verified", slog.String("session_id", sessionID), slog.String("error", err.Error()))
+	}
+
+	s.notifyMFAChange(ctx, user, "enabled")
+	return codes, nil
+}
+
+// DisableTOTP отключает второй фактор по действующему коду.
+func (s *authService) DisableTOTP(ctx context.Context, userID uint, code string) error {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if !user.TOTPEnabled {
+		return ErrMFANotEnabled
+	}
+	if s.mfaEnforced(user.Role) {
+		return ErrMFARequired
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.RecoveryCodes = models.StringList{}
+	if err := s.repo.UpdateUser(user); err != nil {
+		return ErrInternal
+	}
+
+	s.notifyMFAChange(ctx, user, "disabled")
+	return nil
+}
+
+// RegenerateRecoveryCodes заменяет резервные коды новыми, старые перестают действовать.
+func (s *authService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	ok, err := s.checkTOTP(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, ErrInternal
+	}
+	user.RecoveryCodes = hashes
+	if err := s.repo.UpdateUser(user); err != nil {
+		return nil, ErrInternal
+	}
+	return codes, nil
+}
+
+// checkSecondFactor принимает код TOTP или резервный код. Резервный код
+// одноразовый и удаляется после использования.
+func (s *authService) checkSecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+	ok, err := s.checkTOTP(ctx, user, code)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	i := slices.Index(user.RecoveryCodes, auth.HashRecoveryCode(code))
+	if i < 0 {
+		return false, nil
+	}
+	user.RecoveryCodes = slices.Delete(user.RecoveryCodes, i, i+1)
+	if err := s.repo.UpdateUser(user); err != nil {
+		return false, ErrInternal
+	}
+	slog.Info("recovery code used", slog.Uint64("user_id", uint64(user.ID)), slog.Int("remaining", len(user.RecoveryCodes)))
+	return true, nil
+}
+
+// checkTOTP проверяет код и не даёт предъявить один и тот же код дважды.
+func (s *authService) checkTOTP(ctx context.Context, user *models.User, code string) (bool, error) {
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	fresh, err := s.tokenStore.UseTOTPStep(ctx, user.ID, step)
+	if err != nil {
+		return false, ErrInternal
+	}
+	return fresh, nil
+}
+
+func (s *authService) mfaEnforced(role models.Role) bool {
+	return slices.Contains(s.mfa.EnforceRoles, string(role))
+}
+
+// effectiveRole — роль для access-токена. Роль, требующая второго фактора,
+// выдаётся только сессии, подтверждённой им (своим TOTP или у провайдера
+// OIDC); иначе пользователь получает права user и может лишь настроить
+// второй фактор.
+//
+// Пока второй фактор не настроен, роль сохраняется до mfa.grace_until, а
+// администраторам из rbac.admin_emails — без срока: иначе после включения
+// enforce_roles единственный администратор потерял бы доступ к настройкам.
+func (s *authService) effectiveRole(user *models.User, session *auth.Session) models.Role {
+	if !s.mfaEnforced(user.Role) || session.MFA {
+		return user.Role
+	}
+	if !user.TOTPEnabled && (time.Now().Before(s.mfa.GraceUntil) || s.isBootstrapAdmin(user.Email)) {
+		slog.Warn("role requires two-factor authentication, not enrolled yet",
+			slog.Uint64("user_id", uint64(user.ID)), slog.String("role", string(user.Role)))
+		return user.Role
+	}
+	return models.RoleUser
+}
+
+// notifyMFAChange сообщает владельцу об изменении второго фактора на случай,
+// если это сделал не он.
+func (s *authService) notifyMFAChange(ctx context.Context, user *models.User, change string) {
+	err := s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Two-factor authentication " + change,
+		Body: fmt.Sprintf("Hello, %s!\n\n"+
+			"Two-factor authentication has been %s for your account.\n"+
+			"If you did not do this, reset your password and contact an administrator.\n",
+			user.Name, change),
+	})
+	if err != nil {
+		slog.Warn("failed to send mfa notification", slog.Uint64("user_id", uint64(user.ID)), slog.String("error", err.Error()))
+	}
+}
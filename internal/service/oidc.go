@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"ticketprocessing/internal/auth"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/oidc"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOIDCDisabled     = errors.New("oidc login is disabled")
+	ErrInvalidOIDCState = errors.New("invalid or expired oidc state")
+	ErrOIDCLoginFailed  = errors.New("oidc login failed")
+	// ErrOIDCEmailRequired — провайдер не передал email, без него нельзя
+	// создать учётную запись
+	ErrOIDCEmailRequired = errors.New("identity provider did not return an email")
+	// ErrOIDCLinkRefused — учётную запись с этим email нельзя привязать
+	// автоматически, в неё нужно входить паролем
+	ErrOIDCLinkRefused = errors.New("account with this email cannot be linked to the identity provider")
+)
+
+// oidcStateTTL — сколько ждём возврата пользователя от провайдера
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCLoginURL начинает вход через провайдера: сохраняет state, nonce и
+// code_verifier и возвращает адрес страницы входа.
+func (s *authService) OIDCLoginURL(ctx context.Context) (string, error) {
+	if s.oidc == nil {
+		return "", ErrOIDCDisabled
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		return "", ErrInternal
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		return "", ErrInternal
+	}
+	pkce, err := oidc.NewPKCE()
+	if err != nil {
+		return "", ErrInternal
+	}
+
+	if err := s.tokenStore.SaveOIDCState(ctx, state, auth.OIDCState{Nonce: nonce, Verifier: pkce.Verifier}, oidcStateTTL); err != nil {
+		return "", ErrInternal
+	}
+
+	loginURL, err := s.oidc.AuthCodeURL(ctx, state, nonce, pkce.Challenge)
+	if err != nil {
+		slog.Error("oidc provider unavailable", slog.String("error", err.Error()))
+		return "", ErrOIDCLoginFailed
+	}
+	return loginURL, nil
+}
+
+// LoginOIDC завершает вход по коду авторизации. Пользователь ищется по
+// issuer и sub; при первом входе существующая учётная запись привязывается
+// по подтверждённому провайдером email, иначе создаётся новая. Учётные записи
+// с повышенной ролью или своим вторым фактором автоматически не привязываются.
+func (s *authService) LoginOIDC(ctx context.Context, state, code string, meta SessionMeta) (*LoginResult, error) {
+	if s.oidc == nil {
+		return nil, ErrOIDCDisabled
+	}
+
+	saved, err := s.tokenStore.ConsumeOIDCState(ctx, state)
+	switch {
+	case errors.Is(err, auth.ErrTokenNotFound):
+		return nil, ErrInvalidOIDCState
+	case err != nil:
+		return nil, ErrInternal
+	}
+
+	claims, err := s.oidc.Exchange(ctx, code, saved.Verifier, saved.Nonce)
+	if err != nil {
+		slog.Warn("oidc code exchange failed", slog.String("error", err.Error()))
+		return nil, ErrOIDCLoginFailed
+	}
+
+	user, err := s.oidcUser(claims)
+	if err != nil {
+		return nil, err
+	}
+	if user.ServiceAccount {
+		return nil, ErrOIDCLoginFailed
+	}
+
+	if err := s.checkLockout(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	if s.isBootstrapAdmin(user.Email) && user.Role != models.RoleAdmin {
+		user.Role = models.RoleAdmin
+		if err := s.repo.UpdateUser(user); err != nil {
+			return nil, ErrInternal
+		}
+	}
+
+	// Второй фактор, пройденный у провайдера, засчитывается; иначе
+	// действует собственный TOTP, как при входе по паролю
+	idpMFA := s.oidcCfg.TrustIdPMFA || slices.Contains(claims.AMR, "mfa")
+	if user.TOTPEnabled && !idpMFA {
+		ttl := time.Duration(s.mfa.ChallengeTTLMinutes) * time.Minute
+		challenge, err := s.tokenStore.IssueMFAChallenge(ctx, user.ID, ttl)
+		if err != nil {
+			return nil, ErrInternal
+		}
+		return &LoginResult{MFAToken: challenge, MFAExpiresIn: int(ttl.Seconds())}, nil
+	}
+
+	tokens, err := s.startSession(ctx, user, meta, idpMFA)
+	if err != nil {
+		return nil, err
+	}
+	s.loginSucceeded(ctx, user.ID)
+	return &LoginResult{Tokens: tokens, MFASetupRequired: s.mfaEnforced(user.Role) && !idpMFA}, nil
+}
+
+// oidcUser находит, привязывает или создаёт пользователя по утверждениям id_token.
+func (s *authService) oidcUser(claims *oidc.Claims) (*models.User, error) {
+	issuer := s.oidc.Issuer()
+
+	user, err := s.repo.GetUserByOIDCSubject(issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInternal
+	}
+
+	if claims.Email == "" {
+		return nil, ErrOIDCEmailRequired
+	}
+	// Неподтверждённому email верить нельзя: так можно было бы войти в
+	// чужую учётную запись, указав у провайдера её адрес
+	if !claims.EmailVerified {
+		slog.Warn("oidc login with unverified email rejected", slog.String("subject", claims.Subject))
+		return nil, ErrOIDCLoginFailed
+	}
+
+	now := time.Now()
+	user, err = s.repo.GetUserByEmail(claims.Email)
+	switch {
+	case err == nil:
+		if user.OIDCSubject != nil {
+			// Учётная запись уже привязана к другому sub у этого или другого провайдера
+			slog.Warn("oidc account link conflict", slog.Uint64("user_id", uint64(user.ID)), slog.String("subject", claims.Subject))
+			return nil, ErrOIDCLoginFailed
+		}
+		// Иначе взломанный или неверно настроенный провайдер получил бы
+		// учётную запись администратора, а при trust_idp_mfa — ещё и в обход TOTP
+		if user.Role != models.RoleUser || user.TOTPEnabled || s.isBootstrapAdmin(user.Email) {
+			slog.Warn("oidc account link refused", slog.Uint64("user_id", uint64(user.ID)), slog.String("subject", claims.Subject))
+			return nil, ErrOIDCLinkRefused
+		}
+		user.OIDCIssuer = &issuer
+		user.OIDCSubject = &claims.Subject
+		if user.EmailVerifiedAt == nil {
+			user.EmailVerifiedAt = &now
+		}
+		if err := s.repo.UpdateUser(user); err != nil {
+			return nil, ErrInternal
+		}
+		slog.Info("oidc identity linked", slog.Uint64("user_id", uint64(user.ID)))
+		return user, nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, ErrInternal
+	}
+
+	// Пароля у такой учётной записи нет, его можно задать через сброс пароля
+	user = &models.User{
+		Name:            oidcName(claims),
+		Email:           claims.Email,
+		Role:            models.Role(s.oidcCfg.DefaultRole),
+		EmailVerifiedAt: &now,
+		OIDCIssuer:      &issuer,
+		OIDCSubject:     &claims.Subject,
+	}
+	if s.isBootstrapAdmin(user.Email) {
+		user.Role = models.RoleAdmin
+	}
+	if err := s.repo.CreateUser(user); err != nil {
+		return nil, ErrInternal
+	}
+	slog.Info("user provisioned via oidc", slog.Uint64("user_id", uint64(user.ID)), slog.String("role", string(user.Role)))
+	return user, nil
+}
+
+func oidcName(claims *oidc.Claims) string {
+	switch {
+	case claims.Name != "":
+		return claims.Name
+	case claims.PreferredUsername != "":
+		return claims.PreferredUsername
+	}
+	name, _, _ := strings.Cut(claims.Email, "@")
+	return name
+}
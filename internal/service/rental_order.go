@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"ticketprocessing/internal/availability"
+	"ticketprocessing/internal/lifecycle"
+	"ticketprocessing/internal/messaging"
+	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRentalOrderNotFound = errors.New("rental order not found")
+	ErrEmptyOrder          = errors.New("order must contain at least one line")
+	ErrDuplicateOrderLine  = errors.New("order contains the same equipment more than once")
+)
+
+type RentalOrderLine struct {
+	EquipmentID uint `json:"equipment_id"`
+	// Quantity по умолчанию 1
+	Quantity int `json:"quantity"`
+}
+
+type CreateRentalOrderRequest struct {
+	FromDate time.Time         `json:"from_date"`
+	ToDate   time.Time         `json:"to_date"`
+	Lines    []RentalOrderLine `json:"lines"`
+}
+
+type ModifyRentalOrderRequest struct {
+	FromDate time.Time `json:"from_date"`
+	ToDate   time.Time `json:"to_date"`
+}
+
+type ExtendRentalOrderRequest struct {
+	ToDate time.Time `json:"to_date"`
+}
+
+type RentalOrderService interface {
+	CreateRentalOrder(ctx context.Context, userID uint, req CreateRentalOrderRequest) (*models.RentalOrder, error)
+	GetRentalOrder(ctx context.Context, actor Actor, orderID uint) (*models.RentalOrder, error)
+	CancelRentalOrder(ctx context.Context, actor Actor, orderID uint, comment string) (*models.RentalOrder, error)
+	ModifyRentalOrder(ctx context.Context, actor Actor, orderID uint, req ModifyRentalOrderRequest) (*models.RentalOrder, error)
+	ExtendRentalOrder(ctx context.Context, actor Actor, orderID uint, req ExtendRentalOrderRequest) (*models.RentalOrder, error)
+}
+
+type rentalOrderService struct {
+	rentalOrderRepo   repository.RentalOrderRepository
+	rentalRequestRepo repository.RentalRequestRepository
+	equipmentRepo     repository.EquipmentRepository
+	availability      *availability.Checker
+	lifecycle         *lifecycle.Machine
+	transactor        repository.Transactor
+	outboxRepo        repository.OutboxRepository
+}
+
+func NewRentalOrderService(
+	rentalOrderRepo repository.RentalOrderRepository,
+	rentalRequestRepo repository.RentalRequestRepository,
+	equipmentRepo repository.EquipmentRepository,
+	availability *availability.Checker,
+	lifecycle *lifecycle.Machine,
+	transactor repository.Transactor,
+	outboxRepo repository.OutboxRepository,
+) RentalOrderService {
+	return &rentalOrderService{
+		rentalOrderRepo:   rentalOrderRepo,
+		rentalRequestRepo: rentalRequestRepo,
+		equipmentRepo:     equipmentRepo,
+		availability:      availability,
+		lifecycle:         lifecycle,
+		transactor:        transactor,
+		outboxRepo:        outboxRepo,
+	}
+}
+
+// CreateRentalOrder создаёт заказ и по заявке на каждую строку. Воркер
+// получает одно сообщение на весь заказ и одобряет или отклоняет строки вместе.
+func (s *rentalOrderService) CreateRentalOrder(ctx context.Context, userID uint, req CreateRentalOrderRequest) (*models.RentalOrder, error) {
+	if len(req.Lines) == 0 {
+		return nil, ErrEmptyOrder
+	}
+	if !req.FromDate.Before(req.ToDate) {
+		return nil, ErrInvalidDateRange
+	}
+
+	seen := make(map[uint]bool, len(req.Lines))
+	for i, line := range req.Lines {
+		if seen[line.EquipmentID] {
+			return nil, ErrDuplicateOrderLine
+		}
+		seen[line.EquipmentID] = true
+
+		if line.Quantity == 0 {
+			req.Lines[i].Quantity = 1
+		}
+		if line.Quantity < 0 {
+			return nil, ErrInvalidQuantity
+		}
+
+		if _, err := s.equipmentRepo.GetEquipmentByID(line.EquipmentID); err != nil {
+			return nil, fmt.Errorf("%w: equipment %d", ErrEquipmentNotFound, line.EquipmentID)
+		}
+
+		// Предварительная проверка, окончательно резервирует воркер
+		result, err := s.availability.Check(ctx, line.EquipmentID, req.FromDate, req.ToDate, 0)
+		if err != nil {
+			return nil, err
+		}
+		if !result.Fits(req.Lines[i].Quantity) {
+			return nil, fmt.Errorf("%w: equipment %d", ErrEquipmentUnavailable, line.EquipmentID)
+		}
+	}
+
+	order := &models.RentalOrder{
+		UserID:   userID,
+		FromDate: req.FromDate,
+		ToDate:   req.ToDate,
+		Status:   string(lifecycle.Pending),
+	}
+
+	err := s.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		if err := s.rentalOrderRepo.WithTx(tx).CreateOrder(ctx, order); err != nil {
+			return err
+		}
+
+		// У каждой строки собственный журнал статусов
+		for _, line := range req.Lines {
+			request := models.RentalRequest{
+				UserID:      userID,
+				OrderID:     &order.ID,
+				EquipmentID: line.EquipmentID,
+				Quantity:    line.Quantity,
+				FromDate:    req.FromDate,
+				ToDate:      req.ToDate,
+			}
+			if err := s.lifecycle.CreateTx(ctx, tx, &request, lifecycle.Change{
+				Comment: fmt.Sprintf("Request created as part of order #%d", order.ID),
+				ActorID: &userID,
+			}); err != nil {
+				return err
+			}
+			order.Lines = append(order.Lines, request)
+		}
+
+		return s.enqueueOrder(ctx, tx, messaging.EventRentalOrderCreated, order, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (s *rentalOrderService) GetRentalOrder(ctx context.Context, actor Actor, orderID uint) (*models.RentalOrder, error) {
+	order, err := s.rentalOrderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, ErrRentalOrderNotFound
+	}
+	if !actor.IsStaff() && order.UserID != actor.UserID {
+		return nil, ErrForbidden
+	}
+	return order, nil
+}
+
+// CancelRentalOrder отменяет все незавершённые строки заказа до выдачи
+// оборудования. Если отменить нельзя хотя бы одну строку, не отменяется ни одна.
+func (s *rentalOrderService) CancelRentalOrder(ctx context.Context, actor Actor, orderID uint, comment string) (*models.RentalOrder, error) {
+	if comment == "" {
+		comment = "Order cancelled"
+	}
+
+	return s.change(ctx, actor, orderID, func(tx *gorm.DB, order *models.RentalOrder, lines []*models.RentalRequest) error {
+		for _, line := range lines {
+			err := s.lifecycle.TransitionTx(ctx, tx, line, lifecycle.Cancelled, lifecycle.Change{
+				Comment: comment,
+				ActorID: &actor.UserID,
+			})
+			if errors.Is(err, lifecycle.ErrInvalidTransition) {
+				return ErrInvalidStatus
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return s.enqueueOrder(ctx, tx, messaging.EventRentalOrderCancelled, order, nil)
+	})
+}
+
+// ModifyRentalOrder меняет даты всех строк заказа, пока они не одобрены.
+// Строки возвращаются в статус pending, и воркер заново оценивает заказ целиком.
+func (s *rentalOrderService) ModifyRentalOrder(ctx context.Context, actor Actor, orderID uint, req ModifyRentalOrderRequest) (*models.RentalOrder, error) {
+	if !req.FromDate.Before(req.ToDate) {
+		return nil, ErrInvalidDateRange
+	}
+
+	return s.change(ctx, actor, orderID, func(tx *gorm.DB, order *models.RentalOrder, lines []*models.RentalRequest) error {
+		for _, line := range lines {
+			status := lifecycle.Status(line.Status)
+			if status != lifecycle.Pending && status != lifecycle.AwaitingReview {
+				return ErrInvalidStatus
+			}
+
+			result, err := s.availability.Check(ctx, line.EquipmentID, req.FromDate, req.ToDate, line.ID)
+			if err != nil {
+				return err
+			}
+			if !result.Fits(line.Quantity) {
+				return fmt.Errorf("%w: equipment %d", ErrEquipmentUnavailable, line.EquipmentID)
+			}
+
+			change := lifecycle.Change{
+				Comment: fmt.Sprintf("Order #%d dates changed from %s – %s to %s – %s", order.ID,
+					line.FromDate.Format(time.RFC3339), line.ToDate.Format(time.RFC3339),
+					req.FromDate.Format(time.RFC3339), req.ToDate.Format(time.RFC3339)),
+				ActorID: &actor.UserID,
+			}
+			line.FromDate = req.FromDate
+			line.ToDate = req.ToDate
+
+			if status == lifecycle.AwaitingReview {
+				err = s.lifecycle.TransitionTx(ctx, tx, line, lifecycle.Pending, change)
+			} else {
+				err = s.lifecycle.AmendTx(ctx, tx, line, change)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		order.FromDate, order.ToDate = req.FromDate, req.ToDate
+		return s.enqueueOrder(ctx, tx, messaging.EventRentalOrderModified, order, nil)
+	})
+}
+
+// ExtendRentalOrder переносит дату окончания всех строк одобренного или
+// выданного заказа. Дополнительный период резервируется сразу, воркер затем
+// проверяет правила для всех строк и при отказе откатывает продление целиком.
+func (s *rentalOrderService) ExtendRentalOrder(ctx context.Context, actor Actor, orderID uint, req ExtendRentalOrderRequest) (*models.RentalOrder, error) {
+	return s.change(ctx, actor, orderID, func(tx *gorm.DB, order *models.RentalOrder, lines []*models.RentalRequest) error {
+		previousToDate := order.ToDate
+		for _, line := range lines {
+			// Следующее продление — только после решения по предыдущему
+			if !slices.Contains(extendableStatuses, line.Status) || line.PreviousToDate != nil {
+				return ErrInvalidStatus
+			}
+			if !req.ToDate.After(line.ToDate) {
+				return ErrInvalidDateRange
+			}
+
+			_, err := s.availability.Reserve(ctx, tx, line.EquipmentID, line.ToDate, req.ToDate, line.Quantity, line.ID)
+			switch {
+			case errors.Is(err, availability.ErrUnavailable):
+				return fmt.Errorf("%w: equipment %d", ErrEquipmentUnavailable, line.EquipmentID)
+			case err != nil:
+				return err
+			}
+
+			change := lifecycle.Change{
+				Comment: fmt.Sprintf("Order #%d extended from %s to %s", order.ID,
+					line.ToDate.Format(time.RFC3339), req.ToDate.Format(time.RFC3339)),
+				ActorID: &actor.UserID,
+			}
+			line.ToDate = req.ToDate
+			if err := s.lifecycle.AmendTx(ctx, tx, line, change); err != nil {
+				return err
+			}
+		}
+
+		order.ToDate = req.ToDate
+		return s.enqueueOrder(ctx, tx, messaging.EventRentalOrderExtended, order, &previousToDate)
+	})
+}
+
+// change блокирует строки заказа, затем сам заказ, проверяет права и
+// выполняет fn для незавершённых строк в одной транзакции. Строки
+// блокируются раньше заказа, как и при переходе одной строки в
+// lifecycle.Machine. Возвращает заказ после изменения.
+func (s *rentalOrderService) change(ctx context.Context, actor Actor, orderID uint, fn func(tx *gorm.DB, order *models.RentalOrder, lines []*models.RentalRequest) error) (*models.RentalOrder, error) {
+	err := s.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		lines, err := s.rentalRequestRepo.WithTx(tx).ListByOrderIDForUpdate(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		order, err := s.rentalOrderRepo.WithTx(tx).GetOrderByIDForUpdate(ctx, orderID)
+		if err != nil {
+			return ErrRentalOrderNotFound
+		}
+		if !actor.IsStaff() && order.UserID != actor.UserID {
+			return ErrForbidden
+		}
+
+		var active []*models.RentalRequest
+		for i := range lines {
+			if !lifecycle.IsTerminal(lifecycle.Status(lines[i].Status)) {
+				active = append(active, &lines[i])
+			}
+		}
+		if len(active) == 0 {
+			return ErrInvalidStatus
+		}
+		return fn(tx, order, active)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.rentalOrderRepo.GetOrderByID(ctx, orderID)
+}
+
+// enqueueOrder записывает событие по заказу в outbox в транзакции tx.
+func (s *rentalOrderService) enqueueOrder(ctx context.Context, tx *gorm.DB, event string, order *models.RentalOrder, previousToDate *time.Time) error {
+	msg := messaging.RentalRequestMessage{
+		Event:    event,
+		OrderID:  order.ID,
+		UserID:   order.UserID,
+		FromDate: order.FromDate.Format(time.RFC3339Nano),
+		ToDate:   order.ToDate.Format(time.RFC3339Nano),
+	}
+	if previousToDate != nil {
+		msg.PreviousToDate = previousToDate.Format(time.RFC3339Nano)
+	}
+
+	return enqueue(ctx, s.outboxRepo.WithTx(tx), msg)
+}
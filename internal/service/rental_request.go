@@ -3,11 +3,18 @@ package service
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
+	"slices"
+	"strings"
+	"ticketprocessing/internal/availability"
+	"ticketprocessing/internal/lifecycle"
 	"ticketprocessing/internal/messaging"
 	"ticketprocessing/internal/models"
+	"ticketprocessing/internal/pagination"
 	"ticketprocessing/internal/repository"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 var (
@@ -15,47 +22,130 @@ var (
 	ErrInvalidDateTime       = errors.New("invalid datetime format")
 	ErrEquipmentNotFound     = errors.New("equipment not found")
 	ErrInvalidDateRange      = errors.New("invalid date range")
+	ErrEquipmentUnavailable  = errors.New("equipment is not available for the requested period")
+	ErrCommentRequired       = errors.New("comment is required")
+	ErrInvalidStatus         = errors.New("operation is not allowed in the current request status")
+	ErrInvalidQuantity       = errors.New("quantity must be positive")
+	ErrOrderLine             = errors.New("operation must be applied to the whole order")
+	ErrInvalidStatusFilter   = errors.New("unknown rental request status")
 )
 
+// extendableStatuses — статусы, в которых заявку можно продлить
+var extendableStatuses = []string{string(lifecycle.Approved), string(lifecycle.CheckedOut)}
+
+type ModifyRentalRequestRequest struct {
+	FromDate time.Time `json:"from_date"`
+	ToDate   time.Time `json:"to_date"`
+}
+
+type ExtendRentalRequestRequest struct {
+	ToDate time.Time `json:"to_date"`
+}
+
+// RentalRequestListFilter — условия выборки заявок из запроса.
+type RentalRequestListFilter struct {
+	UserID      *uint
+	EquipmentID *uint
+	Statuses    []string
+	// From и To — период, с которым пересекается заявка
+	From        *time.Time
+	To          *time.Time
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
 type CreateRentalRequestRequest struct {
-	EquipmentID uint      `json:"equipment_id"`
-	FromDate    time.Time `json:"from_date"`
-	ToDate      time.Time `json:"to_date"`
+	EquipmentID uint `json:"equipment_id"`
+	// Quantity по умолчанию 1
+	Quantity int       `json:"quantity"`
+	FromDate time.Time `json:"from_date"`
+	ToDate   time.Time `json:"to_date"`
 }
 
+// StatusHistoryEntry — запись журнала статусов с автором и временем,
+// проведённым заявкой в этом статусе.
+type StatusHistoryEntry struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Comment   string    `json:"comment"`
+	ActorID   *uint     `json:"actor_id"`
+	Actor     string    `json:"actor"`
+	// DurationSeconds — сколько заявка пробыла в статусе, с этой записи до
+	// смены статуса; для текущего статуса — до момента запроса. У записей об
+	// изменении без смены статуса (изменение, продление) он нулевой: время
+	// учтено в записи, с которой статус начался.
+	DurationSeconds int64 `json:"duration_seconds"`
+	Current         bool  `json:"current"`
+}
+
+const systemActor = "system"
+
 type RentalRequestService interface {
-	GetRequestStatus(ctx context.Context, requestID uint) (*models.RequestStatusLog, error)
-	GetRequestStatusAt(ctx context.Context, requestID uint, datetime time.Time) (*models.RequestStatusLog, error)
+	GetRequestStatus(ctx context.Context, actor Actor, requestID uint) (*models.RequestStatusLog, error)
+	GetRequestStatusAt(ctx context.Context, actor Actor, requestID uint, datetime time.Time) (*models.RequestStatusLog, error)
+	GetRequestHistory(ctx context.Context, actor Actor, requestID uint) ([]StatusHistoryEntry, error)
 	CreateRentalRequest(ctx context.Context, userID uint, req CreateRentalRequestRequest) (*models.RentalRequest, error)
+	GetReviewQueue(ctx context.Context) ([]models.RentalRequest, error)
+	ListOwnRentalRequests(ctx context.Context, actor Actor, filter RentalRequestListFilter, page pagination.Request) (pagination.Page[models.RentalRequest], error)
+	SearchRentalRequests(ctx context.Context, filter RentalRequestListFilter, page pagination.Request) (pagination.Page[models.RentalRequest], error)
+	ApproveRentalRequest(ctx context.Context, actor Actor, requestID uint, comment string) (*models.RentalRequest, error)
+	RejectRentalRequest(ctx context.Context, actor Actor, requestID uint, comment string) (*models.RentalRequest, error)
+	CancelRentalRequest(ctx context.Context, actor Actor, requestID uint, comment string) (*models.RentalRequest, error)
+	ModifyRentalRequest(ctx context.Context, actor Actor, requestID uint, req ModifyRentalRequestRequest) (*models.RentalRequest, error)
+	ExtendRentalRequest(ctx context.Context, actor Actor, requestID uint, req ExtendRentalRequestRequest) (*models.RentalRequest, error)
+	CheckOutRentalRequest(ctx context.Context, actor Actor, requestID uint, req HandoverRequest) (*Handover, error)
+	ReturnRentalRequest(ctx context.Context, actor Actor, requestID uint, req HandoverRequest) (*Handover, error)
+	GetConditionReports(ctx context.Context, actor Actor, requestID uint) ([]models.ConditionReport, error)
 }
 
 type rentalRequestService struct {
-	rentalRequestRepo repository.RentalRequestRepository
-	statusLogRepo     repository.RequestStatusLogRepository
-	equipmentRepo     repository.EquipmentRepository
-	publisher         messaging.RabbitMQPublisher
+	rentalRequestRepo   repository.RentalRequestRepository
+	statusLogRepo       repository.RequestStatusLogRepository
+	equipmentRepo       repository.EquipmentRepository
+	authRepo            repository.AuthRepository
+	availability        *availability.Checker
+	lifecycle           *lifecycle.Machine
+	transactor          repository.Transactor
+	outboxRepo          repository.OutboxRepository
+	conditionReportRepo repository.ConditionReportRepository
+	assetRepo           repository.AssetRepository
 }
 
 func NewRentalRequestService(
 	rentalRequestRepo repository.RentalRequestRepository,
 	statusLogRepo repository.RequestStatusLogRepository,
 	equipmentRepo repository.EquipmentRepository,
-	publisher messaging.RabbitMQPublisher,
+	authRepo repository.AuthRepository,
+	availability *availability.Checker,
+	lifecycle *lifecycle.Machine,
+	transactor repository.Transactor,
+	outboxRepo repository.OutboxRepository,
+	conditionReportRepo repository.ConditionReportRepository,
+	assetRepo repository.AssetRepository,
 ) RentalRequestService {
 	return &rentalRequestService{
-		rentalRequestRepo: rentalRequestRepo,
-		statusLogRepo:     statusLogRepo,
-		equipmentRepo:     equipmentRepo,
-		publisher:         publisher,
+		rentalRequestRepo:   rentalRequestRepo,
+		statusLogRepo:       statusLogRepo,
+		equipmentRepo:       equipmentRepo,
+		authRepo:            authRepo,
+		availability:        availability,
+		lifecycle:           lifecycle,
+		transactor:          transactor,
+		outboxRepo:          outboxRepo,
+		conditionReportRepo: conditionReportRepo,
+		assetRepo:           assetRepo,
 	}
 }
 
-func (s *rentalRequestService) GetRequestStatus(ctx context.Context, requestID uint) (*models.RequestStatusLog, error) {
-	// Проверяем существование заявки
+func (s *rentalRequestService) GetRequestStatus(ctx context.Context, actor Actor, requestID uint) (*models.RequestStatusLog, error) {
+	// Проверяем существование заявки и права на неё
 	request, err := s.rentalRequestRepo.GetRentalRequestByID(requestID)
 	if err != nil {
 		return nil, ErrRentalRequestNotFound
 	}
+	if !actor.CanAccess(request) {
+		return nil, ErrForbidden
+	}
 
 	// Получаем последний статус заявки
 	var statusLog models.RequestStatusLog
@@ -66,11 +156,14 @@ func (s *rentalRequestService) GetRequestStatus(ctx context.Context, requestID u
 	return &statusLog, nil
 }
 
-func (s *rentalRequestService) GetRequestStatusAt(ctx context.Context, requestID uint, datetime time.Time) (*models.RequestStatusLog, error) {
+func (s *rentalRequestService) GetRequestStatusAt(ctx context.Context, actor Actor, requestID uint, datetime time.Time) (*models.RequestStatusLog, error) {
 	request, err := s.rentalRequestRepo.GetRentalRequestByID(requestID)
 	if err != nil {
 		return nil, ErrRentalRequestNotFound
 	}
+	if !actor.CanAccess(request) {
+		return nil, ErrForbidden
+	}
 
 	var statusLog models.RequestStatusLog
 	if err := s.statusLogRepo.GetStatusAt(ctx, request.ID, datetime, &statusLog); err != nil {
@@ -80,6 +173,81 @@ func (s *rentalRequestService) GetRequestStatusAt(ctx context.Context, requestID
 	return &statusLog, nil
 }
 
+func (s *rentalRequestService) GetRequestHistory(ctx context.Context, actor Actor, requestID uint) ([]StatusHistoryEntry, error) {
+	request, err := s.rentalRequestRepo.GetRentalRequestByID(requestID)
+	if err != nil {
+		return nil, ErrRentalRequestNotFound
+	}
+	if !actor.CanAccess(request) {
+		return nil, ErrForbidden
+	}
+
+	logs, err := s.statusLogRepo.ListByRequestID(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	actors, err := s.actorNames(logs)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]StatusHistoryEntry, len(logs))
+	// start — запись, с которой начался текущий период в статусе: записи
+	// с тем же статусом подряд его не прерывают
+	start := 0
+	for i, log := range logs {
+		entry := StatusHistoryEntry{
+			Status:    log.Status,
+			Timestamp: log.Timestamp,
+			Comment:   log.Comment,
+			ActorID:   log.ActorID,
+			Actor:     systemActor,
+		}
+		if log.ActorID != nil {
+			entry.Actor = actors[*log.ActorID]
+		}
+		history[i] = entry
+
+		if log.Status != logs[start].Status {
+			history[start].DurationSeconds = int64(log.Timestamp.Sub(logs[start].Timestamp).Seconds())
+			start = i
+		}
+	}
+	if len(logs) > 0 {
+		history[start].DurationSeconds = int64(time.Since(logs[start].Timestamp).Seconds())
+		history[start].Current = true
+	}
+
+	return history, nil
+}
+
+// actorNames возвращает имена пользователей, упомянутых в журнале.
+func (s *rentalRequestService) actorNames(logs []models.RequestStatusLog) (map[uint]string, error) {
+	names := map[uint]string{}
+	var ids []uint
+	for _, log := range logs {
+		if log.ActorID != nil {
+			if _, ok := names[*log.ActorID]; !ok {
+				names[*log.ActorID] = fmt.Sprintf("user #%d", *log.ActorID)
+				ids = append(ids, *log.ActorID)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return names, nil
+	}
+
+	users, err := s.authRepo.GetUsersByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		names[user.ID] = user.Name
+	}
+	return names, nil
+}
+
 func (s *rentalRequestService) CreateRentalRequest(ctx context.Context, userID uint, req CreateRentalRequestRequest) (*models.RentalRequest, error) {
 	// Проверяем существование оборудования
 	equipment, err := s.equipmentRepo.GetEquipmentByID(req.EquipmentID)
@@ -87,51 +255,379 @@ func (s *rentalRequestService) CreateRentalRequest(ctx context.Context, userID u
 		return nil, ErrEquipmentNotFound
 	}
 
-	// Проверяем даты
-	log.Println(req)
-	//if req.FromDate.After(req.ToDate) || req.FromDate.Before(time.Now()) {
-	//	return nil, ErrInvalidDateRange
-	//}
+	// Проверяем даты и количество
+	if !req.FromDate.Before(req.ToDate) {
+		return nil, ErrInvalidDateRange
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	// Проверяем, что на период есть свободные единицы. Окончательно
+	// оборудование резервирует воркер при одобрении заявки.
+	result, err := s.availability.Check(ctx, equipment.ID, req.FromDate, req.ToDate, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Fits(req.Quantity) {
+		return nil, ErrEquipmentUnavailable
+	}
 
-	// Создаем заявку
+	// Заявка, её начальный статус и сообщение для воркера записываются
+	// в одной транзакции; в RabbitMQ сообщение отправит outbox.Relay
 	rentalRequest := &models.RentalRequest{
 		UserID:      userID,
 		EquipmentID: equipment.ID,
+		Quantity:    req.Quantity,
 		FromDate:    req.FromDate,
 		ToDate:      req.ToDate,
-		Status:      "pending", // Начальный статус
 	}
 
-	if err := s.rentalRequestRepo.CreateRentalRequest(rentalRequest); err != nil {
+	err = s.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		if err := s.lifecycle.CreateTx(ctx, tx, rentalRequest, lifecycle.Change{
+			Comment: "Request created",
+			ActorID: &userID,
+		}); err != nil {
+			return err
+		}
+
+		return s.enqueueRequest(ctx, tx, messaging.EventRentalRequestCreated, rentalRequest, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rentalRequest, nil
+}
+
+// GetReviewQueue возвращает заявки, ждущие решения менеджера, а затем
+// продления, не одобренные автоматически.
+func (s *rentalRequestService) GetReviewQueue(ctx context.Context) ([]models.RentalRequest, error) {
+	requests, err := s.rentalRequestRepo.ListByStatus(ctx, string(lifecycle.AwaitingReview))
+	if err != nil {
+		return nil, err
+	}
+
+	extensions, err := s.rentalRequestRepo.ListPendingExtensions(ctx, extendableStatuses)
+	if err != nil {
+		return nil, err
+	}
+	return append(requests, extensions...), nil
+}
+
+// ListOwnRentalRequests возвращает заявки пользователя; фильтр по
+// пользователю из запроса игнорируется.
+func (s *rentalRequestService) ListOwnRentalRequests(ctx context.Context, actor Actor, filter RentalRequestListFilter, page pagination.Request) (pagination.Page[models.RentalRequest], error) {
+	filter.UserID = &actor.UserID
+	return s.SearchRentalRequests(ctx, filter, page)
+}
+
+func (s *rentalRequestService) SearchRentalRequests(ctx context.Context, filter RentalRequestListFilter, page pagination.Request) (pagination.Page[models.RentalRequest], error) {
+	for _, status := range filter.Statuses {
+		if !lifecycle.Status(status).Valid() {
+			return pagination.Page[models.RentalRequest]{}, fmt.Errorf("%w: %s", ErrInvalidStatusFilter, status)
+		}
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return pagination.Page[models.RentalRequest]{}, ErrInvalidDateRange
+	}
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return pagination.Page[models.RentalRequest]{}, ErrInvalidDateRange
+	}
+
+	return s.rentalRequestRepo.ListRentalRequests(ctx, repository.RentalRequestFilter{
+		UserID:      filter.UserID,
+		EquipmentID: filter.EquipmentID,
+		Statuses:    filter.Statuses,
+		From:        filter.From,
+		To:          filter.To,
+		CreatedFrom: filter.CreatedFrom,
+		CreatedTo:   filter.CreatedTo,
+	}, page)
+}
+
+// ApproveRentalRequest одобряет заявку из очереди рассмотрения. Оборудование
+// резервируется в той же транзакции, что и смена статуса. Решение по строке
+// заказа применяется ко всем строкам заказа. Для заявки с продлением,
+// ждущим решения, решение относится к продлению.
+func (s *rentalRequestService) ApproveRentalRequest(ctx context.Context, actor Actor, requestID uint, comment string) (*models.RentalRequest, error) {
+	return s.review(ctx, actor, requestID, lifecycle.Approved, comment)
+}
+
+func (s *rentalRequestService) RejectRentalRequest(ctx context.Context, actor Actor, requestID uint, comment string) (*models.RentalRequest, error) {
+	return s.review(ctx, actor, requestID, lifecycle.Rejected, comment)
+}
+
+func (s *rentalRequestService) review(ctx context.Context, actor Actor, requestID uint, to lifecycle.Status, comment string) (*models.RentalRequest, error) {
+	if strings.TrimSpace(comment) == "" {
+		return nil, ErrCommentRequired
+	}
+
+	var request *models.RentalRequest
+	err := s.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		var err error
+		request, err = s.rentalRequestRepo.WithTx(tx).GetRentalRequestByIDForUpdate(ctx, requestID)
+		if err != nil {
+			return ErrRentalRequestNotFound
+		}
+
+		if request.PreviousToDate != nil && slices.Contains(extendableStatuses, request.Status) {
+			if request.OrderID == nil {
+				return s.reviewExtension(ctx, tx, actor, request, to, comment)
+			}
+			// Продление заказа одобряется или отклоняется для всех строк сразу
+			lines, err := s.rentalRequestRepo.WithTx(tx).ListByOrderIDForUpdate(ctx, *request.OrderID)
+			if err != nil {
+				return err
+			}
+			for i := range lines {
+				line := &lines[i]
+				if line.PreviousToDate == nil || !slices.Contains(extendableStatuses, line.Status) {
+					continue
+				}
+				if err := s.reviewExtension(ctx, tx, actor, line, to, comment); err != nil {
+					return err
+				}
+				if line.ID == request.ID {
+					*request = *line
+				}
+			}
+			return nil
+		}
+		if lifecycle.Status(request.Status) != lifecycle.AwaitingReview {
+			return ErrInvalidStatus
+		}
+
+		lines := []models.RentalRequest{*request}
+		if request.OrderID != nil {
+			// Строки отсортированы по оборудованию, как и в воркере
+			lines, err = s.rentalRequestRepo.WithTx(tx).ListByOrderIDForUpdate(ctx, *request.OrderID)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i := range lines {
+			line := &lines[i]
+			if lifecycle.Status(line.Status) != lifecycle.AwaitingReview {
+				continue
+			}
+
+			if to == lifecycle.Approved {
+				_, err := s.availability.Reserve(ctx, tx, line.EquipmentID, line.FromDate, line.ToDate, line.Quantity, line.ID)
+				switch {
+				case errors.Is(err, availability.ErrUnavailable):
+					return fmt.Errorf("%w: equipment %d", ErrEquipmentUnavailable, line.EquipmentID)
+				case err != nil:
+					return err
+				}
+			}
+
+			if err := s.lifecycle.TransitionTx(ctx, tx, line, to, lifecycle.Change{
+				Comment: comment,
+				ActorID: &actor.UserID,
+			}); err != nil {
+				return err
+			}
+			if line.ID == request.ID {
+				*request = *line
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	// Создаем начальный статус
-	statusLog := &models.RequestStatusLog{
-		RequestID: rentalRequest.ID,
-		Status:    "pending",
-		Timestamp: time.Now(),
-		Comment:   "Request created",
+	return request, nil
+}
+
+// reviewExtension применяет решение менеджера к продлению. Дополнительный
+// период уже зарезервирован, отказ возвращает прежнюю дату окончания.
+func (s *rentalRequestService) reviewExtension(ctx context.Context, tx *gorm.DB, actor Actor, request *models.RentalRequest, to lifecycle.Status, comment string) error {
+	previousToDate := *request.PreviousToDate
+	request.PreviousToDate = nil
+
+	change := lifecycle.Change{
+		Comment: "Extension approved: " + comment,
+		ActorID: &actor.UserID,
+	}
+	if to == lifecycle.Rejected {
+		request.ToDate = previousToDate
+		change.Comment = "Extension rejected, end date restored to " + previousToDate.Format(time.RFC3339) + ": " + comment
+	}
+	return s.lifecycle.AmendTx(ctx, tx, request, change)
+}
+
+// CancelRentalRequest отменяет заявку до выдачи оборудования. Заказ
+// выполняется целиком, поэтому строки заказа отменяются только через
+// RentalOrderService.CancelRentalOrder.
+func (s *rentalRequestService) CancelRentalRequest(ctx context.Context, actor Actor, requestID uint, comment string) (*models.RentalRequest, error) {
+	if comment == "" {
+		comment = "Request cancelled"
 	}
 
-	if err := s.statusLogRepo.CreateRequestStatusLog(statusLog); err != nil {
+	return s.change(ctx, actor, requestID, func(tx *gorm.DB, request *models.RentalRequest) error {
+		if request.OrderID != nil {
+			return ErrOrderLine
+		}
+
+		err := s.lifecycle.TransitionTx(ctx, tx, request, lifecycle.Cancelled, lifecycle.Change{
+			Comment: comment,
+			ActorID: &actor.UserID,
+		})
+		if errors.Is(err, lifecycle.ErrInvalidTransition) {
+			return ErrInvalidStatus
+		}
+		if err != nil {
+			return err
+		}
+
+		return s.enqueueRequest(ctx, tx, messaging.EventRentalRequestCancelled, request, nil)
+	})
+}
+
+// ModifyRentalRequest меняет даты заявки, пока она не одобрена. Заявка
+// возвращается в статус pending и заново оценивается воркером.
+func (s *rentalRequestService) ModifyRentalRequest(ctx context.Context, actor Actor, requestID uint, req ModifyRentalRequestRequest) (*models.RentalRequest, error) {
+	if !req.FromDate.Before(req.ToDate) {
+		return nil, ErrInvalidDateRange
+	}
+
+	return s.change(ctx, actor, requestID, func(tx *gorm.DB, request *models.RentalRequest) error {
+		status := lifecycle.Status(request.Status)
+		if status != lifecycle.Pending && status != lifecycle.AwaitingReview {
+			return ErrInvalidStatus
+		}
+		// Даты строк заказа общие, поменять их у одной строки нельзя
+		if request.OrderID != nil {
+			return ErrOrderLine
+		}
+
+		result, err := s.availability.Check(ctx, request.EquipmentID, req.FromDate, req.ToDate, request.ID)
+		if err != nil {
+			return err
+		}
+		if !result.Fits(request.Quantity) {
+			return ErrEquipmentUnavailable
+		}
+
+		change := lifecycle.Change{
+			Comment: fmt.Sprintf("Dates changed from %s – %s to %s – %s",
+				request.FromDate.Format(time.RFC3339), request.ToDate.Format(time.RFC3339),
+				req.FromDate.Format(time.RFC3339), req.ToDate.Format(time.RFC3339)),
+			ActorID: &actor.UserID,
+		}
+		request.FromDate = req.FromDate
+		request.ToDate = req.ToDate
+
+		if status == lifecycle.AwaitingReview {
+			err = s.lifecycle.TransitionTx(ctx, tx, request, lifecycle.Pending, change)
+		} else {
+			err = s.lifecycle.AmendTx(ctx, tx, request, change)
+		}
+		if err != nil {
+			return err
+		}
+
+		return s.enqueueRequest(ctx, tx, messaging.EventRentalRequestModified, request, nil)
+	})
+}
+
+// ExtendRentalRequest переносит дату окончания одобренной или выданной заявки.
+// Дополнительный период резервируется сразу, воркер затем заново проверяет
+// правила и при отказе откатывает продление.
+func (s *rentalRequestService) ExtendRentalRequest(ctx context.Context, actor Actor, requestID uint, req ExtendRentalRequestRequest) (*models.RentalRequest, error) {
+	return s.change(ctx, actor, requestID, func(tx *gorm.DB, request *models.RentalRequest) error {
+		// Следующее продление — только после решения по предыдущему
+		if !slices.Contains(extendableStatuses, request.Status) || request.PreviousToDate != nil {
+			return ErrInvalidStatus
+		}
+		if !req.ToDate.After(request.ToDate) {
+			return ErrInvalidDateRange
+		}
+		// Даты строк заказа общие, продлить одну строку нельзя
+		if request.OrderID != nil {
+			return ErrOrderLine
+		}
+
+		_, err := s.availability.Reserve(ctx, tx, request.EquipmentID, request.ToDate, req.ToDate, request.Quantity, request.ID)
+		switch {
+		case errors.Is(err, availability.ErrUnavailable):
+			return ErrEquipmentUnavailable
+		case err != nil:
+			return err
+		}
+
+		previousToDate := request.ToDate
+		request.ToDate = req.ToDate
+		err = s.lifecycle.AmendTx(ctx, tx, request, lifecycle.Change{
+			Comment: fmt.Sprintf("Extended from %s to %s",
+				previousToDate.Format(time.RFC3339), req.ToDate.Format(time.RFC3339)),
+			ActorID: &actor.UserID,
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.enqueueRequest(ctx, tx, messaging.EventRentalRequestExtended, request, &previousToDate)
+	})
+}
+
+// change блокирует заявку, проверяет права и выполняет fn в одной транзакции.
+func (s *rentalRequestService) change(ctx context.Context, actor Actor, requestID uint, fn func(tx *gorm.DB, request *models.RentalRequest) error) (*models.RentalRequest, error) {
+	var request *models.RentalRequest
+	err := s.transactor.WithinTransaction(ctx, func(tx *gorm.DB) error {
+		var err error
+		request, err = s.rentalRequestRepo.WithTx(tx).GetRentalRequestByIDForUpdate(ctx, requestID)
+		if err != nil {
+			return ErrRentalRequestNotFound
+		}
+		if !actor.CanAccess(request) {
+			return ErrForbidden
+		}
+		return fn(tx, request)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	// Отправляем сообщение в RabbitMQ
-	err = s.publisher.PublishRentalRequest(
-		ctx,
-		rentalRequest.ID,
-		userID,
-		equipment.ID,
-		req.FromDate.Format(time.RFC3339),
-		req.ToDate.Format(time.RFC3339),
-	)
+	return request, nil
+}
+
+// enqueueRequest записывает событие по заявке в outbox в транзакции tx.
+func (s *rentalRequestService) enqueueRequest(ctx context.Context, tx *gorm.DB, event string, request *models.RentalRequest, previousToDate *time.Time) error {
+	msg := messaging.RentalRequestMessage{
+		Event:       event,
+		RequestID:   request.ID,
+		UserID:      request.UserID,
+		EquipmentID: request.EquipmentID,
+		Quantity:    request.Quantity,
+		FromDate:    request.FromDate.Format(time.RFC3339Nano),
+		ToDate:      request.ToDate.Format(time.RFC3339Nano),
+	}
+	if previousToDate != nil {
+		msg.PreviousToDate = previousToDate.Format(time.RFC3339Nano)
+	}
+
+	return enqueue(ctx, s.outboxRepo.WithTx(tx), msg)
+}
+
+// enqueue записывает сообщение для воркера в outbox. Репозиторий должен
+// быть привязан к транзакции, в которой меняются заявки.
+func enqueue(ctx context.Context, outboxRepo repository.OutboxRepository, msg messaging.RentalRequestMessage) error {
+	payload, err := messaging.MarshalRentalRequest(msg)
 	if err != nil {
-		// В случае ошибки отправки в RabbitMQ, мы все равно возвращаем созданную заявку
-		// Возможно, стоит добавить механизм повторных попыток или компенсирующих транзакций
-		return rentalRequest, nil
+		return err
 	}
 
-	return rentalRequest, nil
+	return outboxRepo.CreateMessage(ctx, &models.OutboxMessage{
+		Event:         msg.Event,
+		Payload:       payload,
+		Status:        models.OutboxPending,
+		NextAttemptAt: time.Now(),
+	})
 }